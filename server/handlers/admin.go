@@ -23,18 +23,34 @@ func CreateTeacher(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if request.Role != "teacher" && request.Role != "admin" {
+		// role 为角色名称，如 teacher、admin、teaching_assistant
+		var role models.Role
+		if err := db.Where("name = ?", request.Role).First(&role).Error; err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
 			return
 		}
 
-		// 如果密码为空，设置默认密码
+		// 如果密码为空，生成随机初始密码
+		var initialPassword string
 		if request.Password == "" {
-			request.Password = "123456"
+			password, err := models.GeneratePassword()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate password"})
+				return
+			}
+			request.Password = password
+			initialPassword = password
+		} else if err := models.ValidatePassword(request.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 
 		// 密码需要哈希加密
-		passwordHash := models.HashPassword(request.Password)
+		passwordHash, err := models.HashPassword(request.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
 
 		teacher := models.User{
 			Username: request.Username,
@@ -45,20 +61,36 @@ func CreateTeacher(db *gorm.DB) gin.HandlerFunc {
 			Status:   1, // 1: active
 		}
 
-		if err := db.Create(&teacher).Error; err != nil {
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&teacher).Error; err != nil {
+				return err
+			}
+			return assignRoles(tx, &teacher, []string{role.Name})
+		}); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create teacher"})
 			return
 		}
+		recordAudit(db, c, models.AuditTeacherCreate, "user", teacher.ID, nil, gin.H{
+			"user":  auditUser(teacher),
+			"roles": []string{role.Name},
+		})
 
-		c.JSON(http.StatusCreated, gin.H{
+		response := gin.H{
 			"id":       teacher.ID,
 			"username": teacher.Username,
 			"name":     teacher.Name,
 			"role":     teacher.Role,
 			"isAdmin":  teacher.IsAdmin,
+			"roles":    []string{role.Name},
 			"status":   teacher.Status,
 			"message":  "Teacher created successfully",
-		})
+		}
+		// 随机生成的初始密码只在创建时返回一次
+		if initialPassword != "" {
+			response["initialPassword"] = initialPassword
+		}
+
+		c.JSON(http.StatusCreated, response)
 	}
 }
 
@@ -73,9 +105,10 @@ func UpdateTeacher(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		var updateData struct {
-			Name    string `json:"name"`
-			IsAdmin int    `json:"isAdmin"`
-			Status  int    `json:"status"`
+			Name     string `json:"name"`
+			IsAdmin  int    `json:"isAdmin"`
+			Status   *int   `json:"status"`
+			Password string `json:"password"` // 管理员重置密码
 		}
 
 		if err := c.ShouldBindJSON(&updateData); err != nil {
@@ -83,16 +116,44 @@ func UpdateTeacher(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		before := auditUser(teacher)
+
 		// 更新字段
 		if updateData.Name != "" {
 			teacher.Name = updateData.Name
 		}
+		if updateData.Status != nil {
+			teacher.Status = byte(*updateData.Status)
+		}
+		if updateData.Password != "" {
+			if err := models.ValidatePassword(updateData.Password); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			passwordHash, err := models.HashPassword(updateData.Password)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+				return
+			}
+			teacher.Password = passwordHash
+			teacher.RandomPassword = false
+		}
 
 		if err := db.Save(&teacher).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update teacher"})
 			return
 		}
 
+		recordAudit(db, c, models.AuditTeacherUpdate, "user", teacher.ID, before, auditUser(teacher))
+
+		// 停用账号或重置密码后立即吊销其所有会话
+		if updateData.Password != "" {
+			recordAudit(db, c, models.AuditTeacherPasswordReset, "user", teacher.ID, nil, nil)
+		}
+		if teacher.Status != 1 || updateData.Password != "" {
+			revokeUserSessions(db, teacher.ID)
+		}
+
 		c.JSON(http.StatusOK, gin.H{
 			"id":       teacher.ID,
 			"username": teacher.Username,
@@ -129,7 +190,42 @@ func DeleteTeacher(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete teacher"})
 			return
 		}
+		db.Where("user_id = ?", teacher.ID).Delete(&models.UserRole{})
+		db.Where("user_id = ?", teacher.ID).Delete(&models.UserIdentity{})
+		recordAudit(db, c, models.AuditTeacherDelete, "user", teacher.ID, auditUser(teacher), nil)
+		revokeUserSessions(db, teacher.ID)
 
 		c.JSON(http.StatusOK, gin.H{"message": "Teacher deleted successfully"})
 	}
 }
+
+// UnlockAccount 解除账号锁定并清零登录失败次数
+func UnlockAccount(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		var user models.User
+		if err := db.First(&user, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		if err := db.Model(&user).Updates(map[string]interface{}{
+			"failed_login_count": 0,
+			"locked_until":       nil,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account"})
+			return
+		}
+		recordAudit(db, c, models.AuditAccountUnlock, "user", user.ID, gin.H{
+			"failedLoginCount": user.FailedLoginCount,
+			"lockedUntil":      user.LockedUntil,
+		}, nil)
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":       user.ID,
+			"username": user.Username,
+			"message":  "Account unlocked successfully",
+		})
+	}
+}
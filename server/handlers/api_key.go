@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"net/http"
+	"server/models"
+	"server/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetAPIKeys 获取API密钥列表（不包含密钥本身）
+func GetAPIKeys(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys := []models.APIKey{}
+		if err := db.Order("id DESC").Find(&keys).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"apiKeys": keys,
+			"total":   len(keys),
+			"scopes":  models.APIKeyScopes,
+		})
+	}
+}
+
+// CreateAPIKey 创建API密钥，密钥只在创建时返回一次
+func CreateAPIKey(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Name      string     `json:"name" binding:"required"`
+			Scopes    []string   `json:"scopes" binding:"required"`
+			ExpiresAt *time.Time `json:"expiresAt"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key data"})
+			return
+		}
+
+		scopes := uniqueStrings(request.Scopes)
+		if len(scopes) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one scope is required"})
+			return
+		}
+		for _, scope := range scopes {
+			if !models.IsValidAPIKeyScope(scope) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope: " + scope})
+				return
+			}
+		}
+		if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+			return
+		}
+
+		token, err := utils.RandomToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+			return
+		}
+		rawKey := models.APIKeyPrefix + token
+
+		key := models.APIKey{
+			Name:      request.Name,
+			Prefix:    rawKey[:12],
+			KeyHash:   utils.HashToken(rawKey),
+			Scopes:    models.Permissions(scopes),
+			CreatedBy: currentUserID(c),
+			ExpiresAt: request.ExpiresAt,
+		}
+		if err := db.Create(&key).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+			return
+		}
+		recordAudit(db, c, models.AuditAPIKeyCreate, "api_key", key.ID, nil, key)
+
+		c.JSON(http.StatusCreated, gin.H{
+			"apiKey":  key,
+			"key":     rawKey,
+			"message": "API key created successfully, it will not be shown again",
+		})
+	}
+}
+
+// RevokeAPIKey 吊销API密钥
+func RevokeAPIKey(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var key models.APIKey
+		if err := db.First(&key, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		if key.RevokedAt != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "API key already revoked"})
+			return
+		}
+
+		now := time.Now()
+		if err := db.Model(&key).Update("revoked_at", &now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+			return
+		}
+		recordAudit(db, c, models.AuditAPIKeyRevoke, "api_key", key.ID, nil, gin.H{"name": key.Name, "prefix": key.Prefix})
+
+		c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"server/middlewares"
+	"server/models"
+	"server/utils"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestResultsReadKeyCannotReadExamContent(t *testing.T) {
+	db := newTestDB(t)
+	f := newGradingFixture(t, db, false)
+	var role models.Role
+	db.Where("name = ?", models.RoleTeacher).First(&role)
+	db.Create(&models.UserRole{UserID: f.teacher.ID, RoleID: role.ID})
+
+	router := gin.New()
+	router.GET("/api/teacher/exams/:id", middlewares.AuthMiddleware(db),
+		middlewares.RequirePermission(models.PermExamView), GetExamDetails(db))
+	router.GET("/api/teacher/classes/:id/gradebook", middlewares.AuthMiddleware(db),
+		middlewares.RequirePermission(models.PermResultView), GetGradebook(db))
+
+	newKey := func(scopes ...string) string {
+		raw := models.APIKeyPrefix + "test-" + scopes[0]
+		db.Create(&models.APIKey{Name: scopes[0], KeyHash: utils.HashToken(raw), Scopes: scopes, CreatedBy: f.teacher.ID})
+		return raw
+	}
+	resultsKey := newKey(models.APIKeyScopeResultsRead)
+	examsKey := newKey(models.APIKeyScopeExamsRead)
+	examURL := "/api/teacher/exams/" + strconv.FormatUint(uint64(f.exam.ID), 10)
+	var assignment models.ExamAssignment
+	db.First(&assignment, f.result.ExamAssignmentID)
+	gradebookURL := "/api/teacher/classes/" + strconv.FormatUint(uint64(assignment.ClassID), 10) + "/gradebook"
+
+	tests := []struct {
+		name, target, key string
+		code              int
+	}{
+		{"results key reads the gradebook", gradebookURL, resultsKey, http.StatusOK},
+		{"results key cannot read the answer key", examURL, resultsKey, http.StatusForbidden},
+		{"exams key reads exam content", examURL, examsKey, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := doRequest(router, http.MethodGet, tt.target, nil, tt.key); w.Code != tt.code {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+		})
+	}
+}
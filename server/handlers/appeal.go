@@ -0,0 +1,515 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"server/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// appealResponses 构建申诉列表，附带学生、试卷、题目和状态历史
+//
+// forStudent 为 true 时按考试安排的 ShowCorrectness 决定是否返回每题得分
+func appealResponses(db *gorm.DB, appeals []models.Appeal, forStudent bool) []gin.H {
+	response := make([]gin.H, 0, len(appeals))
+	if len(appeals) == 0 {
+		return response
+	}
+
+	var resultIDs, questionIDs, userIDs []uint
+	for _, appeal := range appeals {
+		resultIDs = append(resultIDs, appeal.ExamResultID)
+		questionIDs = append(questionIDs, appeal.QuestionID)
+		userIDs = append(userIDs, appeal.StudentID, appeal.ResolvedBy)
+		for _, event := range appeal.Events {
+			userIDs = append(userIDs, event.CreatedBy)
+		}
+	}
+
+	var users []models.User
+	db.Select("id", "name").Where("id IN ?", userIDs).Find(&users)
+	names := make(map[uint]string, len(users))
+	for _, user := range users {
+		names[user.ID] = user.Name
+	}
+
+	var questions []models.Question
+	db.Where("id IN ?", questionIDs).Find(&questions)
+	questionsByID := make(map[uint]models.Question, len(questions))
+	for _, question := range questions {
+		questionsByID[question.ID] = question
+	}
+
+	var results []models.ExamResult
+	db.Preload("ExamAssignment.Exam").Preload("ExamAssignment.Class").Where("id IN ?", resultIDs).Find(&results)
+	resultsByID := make(map[uint]models.ExamResult, len(results))
+	for _, result := range results {
+		resultsByID[result.ID] = result
+	}
+	records := loadResultAnswers(db, resultIDs)
+
+	for _, appeal := range appeals {
+		result := resultsByID[appeal.ExamResultID]
+		question := questionsByID[appeal.QuestionID]
+		record := records[appeal.ExamResultID][appeal.QuestionID]
+
+		events := make([]gin.H, 0, len(appeal.Events))
+		for _, event := range appeal.Events {
+			events = append(events, gin.H{
+				"status":        event.Status,
+				"message":       event.Message,
+				"createdBy":     event.CreatedBy,
+				"createdByName": names[event.CreatedBy],
+				"createdAt":     event.CreatedAt,
+			})
+		}
+
+		item := gin.H{
+			"id":               appeal.ID,
+			"examResultId":     appeal.ExamResultID,
+			"examAssignmentId": appeal.ExamAssignmentID,
+			"examTitle":        result.ExamAssignment.Exam.Title,
+			"className":        result.ExamAssignment.Class.Name,
+			"studentId":        appeal.StudentID,
+			"studentName":      names[appeal.StudentID],
+			"questionId":       appeal.QuestionID,
+			"questionContent":  question.Content,
+			"questionType":     question.Type,
+			"answer":           record.Answer,
+			"answers":          record.BlankAnswers,
+			"awardedPoints":    record.AwardedPoints,
+			"maxPoints":        record.MaxPoints,
+			"message":          appeal.Message,
+			"status":           appeal.Status,
+			"reply":            appeal.Reply,
+			"oldPoints":        appeal.OldPoints,
+			"newPoints":        appeal.NewPoints,
+			"resolvedBy":       appeal.ResolvedBy,
+			"resolvedByName":   names[appeal.ResolvedBy],
+			"resolvedAt":       appeal.ResolvedAt,
+			"createdAt":        appeal.CreatedAt,
+			"events":           events,
+		}
+		if forStudent && !result.ExamAssignment.ShowCorrectness {
+			for _, key := range []string{"awardedPoints", "maxPoints", "oldPoints", "newPoints"} {
+				delete(item, key)
+			}
+		}
+		response = append(response, item)
+	}
+	return response
+}
+
+// notifyAppealTeachers 通过站内消息通知班级教师和试卷所有者有新的申诉
+func notifyAppealTeachers(db *gorm.DB, assignment models.ExamAssignment, studentName string, appeal models.Appeal) {
+	teachers := []uint{assignment.Class.TeacherID}
+	if owner := assignment.Exam.CreatedBy; owner != 0 && owner != assignment.Class.TeacherID {
+		teachers = append(teachers, owner)
+	}
+
+	for _, teacherID := range teachers {
+		if teacherID == 0 {
+			continue
+		}
+		message := models.Message{
+			MessageType:   "general",
+			TargetExam:    assignment.ExamID,
+			TargetTeacher: teacherID,
+			Title:         "新的成绩申诉",
+			Content:       fmt.Sprintf("%s 对《%s》的成绩提出申诉：%s", studentName, assignment.Exam.Title, appeal.Message),
+			SendMethod:    "immediate",
+			Status:        "pending",
+			CreatedBy:     appeal.StudentID,
+		}
+		if err := db.Create(&message).Error; err != nil {
+			continue
+		}
+		if scheduler != nil {
+			go scheduler.sendMessage(&message)
+		}
+	}
+}
+
+// notifyAppealStudent 通过站内消息通知学生申诉的处理结果，考试安排不显示每题得分时不包含分数
+func notifyAppealStudent(db *gorm.DB, c *gin.Context, assignment models.ExamAssignment, appeal models.Appeal) {
+	exam := assignment.Exam
+	content := fmt.Sprintf("你对《%s》的成绩申诉已被驳回。", exam.Title)
+	if appeal.Status == models.AppealAccepted {
+		content = fmt.Sprintf("你对《%s》的成绩申诉已被接受。", exam.Title)
+		if assignment.ShowCorrectness {
+			content = fmt.Sprintf("你对《%s》的成绩申诉已被接受，该题得分由 %d 分调整为 %d 分。", exam.Title, appeal.OldPoints, *appeal.NewPoints)
+		}
+	}
+	if appeal.Reply != "" {
+		content += "教师回复：" + appeal.Reply
+	}
+
+	message := models.Message{
+		MessageType:   "system_notice",
+		TargetExam:    exam.ID,
+		TargetStudent: appeal.StudentID,
+		Title:         "成绩申诉已处理",
+		Content:       content,
+		SendMethod:    "immediate",
+		Status:        "pending",
+		CreatedBy:     currentUserID(c),
+	}
+	if err := db.Create(&message).Error; err != nil {
+		return
+	}
+	if scheduler != nil {
+		go scheduler.sendMessage(&message)
+	}
+}
+
+// errAppealPending 同一道题已有待处理的申诉
+var errAppealPending = errors.New("appeal already pending")
+
+// pendingAppealExists 答卷中某道题是否有待处理的申诉
+func pendingAppealExists(db *gorm.DB, resultID, questionID uint) bool {
+	var pending int64
+	db.Model(&models.Appeal{}).Where("exam_result_id = ? AND question_id = ? AND status = ?",
+		resultID, questionID, models.AppealPending).Count(&pending)
+	return pending > 0
+}
+
+// CreateAppeal 学生对已公布成绩中的某道题提出申诉，同一道题同时只能有一个待处理的申诉
+func CreateAppeal(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			QuestionID uint   `json:"questionId" binding:"required"`
+			Message    string `json:"message" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil || strings.TrimSpace(request.Message) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Question and message are required"})
+			return
+		}
+
+		studentID := currentUserID(c)
+		var result models.ExamResult
+		if err := db.Preload("ExamAssignment.Exam").Preload("ExamAssignment.Class").
+			Where("id = ? AND student_id = ?", c.Param("resultId"), studentID).First(&result).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
+			return
+		}
+
+		// 成绩公布后才能申诉
+		if !resultsReleased(result.ExamAssignment) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Results have not been released"})
+			return
+		}
+
+		// 不显示每题得分时不能按题申诉，避免通过申诉得知各题得分
+		if !result.ExamAssignment.ShowCorrectness {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Question scores are not shown for this exam"})
+			return
+		}
+
+		var record models.ResultAnswer
+		if err := db.Where("exam_result_id = ? AND question_id = ?", result.ID, request.QuestionID).
+			First(&record).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Answer not found"})
+			return
+		}
+
+		appeal := models.Appeal{
+			ExamResultID:     result.ID,
+			ExamAssignmentID: result.ExamAssignmentID,
+			QuestionID:       request.QuestionID,
+			StudentID:        studentID,
+			Message:          strings.TrimSpace(request.Message),
+			Status:           models.AppealPending,
+			OldPoints:        record.AwardedPoints,
+			Events: []models.AppealEvent{{
+				Status:    models.AppealPending,
+				Message:   strings.TrimSpace(request.Message),
+				CreatedBy: studentID,
+			}},
+		}
+		// 同一道题的待处理申诉有唯一索引，同时提交时只有一个能创建成功
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var pending int64
+			if err := tx.Model(&models.Appeal{}).Where("exam_result_id = ? AND question_id = ? AND status = ?",
+				result.ID, request.QuestionID, models.AppealPending).Count(&pending).Error; err != nil {
+				return err
+			}
+			if pending > 0 {
+				return errAppealPending
+			}
+			return tx.Create(&appeal).Error
+		})
+		if errors.Is(err, errAppealPending) || (err != nil && pendingAppealExists(db, result.ID, request.QuestionID)) {
+			c.JSON(http.StatusConflict, gin.H{"error": "An appeal for this question is already pending"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create appeal"})
+			return
+		}
+
+		var student models.User
+		db.Select("id", "name").First(&student, studentID)
+		notifyAppealTeachers(db, result.ExamAssignment, student.Name, appeal)
+
+		c.JSON(http.StatusCreated, gin.H{
+			"id":      appeal.ID,
+			"status":  appeal.Status,
+			"message": "Appeal submitted successfully",
+		})
+	}
+}
+
+// GetStudentAppeals 学生查看自己的申诉及处理记录
+func GetStudentAppeals(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Preload("Events", func(tx *gorm.DB) *gorm.DB { return tx.Order("id") }).
+			Where("student_id = ?", currentUserID(c))
+		if resultID := c.Query("resultId"); resultID != "" {
+			query = query.Where("exam_result_id = ?", resultID)
+		}
+
+		var appeals []models.Appeal
+		if err := query.Order("id DESC").Find(&appeals).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch appeals"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"appeals": appealResponses(db, appeals, true),
+			"total":   len(appeals),
+		})
+	}
+}
+
+// GetAppeals 教师查看可访问考试的申诉，默认按提交时间列出待处理的申诉
+func GetAppeals(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+		if page < 1 {
+			page = 1
+		}
+		if pageSize < 1 || pageSize > 100 {
+			pageSize = 20
+		}
+
+		query := db.Model(&models.Appeal{})
+		if ids, all := accessibleAssignmentIDs(db, c); !all {
+			query = query.Where("exam_assignment_id IN ?", ids)
+		}
+		status := c.DefaultQuery("status", models.AppealPending)
+		if status != "all" {
+			query = query.Where("status = ?", status)
+		}
+		if assignmentID := c.Query("assignmentId"); assignmentID != "" {
+			query = query.Where("exam_assignment_id = ?", assignmentID)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count appeals"})
+			return
+		}
+
+		var appeals []models.Appeal
+		if err := query.Preload("Events", func(tx *gorm.DB) *gorm.DB { return tx.Order("id") }).
+			Order("id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&appeals).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch appeals"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"appeals":  appealResponses(db, appeals, false),
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
+		})
+	}
+}
+
+// pendingAppeal 加载教师可以处理的待处理申诉，失败时已写入响应
+func pendingAppeal(db *gorm.DB, c *gin.Context) (models.Appeal, models.ExamResult, bool) {
+	var appeal models.Appeal
+	if err := db.First(&appeal, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appeal not found"})
+		return appeal, models.ExamResult{}, false
+	}
+
+	// 处理申诉会修改成绩，需要对分配的班级或试卷有编辑权限
+	if assignmentAccess(db, c, appeal.ExamAssignmentID) < accessEdit {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No permission to resolve this appeal"})
+		return appeal, models.ExamResult{}, false
+	}
+
+	if appeal.Status != models.AppealPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Appeal already resolved"})
+		return appeal, models.ExamResult{}, false
+	}
+
+	var result models.ExamResult
+	if err := db.Preload("ExamAssignment.Exam").First(&result, appeal.ExamResultID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
+		return appeal, result, false
+	}
+	return appeal, result, true
+}
+
+// errAppealResolved 申诉已被其他教师处理
+var errAppealResolved = errors.New("appeal already resolved")
+
+// resolveAppeal 在事务中把待处理的申诉更新为处理结果并记录状态变化，
+// 只更新仍为 pending 的申诉，两名教师同时处理时后提交的返回 errAppealResolved
+func resolveAppeal(tx *gorm.DB, appeal models.Appeal) error {
+	update := tx.Model(&models.Appeal{}).Where("id = ? AND status = ?", appeal.ID, models.AppealPending).
+		Updates(map[string]interface{}{
+			"status":      appeal.Status,
+			"reply":       appeal.Reply,
+			"old_points":  appeal.OldPoints,
+			"new_points":  appeal.NewPoints,
+			"resolved_by": appeal.ResolvedBy,
+			"resolved_at": appeal.ResolvedAt,
+		})
+	if update.Error != nil {
+		return update.Error
+	}
+	if update.RowsAffected == 0 {
+		return errAppealResolved
+	}
+	return tx.Create(&models.AppealEvent{
+		AppealID:  appeal.ID,
+		Status:    appeal.Status,
+		Message:   appeal.Reply,
+		CreatedBy: appeal.ResolvedBy,
+	}).Error
+}
+
+// AcceptAppeal 接受申诉并调整该题得分，总分随之更新
+func AcceptAppeal(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Points *int   `json:"points" binding:"required"`
+			Reply  string `json:"reply"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Points are required"})
+			return
+		}
+
+		appeal, result, ok := pendingAppeal(db, c)
+		if !ok {
+			return
+		}
+
+		var record models.ResultAnswer
+		if err := db.Where("exam_result_id = ? AND question_id = ?", result.ID, appeal.QuestionID).
+			First(&record).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Answer not found"})
+			return
+		}
+		if *request.Points < 0 || *request.Points > record.MaxPoints {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Points out of range"})
+			return
+		}
+
+		before := gin.H{"status": appeal.Status, "awardedPoints": record.AwardedPoints, "score": result.Score}
+		now := time.Now()
+		appeal.Status = models.AppealAccepted
+		appeal.Reply = strings.TrimSpace(request.Reply)
+		appeal.OldPoints = record.AwardedPoints
+		appeal.NewPoints = request.Points
+		appeal.ResolvedBy = currentUserID(c)
+		appeal.ResolvedAt = &now
+
+		// 先把申诉标记为已处理再修改得分，保证同一申诉只会调整一次成绩
+		var score int
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := resolveAppeal(tx, appeal); err != nil {
+				return err
+			}
+			var err error
+			score, err = setAnswerPoints(tx, c, result, record, *request.Points)
+			return err
+		})
+		if errors.Is(err, errAppealResolved) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Appeal already resolved"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept appeal"})
+			return
+		}
+
+		recordAudit(db, c, models.AuditAppealAccept, "exam_result", result.ID, before, gin.H{
+			"appealId":      appeal.ID,
+			"questionId":    appeal.QuestionID,
+			"awardedPoints": *request.Points,
+			"score":         score,
+			"reply":         appeal.Reply,
+		})
+		go publishLTIScore(db, result.ID)
+		notifyAppealStudent(db, c, result.ExamAssignment, appeal)
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":            appeal.ID,
+			"status":        appeal.Status,
+			"awardedPoints": *request.Points,
+			"score":         score,
+			"message":       "Appeal accepted successfully",
+		})
+	}
+}
+
+// RejectAppeal 驳回申诉，需要填写回复
+func RejectAppeal(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Reply string `json:"reply" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil || strings.TrimSpace(request.Reply) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Reply is required"})
+			return
+		}
+
+		appeal, result, ok := pendingAppeal(db, c)
+		if !ok {
+			return
+		}
+
+		now := time.Now()
+		appeal.Status = models.AppealRejected
+		appeal.Reply = strings.TrimSpace(request.Reply)
+		appeal.ResolvedBy = currentUserID(c)
+		appeal.ResolvedAt = &now
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return resolveAppeal(tx, appeal)
+		})
+		if errors.Is(err, errAppealResolved) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Appeal already resolved"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject appeal"})
+			return
+		}
+
+		recordAudit(db, c, models.AuditAppealReject, "exam_result", result.ID, nil, gin.H{
+			"appealId":   appeal.ID,
+			"questionId": appeal.QuestionID,
+			"reply":      appeal.Reply,
+		})
+		notifyAppealStudent(db, c, result.ExamAssignment, appeal)
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":      appeal.ID,
+			"status":  appeal.Status,
+			"message": "Appeal rejected successfully",
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"server/models"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAppealsFollowShowCorrectness(t *testing.T) {
+	db := newTestDB(t)
+	f := newGradingFixture(t, db, false)
+	router := gin.New()
+	asStudent := func(c *gin.Context) {
+		c.Set("user", gin.H{"id": f.result.StudentID, "username": "student", "permissions": models.Permissions{}})
+	}
+	router.POST("/student/results/:resultId/appeals", asStudent, CreateAppeal(db))
+	router.GET("/student/appeals", asStudent, GetStudentAppeals(db))
+	router.GET("/teacher/appeals", asUser(f.teacher.ID), GetAppeals(db))
+	appealURL := "/student/results/" + strconv.FormatUint(uint64(f.result.ID), 10) + "/appeals"
+	request := gin.H{"questionId": f.questions[1].ID, "message": "please recheck"}
+
+	// 不显示每题得分时不能按题申诉
+	if w := doRequest(router, http.MethodPost, appealURL, request, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403: %s", w.Code, w.Body.String())
+	}
+
+	db.Model(&models.ExamAssignment{}).Where("id = ?", f.result.ExamAssignmentID).Update("show_correctness", true)
+	if w := doRequest(router, http.MethodPost, appealURL, request, ""); w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+
+	appeals := func(target string) []map[string]interface{} {
+		t.Helper()
+		w := doRequest(router, http.MethodGet, target, nil, "")
+		var body struct {
+			Appeals []map[string]interface{} `json:"appeals"`
+		}
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &body) != nil || len(body.Appeals) != 1 {
+			t.Fatalf("%s: status %d: %s", target, w.Code, w.Body.String())
+		}
+		return body.Appeals
+	}
+	if _, ok := appeals("/student/appeals")[0]["awardedPoints"]; !ok {
+		t.Fatalf("points hidden although question scores are shown")
+	}
+
+	// 之后关闭显示每题得分，学生看不到申诉中的得分，教师仍可以看到
+	db.Model(&models.ExamAssignment{}).Where("id = ?", f.result.ExamAssignmentID).Update("show_correctness", false)
+	for _, key := range []string{"awardedPoints", "maxPoints", "oldPoints", "newPoints"} {
+		if _, ok := appeals("/student/appeals")[0][key]; ok {
+			t.Fatalf("student response contains %s", key)
+		}
+	}
+	if points := appeals("/teacher/appeals")[0]["awardedPoints"]; points != float64(-5) {
+		t.Fatalf("teacher response awardedPoints %v, want -5", points)
+	}
+}
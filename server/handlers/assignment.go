@@ -32,11 +32,18 @@ func GetAssignments(db *gorm.DB) gin.HandlerFunc {
 		// 构建查询
 		query := db.Preload("Exam").Preload("Class")
 
+		// 教师只能看到自己班级或自己试卷的分配
+		if ids, all := accessibleAssignmentIDs(db, c); !all {
+			query = query.Where("exam_assignments.id IN ?", ids)
+		}
+
 		// 搜索条件
 		if keyword != "" {
 			search := "%" + keyword + "%"
-			query = query.Where("exam_assignments.description LIKE ? OR exams.title LIKE ? OR classes.name LIKE ?",
-				search, search, search)
+			query = query.Joins("LEFT JOIN exams ON exams.id = exam_assignments.exam_id").
+				Joins("LEFT JOIN classes ON classes.id = exam_assignments.class_id").
+				Where("exam_assignments.description LIKE ? OR exams.title LIKE ? OR classes.name LIKE ?",
+					search, search, search)
 		}
 
 		// 获取总数
@@ -69,6 +76,14 @@ func GetAssignments(db *gorm.DB) gin.HandlerFunc {
 				"passScore":   assignment.PassScore,
 				"description": assignment.Description,
 				"createdAt":   assignment.CreatedAt,
+
+				"releasePolicy":   releasePolicy(assignment),
+				"releasedAt":      assignment.ReleasedAt,
+				"released":        resultsReleased(assignment),
+				"showCorrectness": assignment.ShowCorrectness,
+				"showAnswers":     assignment.ShowAnswers,
+				"showFeedback":    assignment.ShowFeedback,
+				"categoryId":      assignment.CategoryID,
 			})
 		}
 
@@ -100,17 +115,28 @@ func CreateAssignment(db *gorm.DB) gin.HandlerFunc {
 			Duration    int    `json:"duration" binding:"required"`
 			PassScore   int    `json:"passScore" binding:"required"`
 			Description string `json:"description"`
+
+			ReleasePolicy   string `json:"releasePolicy"`
+			ShowCorrectness bool   `json:"showCorrectness"`
+			ShowAnswers     bool   `json:"showAnswers"`
+			ShowFeedback    bool   `json:"showFeedback"`
 		}
 
 		if err := c.ShouldBindJSON(&request); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment data"})
 			return
 		}
+		if !validReleasePolicy(request.ReleasePolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid release policy"})
+			return
+		}
+		if request.ReleasePolicy == "" {
+			request.ReleasePolicy = models.ReleaseImmediate
+		}
 
-		// 验证试卷是否存在
-		var exam models.Exam
-		if err := db.First(&exam, request.ExamID).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Exam not found"})
+		// 验证试卷是否存在且可访问
+		exam, ok := requireExamAccess(db, c, request.ExamID, accessView)
+		if !ok {
 			return
 		}
 
@@ -134,6 +160,13 @@ func CreateAssignment(db *gorm.DB) gin.HandlerFunc {
 				return
 			}
 
+			// 只能向自己负责或可编辑的班级分配试卷
+			if classAccess(db, c, class) < accessEdit {
+				tx.Rollback()
+				c.JSON(http.StatusForbidden, gin.H{"error": "No permission to access class: " + strconv.FormatUint(uint64(classID), 10)})
+				return
+			}
+
 			assignment := models.ExamAssignment{
 				ExamID:      request.ExamID,
 				ClassID:     classID,
@@ -142,6 +175,11 @@ func CreateAssignment(db *gorm.DB) gin.HandlerFunc {
 				Duration:    request.Duration,
 				PassScore:   request.PassScore,
 				Description: request.Description,
+
+				ReleasePolicy:   request.ReleasePolicy,
+				ShowCorrectness: request.ShowCorrectness,
+				ShowAnswers:     request.ShowAnswers,
+				ShowFeedback:    request.ShowFeedback,
 			}
 
 			if err := tx.Create(&assignment).Error; err != nil {
@@ -155,6 +193,10 @@ func CreateAssignment(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		tx.Commit()
+		for _, assignment := range assignments {
+			recordAudit(db, c, models.AuditAssignmentCreate, "exam_assignment", assignment.ID, nil, assignment)
+		}
+
 		c.JSON(http.StatusCreated, gin.H{
 			"assignments":   assignments,
 			"assignmentIds": assignmentIds,
@@ -173,18 +215,33 @@ func UpdateAssignment(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 需要对分配的班级有编辑权限
+		if _, ok := requireClassAccess(db, c, assignment.ClassID, accessEdit); !ok {
+			return
+		}
+
 		var request struct {
 			StartTime   string `json:"startTime"`
 			EndTime     string `json:"endTime"`
 			Duration    int    `json:"duration"`
 			PassScore   int    `json:"passScore"`
 			Description string `json:"description"`
+
+			ReleasePolicy   string `json:"releasePolicy"`
+			ShowCorrectness *bool  `json:"showCorrectness"`
+			ShowAnswers     *bool  `json:"showAnswers"`
+			ShowFeedback    *bool  `json:"showFeedback"`
+			CategoryID      *uint  `json:"categoryId"` // 成绩册中的成绩类别，0表示未分类
 		}
 
 		if err := c.ShouldBindJSON(&request); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment data"})
 			return
 		}
+		if !validReleasePolicy(request.ReleasePolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid release policy"})
+			return
+		}
 
 		// 只更新允许修改的字段
 		updates := models.ExamAssignment{
@@ -193,12 +250,46 @@ func UpdateAssignment(db *gorm.DB) gin.HandlerFunc {
 			Duration:    request.Duration,
 			PassScore:   request.PassScore,
 			Description: request.Description,
+
+			ReleasePolicy: request.ReleasePolicy,
 		}
 
+		// 显示设置和成绩类别可以改为零值，需要单独更新
+		visibility := map[string]interface{}{}
+		if request.ShowCorrectness != nil {
+			visibility["show_correctness"] = *request.ShowCorrectness
+		}
+		if request.ShowAnswers != nil {
+			visibility["show_answers"] = *request.ShowAnswers
+		}
+		if request.ShowFeedback != nil {
+			visibility["show_feedback"] = *request.ShowFeedback
+		}
+		if request.CategoryID != nil {
+			// 成绩类别必须属于该班级
+			if *request.CategoryID != 0 {
+				if err := db.Where("id = ? AND class_id = ?", *request.CategoryID, assignment.ClassID).
+					First(&models.GradebookCategory{}).Error; err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Category not found"})
+					return
+				}
+			}
+			visibility["category_id"] = *request.CategoryID
+		}
+
+		before := assignment
 		if err := db.Model(&assignment).Updates(updates).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update assignment"})
 			return
 		}
+		if len(visibility) > 0 {
+			if err := db.Model(&assignment).Updates(visibility).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update assignment"})
+				return
+			}
+		}
+		db.First(&assignment, assignment.ID)
+		recordAudit(db, c, models.AuditAssignmentUpdate, "exam_assignment", assignment.ID, before, assignment)
 
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Assignment updated successfully",
@@ -216,10 +307,16 @@ func DeleteAssignment(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 需要对分配的班级有编辑权限
+		if _, ok := requireClassAccess(db, c, assignment.ClassID, accessEdit); !ok {
+			return
+		}
+
 		if err := db.Delete(&assignment).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete assignment"})
 			return
 		}
+		recordAudit(db, c, models.AuditAssignmentDelete, "exam_assignment", assignment.ID, assignment, nil)
 
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Assignment deleted successfully",
@@ -230,8 +327,11 @@ func DeleteAssignment(db *gorm.DB) gin.HandlerFunc {
 // GetClasses 获取班级列表（用于前端选择）
 func GetClasses(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 教师只能看到自己负责或被共享的班级
+		query := db.Model(&models.Class{}).Scopes(classesScope(db, c))
+
 		var classes []models.Class
-		if err := db.Find(&classes).Error; err != nil {
+		if err := query.Find(&classes).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch classes"})
 			return
 		}
@@ -250,6 +350,7 @@ func GetClasses(db *gorm.DB) gin.HandlerFunc {
 				"major":          class.Major,
 				"enrollmentYear": class.EnrollmentYear,
 				"studentCount":   studentCount,
+				"accessLevel":    accessLevelName(classAccess(db, c, class)),
 			})
 		}
 
@@ -281,13 +382,20 @@ func CreateClass(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// 验证教师是否存在（如果提供了teacherId）
-		var teacher *models.User
-		if request.TeacherID != nil && *request.TeacherID > 0 {
-			if err := db.First(&teacher, *request.TeacherID).Error; err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Teacher not found"})
-				return
-			}
+		// 未指定负责教师时默认为创建者，非管理员只能创建自己负责的班级
+		if request.TeacherID == nil || *request.TeacherID == 0 {
+			userID := currentUserID(c)
+			request.TeacherID = &userID
+		} else if *request.TeacherID != currentUserID(c) && !hasGlobalScope(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot create class for another teacher"})
+			return
+		}
+
+		// 验证教师是否存在
+		var teacher models.User
+		if err := db.Where("role = 2").First(&teacher, *request.TeacherID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Teacher not found"})
+			return
 		}
 
 		// 检查班级名称是否已存在
@@ -302,17 +410,14 @@ func CreateClass(db *gorm.DB) gin.HandlerFunc {
 			Description:    request.Description,
 			Major:          request.Major,
 			EnrollmentYear: request.EnrollmentYear,
-		}
-
-		// 只有当teacherId有效时才设置
-		if request.TeacherID != nil && *request.TeacherID > 0 {
-			class.TeacherID = *request.TeacherID
+			TeacherID:      *request.TeacherID,
 		}
 
 		if err := db.Create(&class).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create class"})
 			return
 		}
+		recordAudit(db, c, models.AuditClassCreate, "class", class.ID, nil, class)
 
 		c.JSON(http.StatusCreated, gin.H{
 			"id":             class.ID,
@@ -330,9 +435,8 @@ func CreateClass(db *gorm.DB) gin.HandlerFunc {
 func GetClassDetails(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
-		var class models.Class
-		if err := db.First(&class, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+		class, ok := requireClassAccess(db, c, id, accessView)
+		if !ok {
 			return
 		}
 
@@ -353,6 +457,7 @@ func GetClassDetails(db *gorm.DB) gin.HandlerFunc {
 			"major":          class.Major,
 			"enrollmentYear": class.EnrollmentYear,
 			"studentCount":   studentCount,
+			"accessLevel":    accessLevelName(classAccess(db, c, class)),
 			"createdAt":      class.CreatedAt,
 			"updatedAt":      class.UpdatedAt,
 		}
@@ -365,12 +470,13 @@ func GetClassDetails(db *gorm.DB) gin.HandlerFunc {
 func UpdateClass(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
-		var class models.Class
-		if err := db.First(&class, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+		class, ok := requireClassAccess(db, c, id, accessEdit)
+		if !ok {
 			return
 		}
 
+		before := class
+
 		var request struct {
 			Name        string `json:"name"`
 			Description string `json:"description"`
@@ -396,10 +502,16 @@ func UpdateClass(db *gorm.DB) gin.HandlerFunc {
 			class.Description = request.Description
 		}
 
-		if request.TeacherID != 0 {
+		if request.TeacherID != 0 && request.TeacherID != class.TeacherID {
+			// 只有班级所有者可以移交班级
+			if classAccess(db, c, class) < accessOwner {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Only the class owner can change the teacher"})
+				return
+			}
+
 			// 验证新教师是否存在
 			var teacher models.User
-			if err := db.First(&teacher, request.TeacherID).Error; err != nil {
+			if err := db.Where("role = 2").First(&teacher, request.TeacherID).Error; err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Teacher not found"})
 				return
 			}
@@ -410,6 +522,7 @@ func UpdateClass(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update class"})
 			return
 		}
+		recordAudit(db, c, models.AuditClassUpdate, "class", class.ID, before, class)
 
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Class updated successfully",
@@ -421,9 +534,10 @@ func UpdateClass(db *gorm.DB) gin.HandlerFunc {
 func DeleteClass(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
-		var class models.Class
-		if err := db.First(&class, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+
+		// 只有班级所有者可以删除
+		class, ok := requireClassAccess(db, c, id, accessOwner)
+		if !ok {
 			return
 		}
 
@@ -439,6 +553,11 @@ func DeleteClass(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete class"})
 			return
 		}
+		recordAudit(db, c, models.AuditClassDelete, "class", class.ID, class, nil)
+
+		// 删除共享记录
+		db.Unscoped().Where("resource_type = ? AND resource_id = ?", models.ShareResourceClass, class.ID).
+			Delete(&models.ResourceShare{})
 
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Class deleted successfully",
@@ -451,10 +570,9 @@ func GetClassStudents(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 
-		// 验证班级是否存在
-		var class models.Class
-		if err := db.First(&class, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+		// 验证班级是否存在且可访问
+		class, ok := requireClassAccess(db, c, id, accessView)
+		if !ok {
 			return
 		}
 
@@ -497,9 +615,8 @@ func GetClassStatistics(db *gorm.DB) gin.HandlerFunc {
 
 		// 如果提供了classId，只获取指定班级的统计信息
 		if classId != "" {
-			var class models.Class
-			if err := db.First(&class, classId).Error; err != nil {
-				c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+			class, ok := requireClassAccess(db, c, classId, accessView)
+			if !ok {
 				return
 			}
 
@@ -508,9 +625,11 @@ func GetClassStatistics(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// 否则获取所有班级的统计信息
+		// 否则获取所有可访问班级的统计信息
+		query := db.Model(&models.Class{}).Scopes(classesScope(db, c))
+
 		var classes []models.Class
-		if err := db.Find(&classes).Error; err != nil {
+		if err := query.Find(&classes).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch classes"})
 			return
 		}
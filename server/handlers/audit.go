@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"server/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// recordAudit 记录审计日志，before/after 为修改前后的值（nil 表示不存在）
+func recordAudit(db *gorm.DB, c *gin.Context, action, resourceType string, resourceID uint, before, after interface{}) {
+	entry := models.AuditLog{
+		UserID:       currentUserID(c),
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Before:       auditJSON(before),
+		After:        auditJSON(after),
+		IP:           c.ClientIP(),
+	}
+	if user, exists := c.Get("user"); exists {
+		entry.Username, _ = user.(gin.H)["username"].(string)
+		entry.APIKeyID, _ = user.(gin.H)["apiKeyId"].(uint)
+	}
+
+	if err := db.Create(&entry).Error; err != nil {
+		log.Printf("Failed to record audit log %s %s#%d: %v", action, resourceType, resourceID, err)
+	}
+}
+
+// auditJSON 将审计值序列化为JSON
+func auditJSON(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// auditUser 用户的审计快照（不包含密码等敏感字段）
+func auditUser(user models.User) gin.H {
+	return gin.H{
+		"id":        user.ID,
+		"username":  user.Username,
+		"name":      user.Name,
+		"role":      user.Role,
+		"isAdmin":   user.IsAdmin,
+		"studentId": user.StudentID,
+		"classId":   user.ClassId,
+		"major":     user.Major,
+		"phone":     user.Phone,
+		"status":    user.Status,
+	}
+}
+
+// auditExam 试卷及题目的审计快照
+func auditExam(db *gorm.DB, examID uint) gin.H {
+	var exam models.Exam
+	if err := db.First(&exam, examID).Error; err != nil {
+		return nil
+	}
+
+	var questions []models.Question
+	db.Where("exam_id = ?", examID).Find(&questions)
+
+	return gin.H{
+		"id":          exam.ID,
+		"title":       exam.Title,
+		"description": exam.Description,
+		"duration":    exam.Duration,
+		"totalScore":  exam.TotalScore,
+		"status":      exam.Status,
+		"createdBy":   exam.CreatedBy,
+		"questions":   questions,
+	}
+}
+
+// auditLogQuery 根据查询参数构建审计日志查询
+func auditLogQuery(db *gorm.DB, c *gin.Context) *gorm.DB {
+	query := db.Model(&models.AuditLog{})
+
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if username := c.Query("username"); username != "" {
+		query = query.Where("username LIKE ?", "%"+username+"%")
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if resourceType := c.Query("resource_type"); resourceType != "" {
+		query = query.Where("resource_type = ?", resourceType)
+	}
+	if resourceID := c.Query("resource_id"); resourceID != "" {
+		query = query.Where("resource_id = ?", resourceID)
+	}
+	if startTime := c.Query("start_time"); startTime != "" {
+		if t, err := time.ParseInLocation("2006-01-02", startTime, time.Local); err == nil {
+			query = query.Where("created_at >= ?", t)
+		}
+	}
+	if endTime := c.Query("end_time"); endTime != "" {
+		if t, err := time.ParseInLocation("2006-01-02", endTime, time.Local); err == nil {
+			query = query.Where("created_at < ?", t.AddDate(0, 0, 1))
+		}
+	}
+
+	return query
+}
+
+// GetAuditLogs 查询审计日志
+func GetAuditLogs(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page := 1
+		pageSize := 20
+		if p, err := strconv.Atoi(c.Query("page")); err == nil && p > 0 {
+			page = p
+		}
+		if ps, err := strconv.Atoi(c.Query("page_size")); err == nil && ps > 0 && ps <= 100 {
+			pageSize = ps
+		}
+
+		query := auditLogQuery(db, c)
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count audit logs"})
+			return
+		}
+
+		var logs []models.AuditLog
+		if err := query.Order("id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&logs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit logs"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"total": total,
+			"items": logs,
+		})
+	}
+}
+
+// ExportAuditLogs 导出审计日志，format=csv（默认）或 xlsx
+func ExportAuditLogs(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var logs []models.AuditLog
+		if err := auditLogQuery(db, c).Order("id DESC").Find(&logs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit logs"})
+			return
+		}
+
+		table, ok := startExportAs(c, "audit-logs", "csv", []string{"logs"}, "logs")
+		if !ok {
+			return
+		}
+		table.Sheet("logs", "审计日志")
+		table.Header("ID", "时间", "操作人ID", "操作人", "操作", "资源类型", "资源ID", "修改前", "修改后", "IP", "API密钥ID")
+		for _, entry := range logs {
+			table.Row(entry.ID, entry.CreatedAt, entry.UserID, entry.Username, entry.Action, entry.ResourceType,
+				entry.ResourceID, entry.Before, entry.After, entry.IP, entry.APIKeyID)
+		}
+		if err := table.Close(); err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+// OverrideScore 手动修改考试成绩，需要填写原因并记录审计日志
+func OverrideScore(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Score  *int   `json:"score" binding:"required"`
+			Reason string `json:"reason" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Score and reason are required"})
+			return
+		}
+
+		var result models.ExamResult
+		if err := db.Preload("ExamAssignment.Exam").First(&result, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
+			return
+		}
+
+		// 修改成绩需要对分配的班级或试卷有编辑权限
+		if assignmentAccess(db, c, result.ExamAssignmentID) < accessEdit {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No permission to modify this result"})
+			return
+		}
+
+		if *request.Score < 0 || *request.Score > result.ExamAssignment.Exam.TotalScore {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Score out of range"})
+			return
+		}
+
+		// 修改的是原始成绩，考试安排应用了成绩调整时最终成绩按调整重新计算；
+		// 与各题得分之和的差单独保存，之后修改某道题的得分或重新评分时保留
+		before := gin.H{"score": result.Score, "rawScore": result.RawScore}
+		var score int
+		err := db.Transaction(func(tx *gorm.DB) error {
+			sum, err := answerPointsSum(tx, result.ID)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&models.ExamResult{}).Where("id = ?", result.ID).Update("score_override", *request.Score-sum).Error; err != nil {
+				return err
+			}
+			score, err = setRawScore(tx, result.ID, *request.Score)
+			return err
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update score"})
+			return
+		}
+
+		recordAudit(db, c, models.AuditScoreOverride, "exam_result", result.ID, before, gin.H{
+			"score":    score,
+			"rawScore": *request.Score,
+			"reason":   request.Reason,
+		})
+		go publishLTIScore(db, result.ID)
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":       result.ID,
+			"score":    score,
+			"rawScore": *request.Score,
+			"message":  "Score updated successfully",
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"server/models"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestExportAuditLogs(t *testing.T) {
+	db := newTestDB(t)
+	teacher := seedUser(t, db, models.User{Username: "teacher", Role: 2, Password: "x"})
+	db.Create(&models.AuditLog{UserID: teacher.ID, Username: "teacher", Action: "result.override",
+		ResourceType: "result", ResourceID: 7, After: `{"score":8}`, IP: "127.0.0.1"})
+	// 以公式字符开头的内容不能在 Excel 中执行
+	db.Create(&models.AuditLog{UserID: teacher.ID, Username: "teacher", Action: "student.update",
+		ResourceType: "user", ResourceID: 8, After: `=HYPERLINK("http://evil.example")`, IP: "127.0.0.1"})
+
+	router := gin.New()
+	router.GET("/audit-logs/export", asUser(teacher.ID), ExportAuditLogs(db))
+
+	// 默认仍导出带BOM的CSV
+	w := doRequest(router, http.MethodGet, "/audit-logs/export", nil, "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("status %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 3 || lines[0] != "\xEF\xBB\xBFID,时间,操作人ID,操作人,操作,资源类型,资源ID,修改前,修改后,IP,API密钥ID" {
+		t.Fatalf("unexpected output:\n%s", w.Body.String())
+	}
+	var override, update string
+	for _, line := range lines[1:] {
+		if strings.Contains(line, "result.override") {
+			override = line
+		} else {
+			update = line
+		}
+	}
+	if !strings.HasSuffix(override, `,teacher,result.override,result,7,,"{""score"":8}",127.0.0.1,0`) ||
+		!strings.HasSuffix(update, `,teacher,student.update,user,8,,"'=HYPERLINK(""http://evil.example"")",127.0.0.1,0`) {
+		t.Fatalf("unexpected rows:\n%s", w.Body.String())
+	}
+
+	// 也可以导出为XLSX
+	w = doRequest(router, http.MethodGet, "/audit-logs/export?format=xlsx", nil, "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "PK") ||
+		!strings.HasSuffix(w.Header().Get("Content-Disposition"), ".xlsx") {
+		t.Fatalf("xlsx: status %d, headers %v", w.Code, w.Header())
+	}
+	w = doRequest(router, http.MethodGet, "/audit-logs/export?format=pdf", nil, "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid format: status %d", w.Code)
+	}
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
@@ -11,6 +13,13 @@ import (
 	"server/utils"
 )
 
+// 账号锁定策略：连续失败达到阈值后锁定，之后每次失败锁定时长翻倍
+const (
+	maxFailedLogins  = 5
+	baseLockDuration = time.Minute
+	maxLockDuration  = 24 * time.Hour
+)
+
 func Login(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var loginReq struct {
@@ -24,53 +33,392 @@ func Login(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 用户名+角色唯一，按登录入口确定角色
+		var role byte = 1 // 1: student
+		if loginReq.IsTeacher {
+			role = 2 // 2: teacher
+		}
+
+		// 所有凭据错误返回相同的提示，避免泄露用户名是否存在
 		var user models.User
-		if err := db.Where("username = ?", loginReq.Username).First(&user).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials1"})
+		userErr := db.Where("username = ? AND role = ?", loginReq.Username, role).First(&user).Error
+
+		// 启用LDAP时，目录管理的账号和本地不存在的账号由目录验证密码
+		if utils.LDAP != nil && (userErr != nil || isLDAPUser(db, user.ID)) {
+			ldapLogin(db, c, loginReq.Username, loginReq.Password, role, user, userErr == nil)
 			return
 		}
 
-		// 验证用户角色是否匹配
-		if loginReq.IsTeacher && user.Role == 1 { // 1: student
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials2"})
+		if userErr != nil {
+			models.CheckDummyPassword(loginReq.Password)
+			recordLoginLog(db, c, 0, loginReq.Username, models.LoginReasonUserNotFound)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 			return
 		}
-		if !loginReq.IsTeacher && user.Role != 1 { // 1: student
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials3"})
+
+		// 验证密码（兼容旧版SHA256哈希）；锁定检查放在验证密码之后，响应时间和内容与不存在的用户相同
+		passwordValid := models.CheckPassword(loginReq.Password, user.Password)
+		if rejectLockedPasswordLogin(db, c, user) {
 			return
 		}
-
-		// 使用SHA256验证密码
-		if !models.CheckPassword(loginReq.Password, user.Password) {
+		if !passwordValid {
+			registerLoginFailure(db, c, &user, models.LoginReasonInvalidPassword)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 			return
 		}
 
-		// 记录登录日志
-		loginLog := models.LoginLog{
-			Username:  user.Username,
-			IP:        c.ClientIP(),
-			UserAgent: c.GetHeader("User-Agent"),
-			CreatedAt: time.Now().UTC(),
+		// 旧版哈希在登录成功后透明升级为bcrypt
+		if models.PasswordNeedsRehash(user.Password) {
+			if passwordHash, err := models.HashPassword(loginReq.Password); err == nil {
+				if err := db.Model(&user).Update("password", passwordHash).Error; err != nil {
+					log.Printf("Failed to upgrade password hash for user %d: %v", user.ID, err)
+				}
+			}
 		}
-		db.Create(&loginLog)
 
-		// 生成JWT token
-		token, err := utils.GenerateToken(user.ID, user.Username, user.Role, user.IsAdmin)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		// 已停用的账号不允许登录
+		if rejectDisabledUser(db, c, user) {
+			return
+		}
+
+		completePrimaryLogin(db, c, user)
+	}
+}
+
+// ldapLogin 通过目录验证密码，首次登录的目录账号自动创建本地账号
+func ldapLogin(db *gorm.DB, c *gin.Context, username, password string, role byte, user models.User, exists bool) {
+	entry, err := ldapAuthenticate(username, password, role == 2) // 2: teacher
+	if err != nil && !errors.Is(err, utils.ErrLDAPInvalidCredentials) {
+		log.Printf("LDAP authentication failed for %s: %v", username, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Directory service unavailable"})
+		return
+	}
+	if exists && rejectLockedPasswordLogin(db, c, user) {
+		return
+	}
+	if err != nil {
+		if exists {
+			registerLoginFailure(db, c, &user, models.LoginReasonInvalidPassword)
+		} else {
+			recordLoginLog(db, c, 0, username, models.LoginReasonUserNotFound)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		user, _, err = upsertLDAPUser(tx, entry, 0)
+		return err
+	}); err != nil {
+		if errors.Is(err, errLDAPAccountConflict) || errors.Is(err, errLDAPRoleConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Account already exists, contact an administrator"})
+			return
+		}
+		log.Printf("Failed to provision LDAP user %s: %v", username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create account"})
+		return
+	}
+
+	if rejectDisabledUser(db, c, user) {
+		return
+	}
+
+	completePrimaryLogin(db, c, user)
+}
+
+// accountLocked 账号是否在锁定期间
+func accountLocked(user models.User) bool {
+	return user.LockedUntil != nil && time.Now().Before(*user.LockedUntil)
+}
+
+// rejectLockedUser 账号锁定期间拒绝外部账号登录（已由身份提供方验证身份，可以提示锁定）
+func rejectLockedUser(db *gorm.DB, c *gin.Context, user models.User) bool {
+	if !accountLocked(user) {
+		return false
+	}
+	recordLoginLog(db, c, user.ID, user.Username, models.LoginReasonAccountLocked)
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":      "Account is temporarily locked",
+		"retryAfter": int(time.Until(*user.LockedUntil).Seconds()) + 1,
+	})
+	return true
+}
+
+// rejectLockedPasswordLogin 账号锁定期间拒绝密码登录，返回与密码错误相同的响应，
+// 避免通过锁定提示探测用户名是否存在；锁定期间的失败不再累计
+func rejectLockedPasswordLogin(db *gorm.DB, c *gin.Context, user models.User) bool {
+	if !accountLocked(user) {
+		return false
+	}
+	recordLoginLog(db, c, user.ID, user.Username, models.LoginReasonAccountLocked)
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	return true
+}
+
+// rejectDisabledUser 已停用的账号不允许登录
+func rejectDisabledUser(db *gorm.DB, c *gin.Context, user models.User) bool {
+	if user.Status == 1 {
+		return false
+	}
+	recordLoginLog(db, c, user.ID, user.Username, models.LoginReasonAccountDisabled)
+	c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+	return true
+}
+
+// completePrimaryLogin 密码或外部账号验证通过后，教师账号需要完成两步验证后才签发令牌
+func completePrimaryLogin(db *gorm.DB, c *gin.Context, user models.User) {
+	if user.Role == 2 { // 2: teacher
+		if user.TwoFactorEnabled {
+			respondTwoFactorChallenge(c, user, utils.TokenTypeTwoFactor)
 			return
 		}
+		if getSetting(db, models.SettingRequireTeacher2FA) == "true" {
+			respondTwoFactorChallenge(c, user, utils.TokenTypeTwoFactorSetup)
+			return
+		}
+	}
+
+	completeLogin(db, c, user, nil)
+}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Login successful",
-			"token":   token,
-			"user": gin.H{
-				"id":      user.ID,
-				"name":    user.Name,
-				"role":    user.Role,
-				"isAdmin": user.IsAdmin,
-			},
+// completeLogin 登录验证通过后清除失败计数、记录日志并签发令牌，extra 为附加的响应字段
+func completeLogin(db *gorm.DB, c *gin.Context, user models.User, extra gin.H) {
+	if user.FailedLoginCount > 0 || user.LockedUntil != nil {
+		db.Model(&user).Updates(map[string]interface{}{
+			"failed_login_count": 0,
+			"locked_until":       nil,
 		})
 	}
+
+	// 记录登录日志
+	recordLoginLog(db, c, user.ID, user.Username, "")
+
+	// 创建会话并签发令牌
+	tokens, err := createSession(db, c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	permissions, _ := models.UserPermissions(db, user.ID)
+
+	tokens["message"] = "Login successful"
+	tokens["mustChangePassword"] = user.MustChangePassword
+	tokens["user"] = gin.H{
+		"id":          user.ID,
+		"name":        user.Name,
+		"role":        user.Role,
+		"isAdmin":     user.IsAdmin,
+		"permissions": permissions,
+	}
+	for key, value := range extra {
+		tokens[key] = value
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// registerLoginFailure 记录一次登录失败，连续失败过多时锁定账号
+func registerLoginFailure(db *gorm.DB, c *gin.Context, user *models.User, reason string) {
+	user.FailedLoginCount++
+	updates := map[string]interface{}{"failed_login_count": user.FailedLoginCount}
+
+	if user.FailedLoginCount >= maxFailedLogins {
+		lockDuration := maxLockDuration
+		if shift := user.FailedLoginCount - maxFailedLogins; shift < 16 {
+			lockDuration = baseLockDuration << shift
+			if lockDuration > maxLockDuration {
+				lockDuration = maxLockDuration
+			}
+		}
+		lockedUntil := time.Now().Add(lockDuration)
+		user.LockedUntil = &lockedUntil
+		updates["locked_until"] = &lockedUntil
+	}
+
+	if err := db.Model(user).Updates(updates).Error; err != nil {
+		log.Printf("Failed to update login failures for user %d: %v", user.ID, err)
+	}
+
+	recordLoginLog(db, c, user.ID, user.Username, reason)
+}
+
+// RefreshToken 使用刷新令牌换取新的访问令牌（刷新令牌同时轮换）
+func RefreshToken(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			RefreshToken string `json:"refreshToken" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		var session models.UserSession
+		if err := db.Where("refresh_token_hash = ?", utils.HashToken(request.RefreshToken)).First(&session).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+
+		// 已吊销的刷新令牌被再次使用，可能已泄露，吊销该用户的所有会话
+		if session.RevokedAt != nil {
+			revokeUserSessions(db, session.UserID)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+
+		if time.Now().After(session.ExpiresAt) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token expired"})
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, session.UserID).Error; err != nil || user.Status != 1 {
+			revokeUserSessions(db, session.UserID)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is disabled"})
+			return
+		}
+
+		// 吊销旧会话并创建新会话
+		now := time.Now()
+		if err := db.Model(&session).Update("revoked_at", &now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+			return
+		}
+
+		tokens, err := createSession(db, c, user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// Logout 退出登录，吊销当前会话
+func Logout(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			return
+		}
+
+		userMap := user.(gin.H)
+		sessionID := userMap["sessionId"].(uint)
+
+		now := time.Now()
+		if err := db.Model(&models.UserSession{}).
+			Where("id = ? AND revoked_at IS NULL", sessionID).
+			Update("revoked_at", &now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+			return
+		}
+
+		// 结束模拟登录时记录审计日志
+		if impersonatorID, _ := userMap["impersonatorId"].(uint); impersonatorID != 0 {
+			recordAudit(db, c, models.AuditImpersonateEnd, "user", userMap["id"].(uint), nil, gin.H{
+				"sessionId":      sessionID,
+				"impersonatorId": impersonatorID,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Logout successful"})
+	}
+}
+
+// ChangePassword 修改当前账号的密码，需要验证原密码；修改后吊销该账号的其他会话
+func ChangePassword(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			CurrentPassword string `json:"currentPassword" binding:"required"`
+			NewPassword     string `json:"newPassword" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Current and new password are required"})
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, currentUserID(c)).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		// 外部账号的随机密码不能用于修改密码
+		if user.RandomPassword || !models.CheckPassword(request.CurrentPassword, user.Password) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+		if request.NewPassword == request.CurrentPassword {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "New password must be different"})
+			return
+		}
+		if err := models.ValidatePassword(request.NewPassword); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		passwordHash, err := models.HashPassword(request.NewPassword)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+		if err := db.Model(&user).Updates(map[string]interface{}{
+			"password":             passwordHash,
+			"must_change_password": false,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+			return
+		}
+
+		now := time.Now()
+		db.Model(&models.UserSession{}).
+			Where("user_id = ? AND id <> ? AND revoked_at IS NULL", user.ID, c.MustGet("user").(gin.H)["sessionId"]).
+			Update("revoked_at", &now)
+		recordAudit(db, c, models.AuditPasswordChange, "user", user.ID, nil, nil)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+	}
+}
+
+// createSession 创建登录会话，返回访问令牌和刷新令牌
+func createSession(db *gorm.DB, c *gin.Context, user models.User) (gin.H, error) {
+	refreshToken, refreshTokenHash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := models.UserSession{
+		UserID:           user.ID,
+		RefreshTokenHash: refreshTokenHash,
+		ExpiresAt:        time.Now().Add(utils.RefreshTokenTTL),
+		IP:               c.ClientIP(),
+		UserAgent:        c.GetHeader("User-Agent"),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return nil, err
+	}
+
+	token, err := utils.GenerateToken(user.ID, user.Username, user.Role, user.IsAdmin, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"token":        token,
+		"refreshToken": refreshToken,
+		"expiresIn":    int(utils.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// revokeUserSessions 吊销用户的所有会话（停用、删除账号时调用）
+func revokeUserSessions(db *gorm.DB, userID uint) {
+	now := time.Now()
+	if err := db.Model(&models.UserSession{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", &now).Error; err != nil {
+		log.Printf("Failed to revoke sessions for user %d: %v", userID, err)
+	}
 }
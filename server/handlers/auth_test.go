@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"server/middlewares"
+	"server/models"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLockedAccountLooksLikeUnknownUser(t *testing.T) {
+	db := newTestDB(t)
+	seedUser(t, db, models.User{Username: "alice", Role: 1})
+	router := gin.New()
+	router.POST("/api/auth/login", Login(db))
+
+	login := func(username, password string) (int, string) {
+		w := doRequest(router, http.MethodPost, "/api/auth/login", gin.H{"username": username, "password": password}, "")
+		return w.Code, w.Body.String()
+	}
+
+	for i := 0; i < maxFailedLogins+1; i++ {
+		login("alice", "wrong-password")
+	}
+	var alice models.User
+	db.Where("username = ?", "alice").First(&alice)
+	if !accountLocked(alice) {
+		t.Fatalf("account was not locked after %d failures", maxFailedLogins+1)
+	}
+
+	// 锁定期间无论密码是否正确，响应都与不存在的用户相同
+	unknownCode, unknownBody := login("nobody", "wrong-password")
+	for _, password := range []string{"wrong-password", "local-password"} {
+		if code, body := login("alice", password); code != unknownCode || body != unknownBody {
+			t.Fatalf("locked account responded %d %s, unknown user %d %s", code, body, unknownCode, unknownBody)
+		}
+	}
+
+	// 锁定期间的失败不再延长锁定时间
+	var after models.User
+	db.Where("username = ?", "alice").First(&after)
+	if after.FailedLoginCount != alice.FailedLoginCount || !after.LockedUntil.Equal(*alice.LockedUntil) {
+		t.Fatalf("lock changed while locked: %d %v -> %d %v",
+			alice.FailedLoginCount, alice.LockedUntil, after.FailedLoginCount, after.LockedUntil)
+	}
+}
+
+func TestMustChangePasswordBeforeUsingTheAPI(t *testing.T) {
+	db := newTestDB(t)
+	seedUser(t, db, models.User{Username: "admin", Role: 2, IsAdmin: 1, MustChangePassword: true})
+	router := gin.New()
+	router.POST("/api/auth/login", Login(db))
+	router.PUT("/api/auth/password", middlewares.AuthMiddleware(db), middlewares.RequireUserSession(), ChangePassword(db))
+	router.GET("/api/auth/identities", middlewares.AuthMiddleware(db), GetIdentities(db))
+
+	w := doRequest(router, http.MethodPost, "/api/auth/login", gin.H{"username": "admin", "password": "local-password", "isTeacher": true}, "")
+	var login struct {
+		Token              string `json:"token"`
+		MustChangePassword bool   `json:"mustChangePassword"`
+	}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &login) != nil || !login.MustChangePassword {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := doRequest(router, http.MethodGet, "/api/auth/identities", nil, login.Token); w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403 before changing the password: %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		current, next string
+		code          int
+	}{
+		{"wrong-password", "new-password-1", http.StatusBadRequest},
+		{"local-password", "admin", http.StatusBadRequest},
+		{"local-password", "local-password", http.StatusBadRequest},
+		{"local-password", "new-password-1", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := doRequest(router, http.MethodPut, "/api/auth/password", gin.H{"currentPassword": tt.current, "newPassword": tt.next}, login.Token)
+		if w.Code != tt.code {
+			t.Fatalf("change %q -> %q: status %d, want %d: %s", tt.current, tt.next, w.Code, tt.code, w.Body.String())
+		}
+	}
+
+	if w := doRequest(router, http.MethodGet, "/api/auth/identities", nil, login.Token); w.Code != http.StatusOK {
+		t.Fatalf("status %d after changing the password: %s", w.Code, w.Body.String())
+	}
+}
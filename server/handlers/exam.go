@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"net/http"
+	"reflect"
 	"server/models"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -29,8 +31,8 @@ func GetExams(db *gorm.DB) gin.HandlerFunc {
 			pageSizeNum = ps
 		}
 
-		// 构建查询
-		query := db.Model(&models.Exam{})
+		// 构建查询，教师只能看到自己创建或被共享的试卷
+		query := db.Model(&models.Exam{}).Scopes(examsScope(db, c))
 
 		// 搜索条件
 		if keyword != "" {
@@ -81,6 +83,8 @@ func GetExams(db *gorm.DB) gin.HandlerFunc {
 				"singleChoiceCount": singleChoiceCount,
 				"fillBlankCount":    fillBlankCount,
 				"status":            exam.Status,
+				"createdBy":         exam.CreatedBy,
+				"accessLevel":       accessLevelName(examAccess(db, c, exam)),
 				"createTime":        exam.CreatedAt,
 				"updateTime":        exam.UpdatedAt,
 			})
@@ -107,15 +111,14 @@ func GetExams(db *gorm.DB) gin.HandlerFunc {
 func GetExamDetails(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
-		var exam models.Exam
-		if err := db.First(&exam, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+		exam, ok := requireExamAccess(db, c, id, accessView)
+		if !ok {
 			return
 		}
 
 		// 获取试卷相关问题
 		var questions []models.Question
-		if err := db.Where("exam_id = ?", id).Find(&questions).Error; err != nil {
+		if err := db.Where("exam_id = ?", id).Order("position, id").Find(&questions).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
 			return
 		}
@@ -124,12 +127,14 @@ func GetExamDetails(db *gorm.DB) gin.HandlerFunc {
 		var questionResponses []gin.H
 		for _, question := range questions {
 			questionResponse := gin.H{
-				"id":            question.ID,
-				"type":          question.Type,
-				"content":       question.Content,
-				"score":         question.Score,
-				"correctAnswer": question.Answer,
-				"placeholder":   question.Placeholder,
+				"id":             question.ID,
+				"type":           question.Type,
+				"content":        question.Content,
+				"score":          question.Score,
+				"correctAnswer":  question.Answer,
+				"placeholder":    question.Placeholder,
+				"penaltyPercent": question.PenaltyPercent,
+				"tags":           question.Tags,
 			}
 
 			// 根据题目类型添加特定字段
@@ -150,6 +155,9 @@ func GetExamDetails(db *gorm.DB) gin.HandlerFunc {
 			"description": exam.Description,
 			"totalScore":  exam.TotalScore,
 			"status":      exam.Status,
+			"createdBy":   exam.CreatedBy,
+			"floorAtZero": exam.FloorAtZero,
+			"accessLevel": accessLevelName(examAccess(db, c, exam)),
 			"questions":   questionResponses,
 		}
 		c.JSON(http.StatusOK, response)
@@ -169,6 +177,21 @@ func CreateExam(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 试卷归属于创建者
+		request.Exam.CreatedBy = currentUserID(c)
+
+		// 检查倒扣分比例和填空题的判分规则
+		for _, question := range request.Questions {
+			if question.PenaltyPercent < 0 || question.PenaltyPercent > 100 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Penalty percent must be between 0 and 100"})
+				return
+			}
+			if err := validateBlanks(question); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fill-in answers: " + err.Error()})
+				return
+			}
+		}
+
 		// 开始事务
 		tx := db.Begin()
 
@@ -180,8 +203,10 @@ func CreateExam(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// 创建问题
-		for _, item := range request.Questions {
+		for i, item := range request.Questions {
 			item.ExamID = request.Exam.ID
+			item.Position = i
+			item.Tags = normalizeTags(item.Tags)
 			// 处理填空题的详细配置
 			if item.Type == "fill" && len(item.Answers) == 0 {
 				tx.Rollback()
@@ -196,6 +221,8 @@ func CreateExam(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		tx.Commit()
+		recordAudit(db, c, models.AuditExamCreate, "exam", request.Exam.ID, nil, auditExam(db, request.Exam.ID))
+
 		c.JSON(http.StatusCreated, gin.H{
 			"exam":      request.Exam,
 			"questions": request.Questions,
@@ -218,47 +245,126 @@ func UpdateExam(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var existingExam models.Exam
-		if err := db.First(&existingExam, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+		existingExam, ok := requireExamAccess(db, c, id, accessEdit)
+		if !ok {
 			return
 		}
 
+		// 试卷归属不能通过编辑修改
+		request.Exam.CreatedBy = 0
+
+		// 检查倒扣分比例和填空题的判分规则
+		for _, question := range request.Questions {
+			if question.PenaltyPercent < 0 || question.PenaltyPercent > 100 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Penalty percent must be between 0 and 100"})
+				return
+			}
+			if err := validateBlanks(question); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fill-in answers: " + err.Error()})
+				return
+			}
+		}
+
+		// 记录修改前的试卷和题目
+		before := auditExam(db, existingExam.ID)
+
 		// 开始事务
 		tx := db.Begin()
 
-		// 更新试卷
+		// 更新试卷（Updates 忽略零值，总分是否最低为0单独保存）
+		floorChanged := existingExam.FloorAtZero != request.Exam.FloorAtZero
 		if err := tx.Model(&existingExam).Updates(request.Exam).Error; err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update exam"})
 			return
 		}
-
-		// 删除旧问题
-		if err := tx.Where("exam_id = ?", id).Delete(&models.Question{}).Error; err != nil {
+		if err := tx.Model(&existingExam).Update("floor_at_zero", request.Exam.FloorAtZero).Error; err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete old questions"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update exam"})
 			return
 		}
 
-		// 创建新问题
+		// 保留已有题目的ID（答卷中的作答记录按题目ID关联），删除不再包含的题目
+		var existingQuestions []models.Question
+		tx.Where("exam_id = ?", existingExam.ID).Find(&existingQuestions)
+		previous := make(map[uint]models.Question, len(existingQuestions))
+		for _, question := range existingQuestions {
+			previous[question.ID] = question
+		}
+
+		scoringChanged := floorChanged
+		kept := map[uint]bool{}
 		for i := range request.Questions {
-			request.Questions[i].ExamID = existingExam.ID
-			// 确保填空题字段有默认值
-			if err := tx.Create(&request.Questions[i]).Error; err != nil {
+			question := &request.Questions[i]
+			question.ExamID = existingExam.ID
+			question.Position = i
+			question.Tags = normalizeTags(question.Tags)
+
+			old, exists := previous[question.ID]
+			if exists && !kept[question.ID] {
+				kept[question.ID] = true
+				question.CreatedAt = old.CreatedAt
+				scoringChanged = scoringChanged || questionScoringChanged(old, *question)
+				if err := tx.Save(question).Error; err != nil {
+					tx.Rollback()
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update questions"})
+					return
+				}
+				continue
+			}
+
+			question.ID = 0
+			scoringChanged = true
+			if err := tx.Create(question).Error; err != nil {
 				tx.Rollback()
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create questions"})
 				return
 			}
 		}
 
+		for _, question := range existingQuestions {
+			if kept[question.ID] {
+				continue
+			}
+			scoringChanged = true
+			if err := tx.Delete(&question).Error; err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete old questions"})
+				return
+			}
+		}
+
 		tx.Commit()
+		recordAudit(db, c, models.AuditExamUpdate, "exam", existingExam.ID, before, auditExam(db, existingExam.ID))
+
+		// 已有答卷时，计分方式变化需要重新评分（先预览再确认）
+		var submitted int64
+		if scoringChanged {
+			db.Model(&models.ExamResult{}).Where("exam_assignment_id IN (?)",
+				db.Model(&models.ExamAssignment{}).Select("id").Where("exam_id = ?", existingExam.ID)).
+				Count(&submitted)
+		}
+
 		c.JSON(http.StatusOK, gin.H{
-			"message": "Exam updated successfully",
+			"message":         "Exam updated successfully",
+			"regradeRequired": submitted > 0,
 		})
 	}
 }
 
+// questionScoringChanged 题目的题型、分值或答案是否发生变化
+func questionScoringChanged(old, updated models.Question) bool {
+	if old.Type != updated.Type || old.Score != updated.Score || old.Answer != updated.Answer ||
+		old.PenaltyPercent != updated.PenaltyPercent {
+		return true
+	}
+	// 空列表和未设置视为相同
+	if len(old.Answers) == 0 && len(updated.Answers) == 0 {
+		return false
+	}
+	return !reflect.DeepEqual(old.Answers, updated.Answers)
+}
+
 // UpdateExamStatus 更新试卷状态
 func UpdateExamStatus(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -272,17 +378,18 @@ func UpdateExamStatus(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var exam models.Exam
-		if err := db.First(&exam, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+		exam, ok := requireExamAccess(db, c, id, accessEdit)
+		if !ok {
 			return
 		}
 
 		// 更新试卷状态
+		oldStatus := exam.Status
 		if err := db.Model(&exam).Update("status", request.Status).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update exam status"})
 			return
 		}
+		recordAudit(db, c, models.AuditExamStatus, "exam", exam.ID, gin.H{"status": oldStatus}, gin.H{"status": request.Status})
 
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -300,12 +407,15 @@ func UpdateExamStatus(db *gorm.DB) gin.HandlerFunc {
 func DeleteExam(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
-		var exam models.Exam
-		if err := db.First(&exam, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+
+		// 只有试卷所有者可以删除
+		exam, ok := requireExamAccess(db, c, id, accessOwner)
+		if !ok {
 			return
 		}
 
+		before := auditExam(db, exam.ID)
+
 		// 开始事务
 		tx := db.Begin()
 
@@ -316,6 +426,14 @@ func DeleteExam(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 删除共享记录
+		if err := tx.Where("resource_type = ? AND resource_id = ?", models.ShareResourceExam, exam.ID).
+			Unscoped().Delete(&models.ResourceShare{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete exam shares"})
+			return
+		}
+
 		// 删除试卷
 		if err := tx.Delete(&exam).Error; err != nil {
 			tx.Rollback()
@@ -324,8 +442,25 @@ func DeleteExam(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		tx.Commit()
+		recordAudit(db, c, models.AuditExamDelete, "exam", exam.ID, before, nil)
+
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Exam deleted successfully",
 		})
 	}
 }
+
+// normalizeTags 去掉知识点标签首尾空格、空标签和重复标签
+func normalizeTags(tags models.StringList) models.StringList {
+	normalized := models.StringList{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
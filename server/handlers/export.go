@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"net/http"
+	"server/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tableWriter 导出表格，同一份导出代码可以生成 XLSX（多个工作表）或 CSV（只输出选中的一个工作表）
+type tableWriter interface {
+	// Sheet 开始一个工作表，key 用于 CSV 选择工作表，name 为 XLSX 中显示的名称
+	Sheet(key, name string)
+	Header(cells ...string)
+	Row(cells ...interface{})
+	Close() error
+}
+
+// xlsxTable 输出为 .xlsx 文件
+type xlsxTable struct {
+	writer *utils.XLSXWriter
+}
+
+func (t *xlsxTable) Sheet(key, name string)   { t.writer.AddSheet(name) }
+func (t *xlsxTable) Header(cells ...string)   { t.writer.WriteHeader(cells...) }
+func (t *xlsxTable) Row(cells ...interface{}) { t.writer.WriteRow(cells...) }
+func (t *xlsxTable) Close() error             { return t.writer.Close() }
+
+// csvTable 输出为 CSV，只写入 key 为 sheet 的工作表
+type csvTable struct {
+	writer  *csv.Writer
+	sheet   string
+	current string
+}
+
+func (t *csvTable) Sheet(key, name string) { t.current = key }
+
+func (t *csvTable) Header(cells ...string) {
+	if t.current != t.sheet {
+		return
+	}
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		record[i] = csvText(cell)
+	}
+	t.writer.Write(record)
+}
+
+func (t *csvTable) Row(cells ...interface{}) {
+	if t.current != t.sheet {
+		return
+	}
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		record[i] = csvCell(cell)
+	}
+	t.writer.Write(record)
+}
+
+func (t *csvTable) Close() error {
+	t.writer.Flush()
+	return t.writer.Error()
+}
+
+// csvCell 单元格的文本，与 XLSX 的写法一致
+func csvCell(cell interface{}) string {
+	switch value := cell.(type) {
+	case nil:
+		return ""
+	case float64:
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return ""
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case time.Time:
+		return value.Format("2006-01-02 15:04:05")
+	case string:
+		return csvText(value)
+	}
+	return fmt.Sprint(cell)
+}
+
+// csvText 以公式字符开头的文本前加单引号，避免学生姓名、答案等内容在 Excel 中作为公式执行
+func csvText(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// startExport 按查询参数 format（xlsx 默认，或 csv）开始下载，设置文件名并返回表格写入器
+//
+// CSV 只能包含一个工作表，由查询参数 sheet 选择，默认为 defaultSheet
+func startExport(c *gin.Context, basename string, sheets []string, defaultSheet string) (tableWriter, bool) {
+	return startExportAs(c, basename, "xlsx", sheets, defaultSheet)
+}
+
+// startExportAs 与 startExport 相同，但未指定 format 时使用 defaultFormat，供原来只导出 CSV 的接口保持默认格式
+func startExportAs(c *gin.Context, basename, defaultFormat string, sheets []string, defaultSheet string) (tableWriter, bool) {
+	format := c.DefaultQuery("format", defaultFormat)
+	if format != "xlsx" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export format"})
+		return nil, false
+	}
+	sheet := c.DefaultQuery("sheet", defaultSheet)
+	if format == "csv" && !containsString(sheets, sheet) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sheet"})
+		return nil, false
+	}
+
+	filename := fmt.Sprintf("%s-%s", basename, time.Now().Format("20060102150405"))
+	if format == "csv" {
+		if len(sheets) > 1 {
+			filename += "-" + sheet
+		}
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", "attachment; filename="+filename+".csv")
+
+		// 写入BOM，避免Excel打开中文乱码
+		c.Writer.WriteString("\xEF\xBB\xBF")
+		return &csvTable{writer: csv.NewWriter(c.Writer), sheet: sheet}, true
+	}
+
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Header("Content-Disposition", "attachment; filename="+filename+".xlsx")
+	c.Status(http.StatusOK)
+	return &xlsxTable{writer: utils.NewXLSXWriter(c.Writer)}, true
+}
+
+// containsString 列表中是否包含指定字符串
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"server/models"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestExportGradebook(t *testing.T) {
+	db := newTestDB(t)
+	teacher := seedUser(t, db, models.User{Username: "teacher", Role: 2, Password: "x"})
+	exam := models.Exam{Title: "Quiz", TotalScore: 20, Status: "published", CreatedBy: teacher.ID}
+	db.Create(&exam)
+	class := models.Class{Name: "Class", Major: "CS", TeacherID: teacher.ID}
+	db.Create(&class)
+	first := seedUser(t, db, models.User{Username: "s1", Name: "张三", StudentID: "001", Role: 1, Password: "x", ClassId: int(class.ID)})
+	second := seedUser(t, db, models.User{Username: "s2", Name: "李四", StudentID: "002", Role: 1, Password: "x", ClassId: int(class.ID)})
+
+	// 测验去掉最低的一次
+	quizzes := models.GradebookCategory{ClassID: class.ID, Name: "测验", Weight: 60, DropLowest: 1}
+	final := models.GradebookCategory{ClassID: class.ID, Name: "期末", Weight: 40}
+	db.Create(&quizzes)
+	db.Create(&final)
+
+	var assignments []models.ExamAssignment
+	for i, day := range []string{"01", "08", "15"} {
+		categoryID := quizzes.ID
+		if i == 2 {
+			categoryID = final.ID
+		}
+		assignment := models.ExamAssignment{ExamID: exam.ID, ClassID: class.ID, StartTime: "2026-01-" + day + " 00:00:00",
+			EndTime: "2026-01-" + day + " 23:00:00", Duration: 60, CategoryID: categoryID}
+		db.Create(&assignment)
+		assignments = append(assignments, assignment)
+	}
+	for _, result := range []models.ExamResult{
+		{ExamAssignmentID: assignments[0].ID, StudentID: first.ID, Score: 5},
+		{ExamAssignmentID: assignments[1].ID, StudentID: first.ID, Score: 15},
+		{ExamAssignmentID: assignments[2].ID, StudentID: first.ID, Score: 18},
+		{ExamAssignmentID: assignments[0].ID, StudentID: second.ID, Score: 16},
+	} {
+		result.RawScore = result.Score
+		result.Answers = "[]"
+		db.Create(&result)
+	}
+	// 第二个学生免考第二次测验，期末考试已结束且没有提交
+	db.Create(&models.GradebookExcusal{ExamAssignmentID: assignments[1].ID, StudentID: second.ID, Reason: "病假", CreatedBy: teacher.ID})
+
+	router := gin.New()
+	router.GET("/classes/:id/gradebook/export", asUser(teacher.ID), ExportGradebook(db))
+	target := "/classes/" + strconv.FormatUint(uint64(class.ID), 10) + "/gradebook/export"
+
+	// 默认仍导出带BOM的CSV
+	w := doRequest(router, http.MethodGet, target, nil, "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("status %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	want := []string{
+		"\xEF\xBB\xBF学号,姓名,测验/Quiz 2026-01-01（20分）,测验/Quiz 2026-01-08（20分）,期末/Quiz 2026-01-15（20分）,测验（60%）,期末（40%）,总评,等级,绩点",
+		// 25% 的测验被去掉，测验得分率 75%，总评 75×0.6+90×0.4
+		"001,张三,5（不计）,15,18,75,90,81,,",
+		// 免考不计入测验，缺考按0分计入期末
+		"002,李四,16,免考,缺考,80,0,48,,",
+	}
+	if got := strings.Split(strings.TrimSpace(w.Body.String()), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected output:\n%s", w.Body.String())
+	}
+
+	// 也可以导出为XLSX
+	w = doRequest(router, http.MethodGet, target+"?format=xlsx", nil, "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "PK") ||
+		!strings.HasSuffix(w.Header().Get("Content-Disposition"), ".xlsx") {
+		t.Fatalf("xlsx: status %d, headers %v", w.Code, w.Header())
+	}
+}
+
+func TestCSVCellEscapesFormulas(t *testing.T) {
+	tests := []struct {
+		cell interface{}
+		want string
+	}{
+		{`=HYPERLINK("http://evil.example","click")`, `'=HYPERLINK("http://evil.example","click")`},
+		{"+1+1", "'+1+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"\rcmd", "'\rcmd"},
+		{"张三", "张三"},
+		{"a=b", "a=b"},
+		{"", ""},
+		// 数值不是文本，负数不加引号
+		{-5, "-5"},
+		{-1.5, "-1.5"},
+	}
+	for _, tt := range tests {
+		if got := csvCell(tt.cell); got != tt.want {
+			t.Errorf("csvCell(%q) = %q, want %q", tt.cell, got, tt.want)
+		}
+	}
+}
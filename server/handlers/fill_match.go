@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"server/models"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// blankRegexps 已编译的答案正则表达式
+var blankRegexps sync.Map
+
+// matchBlanks 判断填空题每个空是否答对，多余的答案忽略
+//
+// 设置了相同 Group 的空不区分顺序：每个答案可以匹配组内任意一个空，但每个空、每个相同的答案只计一次
+func matchBlanks(blanks models.Answers, values []string) []bool {
+	correct := make([]bool, len(blanks))
+	value := func(k int) string {
+		if k < len(values) {
+			return values[k]
+		}
+		return ""
+	}
+
+	groups := map[string][]int{}
+	for k, blank := range blanks {
+		if blank.Group == "" {
+			correct[k] = matchBlank(blank, value(k))
+			continue
+		}
+		groups[blank.Group] = append(groups[blank.Group], k)
+	}
+
+	for _, members := range groups {
+		// 二分图匹配：答案（按位置）匹配到组内的空
+		owner := make(map[int]int, len(members)) // 空 -> 答案位置
+		seen := map[string]bool{}
+		for _, k := range members {
+			v := value(k)
+			key := blankKey(blanks[members[0]], v)
+			if key == "" || seen[key] {
+				continue
+			}
+			visited := map[int]bool{}
+			if assignBlank(blanks, members, owner, visited, k, v, value) {
+				seen[key] = true
+			}
+		}
+		for _, k := range owner {
+			correct[k] = true
+		}
+	}
+	return correct
+}
+
+// blankKey 判断组内答案是否重复时使用的值
+func blankKey(blank models.Blank, value string) string {
+	if strings.TrimSpace(value) == "" {
+		return ""
+	}
+	if blank.Type == "number" {
+		if number, ok := parseNumber(value); ok {
+			return strconv.FormatFloat(number, 'g', -1, 64)
+		}
+	}
+	return normalizeBlank(blank, value)
+}
+
+// assignBlank 为位置 pos 的答案寻找可匹配的空，必要时调整已匹配的答案（增广路径）
+func assignBlank(blanks models.Answers, members []int, owner map[int]int, visited map[int]bool, pos int, v string, value func(int) string) bool {
+	for _, k := range members {
+		if visited[k] || !matchBlank(blanks[k], v) {
+			continue
+		}
+		visited[k] = true
+		previous, taken := owner[k]
+		if !taken || assignBlank(blanks, members, owner, visited, previous, value(previous), value) {
+			owner[k] = pos
+			return true
+		}
+	}
+	return false
+}
+
+// matchBlank 按判分规则判断某个空的答案是否正确
+func matchBlank(blank models.Blank, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		return false
+	}
+
+	if blank.Type == "number" {
+		if number, ok := parseNumber(value); ok {
+			for _, option := range blank.Options {
+				if expected, ok := parseNumber(option); ok && math.Abs(number-expected) <= blank.Tolerance+1e-9 {
+					return true
+				}
+			}
+		}
+	}
+
+	normalized := normalizeBlank(blank, value)
+	for _, option := range blank.Options {
+		if blank.Regex {
+			if re := blankRegexp(blank, option); re != nil && re.MatchString(normalized) {
+				return true
+			}
+			continue
+		}
+		if option != "" && normalized == normalizeBlank(blank, option) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeBlank 按判分规则规范化答案
+func normalizeBlank(blank models.Blank, value string) string {
+	if blank.NormalizeWidth {
+		value = toHalfWidth(value)
+	}
+	if blank.IgnorePunctuation {
+		value = strings.Map(func(r rune) rune {
+			if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+				return -1
+			}
+			return r
+		}, value)
+	}
+	if blank.NormalizeSpace {
+		value = strings.Join(strings.Fields(value), " ")
+	}
+	if blank.IgnoreCase {
+		value = strings.ToLower(value)
+	}
+	return value
+}
+
+// toHalfWidth 全角字符转换为半角
+func toHalfWidth(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '　':
+			return ' '
+		case r >= '！' && r <= '～':
+			return r - 0xFEE0
+		}
+		return r
+	}, value)
+}
+
+// parseNumber 解析数值答案，支持全角数字、千分位、分数（如 1/2）和百分数
+func parseNumber(value string) (float64, bool) {
+	value = strings.ReplaceAll(strings.TrimSpace(toHalfWidth(value)), ",", "")
+	if value == "" {
+		return 0, false
+	}
+	if strings.HasSuffix(value, "%") {
+		number, ok := parseNumber(strings.TrimSuffix(value, "%"))
+		return number / 100, ok
+	}
+	if parts := strings.Split(value, "/"); len(parts) == 2 {
+		numerator, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		denominator, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err1 != nil || err2 != nil || denominator == 0 {
+			return 0, false
+		}
+		return numerator / denominator, true
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, false
+	}
+	return number, true
+}
+
+// blankRegexp 编译答案正则表达式（完整匹配，忽略大小写时不区分大小写），无效时返回 nil
+func blankRegexp(blank models.Blank, pattern string) *regexp.Regexp {
+	expr := "^(?:" + pattern + ")$"
+	if blank.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	if cached, ok := blankRegexps.Load(expr); ok {
+		re, _ := cached.(*regexp.Regexp)
+		return re
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		re = nil
+	}
+	blankRegexps.Store(expr, re)
+	return re
+}
+
+// validateBlanks 检查填空题的判分规则，返回错误说明
+func validateBlanks(question models.Question) error {
+	for k, blank := range question.Answers {
+		if blank.Tolerance < 0 {
+			return fmt.Errorf("blank %d: tolerance must not be negative", k+1)
+		}
+		for _, option := range blank.Options {
+			if blank.Regex {
+				if _, err := regexp.Compile(option); err != nil {
+					return fmt.Errorf("blank %d: invalid regular expression %q", k+1, option)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,620 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"server/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 成绩册单元格状态
+const (
+	gradebookGraded  = "graded"  // 已提交
+	gradebookMissing = "missing" // 考试已结束但未提交，按0分计
+	gradebookExcused = "excused" // 免考，不计入总评
+	gradebookPending = "pending" // 考试未结束且未提交，暂不计入
+)
+
+// gradebookColumn 成绩册的一列（班级的一次考试安排）
+type gradebookColumn struct {
+	AssignmentID uint   `json:"assignmentId"`
+	ExamTitle    string `json:"examTitle"`
+	TotalScore   int    `json:"totalScore"`
+	CategoryID   uint   `json:"categoryId"`
+	StartTime    string `json:"startTime"`
+	EndTime      string `json:"endTime"`
+	Closed       bool   `json:"closed"`
+}
+
+// gradebookCell 学生某次考试的成绩
+type gradebookCell struct {
+	AssignmentID uint     `json:"assignmentId"`
+	ResultID     uint     `json:"resultId,omitempty"`
+	Score        *int     `json:"score"`
+	Percent      *float64 `json:"percent"`
+	Status       string   `json:"status"`
+	Dropped      bool     `json:"dropped"` // 被“去掉最低成绩”规则排除
+	Reason       string   `json:"reason,omitempty"`
+}
+
+// gradebookCategoryScore 学生某个成绩类别的得分率
+type gradebookCategoryScore struct {
+	CategoryID uint     `json:"categoryId"`
+	Percent    *float64 `json:"percent"`
+}
+
+// gradebookRow 成绩册的一行（一个学生）
+type gradebookRow struct {
+	StudentID  uint                     `json:"studentId"`
+	StudentNo  string                   `json:"studentNo"`
+	Name       string                   `json:"name"`
+	Cells      []gradebookCell          `json:"cells"`
+	Categories []gradebookCategoryScore `json:"categories"`
+	Total      *float64                 `json:"total"` // 加权总评（百分制）
+	Grade      string                   `json:"grade"`
+	GradePoint *float64                 `json:"gradePoint"`
+}
+
+// gradebook 班级成绩册
+type gradebook struct {
+	ClassID    uint                       `json:"classId"`
+	ClassName  string                     `json:"className"`
+	Categories []models.GradebookCategory `json:"categories"`
+	GradeScale *models.GradeScale         `json:"gradeScale"`
+	Columns    []gradebookColumn          `json:"columns"`
+	Rows       []gradebookRow             `json:"rows"`
+}
+
+// roundPercent 百分比保留两位小数
+func roundPercent(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// buildGradebook 计算班级成绩册
+//
+// 每次考试取学生最后一次提交的成绩，按得分率计算。各类别的得分率为未被去掉的成绩的平均值，
+// 总评按类别权重加权（只计有成绩的类别，权重按比例放大）；没有设置类别时总评为所有考试得分率的平均值，
+// 设置了类别时未分类的考试不计入总评
+func buildGradebook(db *gorm.DB, class models.Class) (gradebook, error) {
+	book := gradebook{ClassID: class.ID, ClassName: class.Name}
+
+	if err := db.Where("class_id = ?", class.ID).Order("position, id").Find(&book.Categories).Error; err != nil {
+		return book, err
+	}
+	categoryIndex := make(map[uint]int, len(book.Categories))
+	for i, category := range book.Categories {
+		categoryIndex[category.ID] = i
+	}
+
+	var setting models.GradebookSetting
+	if db.First(&setting, class.ID).Error == nil && setting.GradeScaleID != 0 {
+		var scale models.GradeScale
+		if db.First(&scale, setting.GradeScaleID).Error == nil {
+			book.GradeScale = &scale
+		}
+	}
+
+	var assignments []models.ExamAssignment
+	if err := db.Preload("Exam").Where("class_id = ?", class.ID).Order("start_time, id").Find(&assignments).Error; err != nil {
+		return book, err
+	}
+	assignmentIDs := make([]uint, len(assignments))
+	for i, assignment := range assignments {
+		assignmentIDs[i] = assignment.ID
+		categoryID := assignment.CategoryID
+		if _, ok := categoryIndex[categoryID]; !ok {
+			categoryID = 0
+		}
+		book.Columns = append(book.Columns, gradebookColumn{
+			AssignmentID: assignment.ID,
+			ExamTitle:    assignment.Exam.Title,
+			TotalScore:   assignment.Exam.TotalScore,
+			CategoryID:   categoryID,
+			StartTime:    assignment.StartTime,
+			EndTime:      assignment.EndTime,
+			Closed:       getExamStatus(assignment.StartTime, assignment.EndTime) == "已结束",
+		})
+	}
+
+	var students []models.User
+	if err := db.Where("class_id = ? AND role = 1", class.ID).Order("student_id, id").Find(&students).Error; err != nil { // 1: student
+		return book, err
+	}
+
+	// 每个学生每次考试取最后一次提交
+	var results []models.ExamResult
+	if err := db.Where("exam_assignment_id IN ?", assignmentIDs).Order("id").Find(&results).Error; err != nil {
+		return book, err
+	}
+	latest := map[[2]uint]models.ExamResult{}
+	for _, result := range results {
+		latest[[2]uint{result.StudentID, result.ExamAssignmentID}] = result
+	}
+
+	var excusals []models.GradebookExcusal
+	if err := db.Where("exam_assignment_id IN ?", assignmentIDs).Find(&excusals).Error; err != nil {
+		return book, err
+	}
+	excused := map[[2]uint]models.GradebookExcusal{}
+	for _, excusal := range excusals {
+		excused[[2]uint{excusal.StudentID, excusal.ExamAssignmentID}] = excusal
+	}
+
+	for _, student := range students {
+		row := gradebookRow{StudentID: student.ID, StudentNo: student.StudentID, Name: student.Name}
+		for _, column := range book.Columns {
+			key := [2]uint{student.ID, column.AssignmentID}
+			cell := gradebookCell{AssignmentID: column.AssignmentID, Status: gradebookPending}
+			if result, ok := latest[key]; ok {
+				score := result.Score
+				percent := roundPercent(scorePercent(result.Score, column.TotalScore))
+				cell.ResultID = result.ID
+				cell.Score = &score
+				cell.Percent = &percent
+				cell.Status = gradebookGraded
+			} else if column.Closed {
+				percent := 0.0
+				cell.Percent = &percent
+				cell.Status = gradebookMissing
+			}
+			if excusal, ok := excused[key]; ok {
+				cell.Status = gradebookExcused
+				cell.Reason = excusal.Reason
+			}
+			row.Cells = append(row.Cells, cell)
+		}
+
+		// 按类别分组计入总评的成绩（未设置类别时所有考试为一组）
+		groups := map[uint][]int{}
+		for i, cell := range row.Cells {
+			if cell.Status != gradebookGraded && cell.Status != gradebookMissing {
+				continue
+			}
+			categoryID := book.Columns[i].CategoryID
+			if len(book.Categories) > 0 && categoryID == 0 {
+				continue
+			}
+			groups[categoryID] = append(groups[categoryID], i)
+		}
+
+		if len(book.Categories) == 0 {
+			row.Total = averageCells(row.Cells, groups[0])
+		} else {
+			weighted, weights := 0.0, 0.0
+			for _, category := range book.Categories {
+				members := groups[category.ID]
+				dropLowest(row.Cells, members, category.DropLowest)
+				percent := averageCells(row.Cells, members)
+				row.Categories = append(row.Categories, gradebookCategoryScore{CategoryID: category.ID, Percent: percent})
+				if percent != nil && category.Weight > 0 {
+					weighted += *percent * category.Weight
+					weights += category.Weight
+				}
+			}
+			if weights > 0 {
+				total := roundPercent(weighted / weights)
+				row.Total = &total
+			}
+		}
+
+		if row.Total != nil && book.GradeScale != nil {
+			row.Grade, row.GradePoint = gradeForPercent(book.GradeScale.Bands, *row.Total)
+		}
+		book.Rows = append(book.Rows, row)
+	}
+
+	if book.Columns == nil {
+		book.Columns = []gradebookColumn{}
+	}
+	if book.Rows == nil {
+		book.Rows = []gradebookRow{}
+	}
+	return book, nil
+}
+
+// dropLowest 将一组成绩中最低的 n 次标记为去掉（至少保留一次）
+func dropLowest(cells []gradebookCell, members []int, n int) {
+	if n <= 0 || len(members) <= 1 {
+		return
+	}
+	if n > len(members)-1 {
+		n = len(members) - 1
+	}
+	sorted := append([]int(nil), members...)
+	sort.SliceStable(sorted, func(i, j int) bool { return *cells[sorted[i]].Percent < *cells[sorted[j]].Percent })
+	for _, i := range sorted[:n] {
+		cells[i].Dropped = true
+	}
+}
+
+// averageCells 一组成绩中未被去掉的得分率的平均值，没有成绩时返回 nil
+func averageCells(cells []gradebookCell, members []int) *float64 {
+	sum, count := 0.0, 0
+	for _, i := range members {
+		if cells[i].Dropped {
+			continue
+		}
+		sum += *cells[i].Percent
+		count++
+	}
+	if count == 0 {
+		return nil
+	}
+	average := roundPercent(sum / float64(count))
+	return &average
+}
+
+// GetGradebook 获取班级成绩册：每行一个学生，每列一次考试，包含各类别得分率、加权总评和等级
+func GetGradebook(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := requireClassAccess(db, c, c.Param("id"), accessView)
+		if !ok {
+			return
+		}
+
+		book, err := buildGradebook(db, class)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build gradebook"})
+			return
+		}
+		c.JSON(http.StatusOK, book)
+	}
+}
+
+// ExportGradebook 导出班级成绩册，format=csv（默认）或 xlsx
+func ExportGradebook(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := requireClassAccess(db, c, c.Param("id"), accessView)
+		if !ok {
+			return
+		}
+
+		book, err := buildGradebook(db, class)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build gradebook"})
+			return
+		}
+
+		categoryNames := map[uint]string{}
+		for _, category := range book.Categories {
+			categoryNames[category.ID] = category.Name
+		}
+
+		table, ok := startExportAs(c, fmt.Sprintf("gradebook-%d", class.ID), "csv", []string{"gradebook"}, "gradebook")
+		if !ok {
+			return
+		}
+
+		header := []string{"学号", "姓名"}
+		for _, column := range book.Columns {
+			// 同一试卷可能分配多次，标题中加上开始日期
+			date := column.StartTime
+			if len(date) > 10 {
+				date = date[:10]
+			}
+			title := fmt.Sprintf("%s %s（%d分）", column.ExamTitle, date, column.TotalScore)
+			if name := categoryNames[column.CategoryID]; name != "" {
+				title = name + "/" + title
+			}
+			header = append(header, title)
+		}
+		for _, category := range book.Categories {
+			header = append(header, fmt.Sprintf("%s（%s%%）", category.Name, formatPercent(category.Weight)))
+		}
+		header = append(header, "总评", "等级", "绩点")
+		table.Sheet("gradebook", "成绩册")
+		table.Header(header...)
+
+		for _, row := range book.Rows {
+			record := []interface{}{row.StudentNo, row.Name}
+			for _, cell := range row.Cells {
+				record = append(record, gradebookCellValue(cell))
+			}
+			for _, category := range row.Categories {
+				record = append(record, optionalNumber(category.Percent))
+			}
+			record = append(record, optionalNumber(row.Total), row.Grade, optionalNumber(row.GradePoint))
+			table.Row(record...)
+		}
+		if err := table.Close(); err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+// gradebookCellValue 导出时单元格的内容：计入总评的成绩为数字，其他为说明文字
+func gradebookCellValue(cell gradebookCell) interface{} {
+	var text string
+	switch cell.Status {
+	case gradebookGraded:
+		if !cell.Dropped {
+			return *cell.Score
+		}
+		text = strconv.Itoa(*cell.Score)
+	case gradebookMissing:
+		text = "缺考"
+	case gradebookExcused:
+		text = "免考"
+	default:
+		return nil
+	}
+	if cell.Dropped {
+		text += "（不计）"
+	}
+	return text
+}
+
+// formatPercent 格式化百分比（去掉多余的0）
+func formatPercent(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// optionalNumber 可能为空的数值，为空时导出空单元格
+func optionalNumber(value *float64) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+// validateCategory 检查成绩类别，返回错误说明
+func validateCategory(db *gorm.DB, category models.GradebookCategory) string {
+	if strings.TrimSpace(category.Name) == "" {
+		return "Category name is required"
+	}
+	if category.Weight < 0 || category.Weight > 100 {
+		return "Weight must be between 0 and 100"
+	}
+	if category.DropLowest < 0 {
+		return "Drop lowest must not be negative"
+	}
+
+	// 同一班级各类别的权重之和不超过100%
+	var others float64
+	db.Model(&models.GradebookCategory{}).Where("class_id = ? AND id <> ?", category.ClassID, category.ID).
+		Select("COALESCE(SUM(weight), 0)").Scan(&others)
+	if others+category.Weight > 100+1e-9 {
+		return "Total weight of categories must not exceed 100"
+	}
+	return ""
+}
+
+// categoryRequest 创建或修改成绩类别的请求
+type categoryRequest struct {
+	Name       string  `json:"name" binding:"required"`
+	Weight     float64 `json:"weight"`
+	DropLowest int     `json:"dropLowest"`
+	Position   int     `json:"position"`
+}
+
+// GetGradebookCategories 获取班级的成绩类别
+func GetGradebookCategories(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := requireClassAccess(db, c, c.Param("id"), accessView)
+		if !ok {
+			return
+		}
+
+		categories := []models.GradebookCategory{}
+		if err := db.Where("class_id = ?", class.ID).Order("position, id").Find(&categories).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"categories": categories,
+			"total":      len(categories),
+		})
+	}
+}
+
+// CreateGradebookCategory 创建成绩类别
+func CreateGradebookCategory(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := requireClassAccess(db, c, c.Param("id"), accessEdit)
+		if !ok {
+			return
+		}
+
+		var request categoryRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category data"})
+			return
+		}
+
+		category := models.GradebookCategory{
+			ClassID:    class.ID,
+			Name:       strings.TrimSpace(request.Name),
+			Weight:     request.Weight,
+			DropLowest: request.DropLowest,
+			Position:   request.Position,
+		}
+		if message := validateCategory(db, category); message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+		if err := db.Create(&category).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
+			return
+		}
+		recordAudit(db, c, models.AuditGradebookUpdate, "class", class.ID, nil, category)
+
+		c.JSON(http.StatusCreated, category)
+	}
+}
+
+// UpdateGradebookCategory 修改成绩类别
+func UpdateGradebookCategory(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := requireClassAccess(db, c, c.Param("id"), accessEdit)
+		if !ok {
+			return
+		}
+
+		var category models.GradebookCategory
+		if err := db.Where("id = ? AND class_id = ?", c.Param("categoryId"), class.ID).First(&category).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return
+		}
+
+		var request categoryRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category data"})
+			return
+		}
+
+		before := category
+		category.Name = strings.TrimSpace(request.Name)
+		category.Weight = request.Weight
+		category.DropLowest = request.DropLowest
+		category.Position = request.Position
+		if message := validateCategory(db, category); message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+		if err := db.Save(&category).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
+			return
+		}
+		recordAudit(db, c, models.AuditGradebookUpdate, "class", class.ID, before, category)
+
+		c.JSON(http.StatusOK, category)
+	}
+}
+
+// DeleteGradebookCategory 删除成绩类别，其中的考试变为未分类
+func DeleteGradebookCategory(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := requireClassAccess(db, c, c.Param("id"), accessEdit)
+		if !ok {
+			return
+		}
+
+		var category models.GradebookCategory
+		if err := db.Where("id = ? AND class_id = ?", c.Param("categoryId"), class.ID).First(&category).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.ExamAssignment{}).Where("category_id = ?", category.ID).
+				Update("category_id", 0).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&category).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+			return
+		}
+		recordAudit(db, c, models.AuditGradebookUpdate, "class", class.ID, category, nil)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Category deleted successfully",
+		})
+	}
+}
+
+// UpdateGradebookSettings 修改班级成绩册设置（总评使用的等级制）
+func UpdateGradebookSettings(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := requireClassAccess(db, c, c.Param("id"), accessEdit)
+		if !ok {
+			return
+		}
+
+		var request struct {
+			GradeScaleID uint `json:"gradeScaleId"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gradebook settings"})
+			return
+		}
+		if request.GradeScaleID != 0 {
+			if err := db.First(&models.GradeScale{}, request.GradeScaleID).Error; err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Grade scale not found"})
+				return
+			}
+		}
+
+		var before models.GradebookSetting
+		db.First(&before, class.ID)
+		setting := models.GradebookSetting{ClassID: class.ID, GradeScaleID: request.GradeScaleID}
+		if err := db.Save(&setting).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update gradebook settings"})
+			return
+		}
+		recordAudit(db, c, models.AuditGradebookUpdate, "class", class.ID, before, setting)
+
+		c.JSON(http.StatusOK, setting)
+	}
+}
+
+// SetGradebookExcusal 设置或取消学生某次考试的免考
+func SetGradebookExcusal(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := requireClassAccess(db, c, c.Param("id"), accessEdit)
+		if !ok {
+			return
+		}
+
+		var request struct {
+			AssignmentID uint   `json:"assignmentId" binding:"required"`
+			StudentID    uint   `json:"studentId" binding:"required"`
+			Excused      bool   `json:"excused"`
+			Reason       string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Assignment and student are required"})
+			return
+		}
+
+		var assignment models.ExamAssignment
+		if err := db.Where("id = ? AND class_id = ?", request.AssignmentID, class.ID).First(&assignment).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+			return
+		}
+		var student models.User
+		if err := db.Where("id = ? AND class_id = ? AND role = 1", request.StudentID, class.ID).First(&student).Error; err != nil { // 1: student
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+			return
+		}
+
+		var existing models.GradebookExcusal
+		found := db.Where("exam_assignment_id = ? AND student_id = ?", assignment.ID, student.ID).First(&existing).Error == nil
+
+		if !request.Excused {
+			if found {
+				if err := db.Delete(&existing).Error; err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update excusal"})
+					return
+				}
+				recordAudit(db, c, models.AuditGradebookExcuse, "exam_assignment", assignment.ID, existing, nil)
+			}
+			c.JSON(http.StatusOK, gin.H{"excused": false, "message": "Excusal removed successfully"})
+			return
+		}
+
+		excusal := existing
+		excusal.ExamAssignmentID = assignment.ID
+		excusal.StudentID = student.ID
+		excusal.Reason = strings.TrimSpace(request.Reason)
+		excusal.CreatedBy = currentUserID(c)
+		if err := db.Save(&excusal).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update excusal"})
+			return
+		}
+		var before interface{}
+		if found {
+			before = existing
+		}
+		recordAudit(db, c, models.AuditGradebookExcuse, "exam_assignment", assignment.ID, before, excusal)
+
+		c.JSON(http.StatusOK, gin.H{"excused": true, "excusal": excusal, "message": "Student excused successfully"})
+	}
+}
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"server/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// scoreBreakdown 得分明细：答对得分、答错倒扣分和最终总分
+type scoreBreakdown struct {
+	Earned  int `json:"earnedPoints"`
+	Penalty int `json:"penaltyPoints"`
+	Score   int `json:"score"`
+}
+
+// gradeAnswers 按试卷题目评分，每道题生成一条作答记录（未作答的题目得0分），返回记录和得分明细
+func gradeAnswers(exam models.Exam, questions []models.Question, answers []ans) ([]models.ResultAnswer, scoreBreakdown) {
+	byQuestion := make(map[uint]ans, len(answers))
+	for _, answer := range answers {
+		byQuestion[answer.QuestionID] = answer
+	}
+
+	records := make([]models.ResultAnswer, 0, len(questions))
+	var breakdown scoreBreakdown
+	total := 0
+	for _, question := range questions {
+		record := gradeAnswer(question, byQuestion[question.ID])
+		breakdown.Earned += record.AwardedPoints + record.PenaltyPoints
+		breakdown.Penalty += record.PenaltyPoints
+		total += record.AwardedPoints
+		records = append(records, record)
+	}
+	breakdown.Score = finalScore(exam, total)
+	return records, breakdown
+}
+
+// finalScore 由各题得分之和计算总分，试卷设置了 FloorAtZero 时最低为0
+func finalScore(exam models.Exam, sum int) int {
+	if exam.FloorAtZero && sum < 0 {
+		return 0
+	}
+	return sum
+}
+
+// overriddenScore 各题得分之和加上手动修改总分的调整量，按试卷设置计算原始成绩（不超过试卷总分）
+//
+// 手动评分和重新评分都通过这里计算，同样的作答得到同样的成绩
+func overriddenScore(exam models.Exam, sum, override int) int {
+	score := finalScore(exam, sum+override)
+	if score > exam.TotalScore {
+		return exam.TotalScore
+	}
+	return score
+}
+
+// gradeAnswer 自动评分单道题，答错（已作答但不正确）时按 PenaltyPercent 倒扣分
+func gradeAnswer(question models.Question, answer ans) models.ResultAnswer {
+	record := models.ResultAnswer{
+		QuestionID: question.ID,
+		MaxPoints:  question.Score,
+	}
+
+	switch question.Type {
+	case "single":
+		// 单选题评分
+		record.Answer = answer.Answer
+		if answer.Answer != "" && answer.Answer == question.Answer {
+			record.AwardedPoints = question.Score
+		} else if answer.Answer != "" {
+			record.PenaltyPoints = question.Score * question.PenaltyPercent / 100
+		}
+	case "fill":
+		// 填空题评分（按答对的空数给分），多余的答案忽略
+		record.BlankAnswers = models.StringList(answer.Answers)
+		if len(question.Answers) > 0 {
+			correct, wrong := 0, 0
+			for k, ok := range matchBlanks(question.Answers, answer.Answers) {
+				if ok {
+					correct++
+				} else if k < len(answer.Answers) && strings.TrimSpace(answer.Answers[k]) != "" {
+					wrong++
+				}
+			}
+			record.AwardedPoints = question.Score * correct / len(question.Answers)
+			record.PenaltyPoints = question.Score * question.PenaltyPercent * wrong / (100 * len(question.Answers))
+		}
+	}
+	record.AwardedPoints -= record.PenaltyPoints
+	return record
+}
+
+// loadResultAnswers 加载答卷的作答记录，按答卷ID和题目ID索引
+func loadResultAnswers(db *gorm.DB, resultIDs []uint) map[uint]map[uint]models.ResultAnswer {
+	records := map[uint]map[uint]models.ResultAnswer{}
+	if len(resultIDs) == 0 {
+		return records
+	}
+
+	var rows []models.ResultAnswer
+	// SQLite 限制单条语句的参数个数，分批查询
+	for start := 0; start < len(resultIDs); start += 500 {
+		end := start + 500
+		if end > len(resultIDs) {
+			end = len(resultIDs)
+		}
+		var batch []models.ResultAnswer
+		db.Where("exam_result_id IN ?", resultIDs[start:end]).Find(&batch)
+		rows = append(rows, batch...)
+	}
+
+	for _, row := range rows {
+		if records[row.ExamResultID] == nil {
+			records[row.ExamResultID] = map[uint]models.ResultAnswer{}
+		}
+		records[row.ExamResultID][row.QuestionID] = row
+	}
+	return records
+}
+
+// resultIDs 答卷ID列表
+func resultIDs(results []models.ExamResult) []uint {
+	ids := make([]uint, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	return ids
+}
+
+// MigrateResultAnswers 为旧版答卷（只保存了答案JSON）补充每题的作答记录
+func MigrateResultAnswers(db *gorm.DB) {
+	var results []models.ExamResult
+	db.Preload("ExamAssignment.Exam").
+		Where("id NOT IN (?)", db.Model(&models.ResultAnswer{}).Select("exam_result_id")).
+		Find(&results)
+
+	questionsByExam := map[uint][]models.Question{}
+	for _, result := range results {
+		examID := result.ExamAssignment.ExamID
+		questions, loaded := questionsByExam[examID]
+		if !loaded {
+			db.Where("exam_id = ?", examID).Order("id").Find(&questions)
+			questionsByExam[examID] = questions
+		}
+		if len(questions) == 0 {
+			continue
+		}
+
+		var answers []ans
+		json.Unmarshal([]byte(result.Answers), &answers)
+		records, _ := gradeAnswers(result.ExamAssignment.Exam, questions, answers)
+		for i := range records {
+			records[i].ExamResultID = result.ID
+		}
+		// 保留原有总分（可能已被手动修改）
+		if err := db.Create(&records).Error; err != nil {
+			log.Printf("Failed to migrate answers of result %d: %v", result.ID, err)
+		}
+	}
+}
+
+// setAnswerPoints 手动设置某道题的得分并重新计算总分，返回最终成绩
+//
+// result 需要预加载 ExamAssignment.Exam
+func setAnswerPoints(tx *gorm.DB, c *gin.Context, result models.ExamResult, record models.ResultAnswer, points int) (int, error) {
+	// 手动评分取代自动评分，不再倒扣分
+	if err := tx.Model(&record).Updates(map[string]interface{}{
+		"awarded_points": points,
+		"penalty_points": 0,
+		"manual":         true,
+		"graded_by":      currentUserID(c),
+	}).Error; err != nil {
+		return 0, err
+	}
+	sum, err := answerPointsSum(tx, result.ID)
+	if err != nil {
+		return 0, err
+	}
+	// 之前手动修改过总分时保留调整量
+	exam := result.ExamAssignment.Exam
+	return setRawScore(tx, result.ID, overriddenScore(exam, sum, result.ScoreOverride))
+}
+
+// answerPointsSum 答卷各题得分之和
+func answerPointsSum(tx *gorm.DB, resultID uint) (int, error) {
+	var sum int
+	err := tx.Model(&models.ResultAnswer{}).Where("exam_result_id = ?", resultID).
+		Select("COALESCE(SUM(awarded_points), 0)").Scan(&sum).Error
+	return sum, err
+}
+
+// MigrateScoreOverrides 旧版手动修改的总分没有单独保存调整量，按原始成绩与各题得分之和的差补充
+//
+// 旧版数据库升级时 raw_score 可能尚未补充，没有应用成绩调整的答卷按 score 计算
+func MigrateScoreOverrides(db *gorm.DB) {
+	const rawScore = "CASE WHEN exam_results.adjusted THEN exam_results.raw_score ELSE exam_results.score END"
+	type candidate struct {
+		ID       uint
+		RawScore int
+		Sum      int
+	}
+	var candidates []candidate
+	db.Model(&models.ExamResult{}).
+		Select("exam_results.id, " + rawScore + " AS raw_score, SUM(result_answers.awarded_points) AS sum").
+		Joins("JOIN result_answers ON result_answers.exam_result_id = exam_results.id").
+		Where("exam_results.score_override = 0").
+		Group("exam_results.id").
+		Having(rawScore + " <> SUM(result_answers.awarded_points)").
+		Scan(&candidates)
+
+	for _, item := range candidates {
+		var result models.ExamResult
+		if err := db.Preload("ExamAssignment.Exam").First(&result, item.ID).Error; err != nil {
+			continue
+		}
+		// 试卷设置了 FloorAtZero 时总分为0不是手动修改
+		if item.RawScore == finalScore(result.ExamAssignment.Exam, item.Sum) {
+			continue
+		}
+		if err := db.Model(&models.ExamResult{}).Where("id = ?", result.ID).
+			Update("score_override", item.RawScore-item.Sum).Error; err != nil {
+			log.Printf("Failed to migrate score override of result %d: %v", result.ID, err)
+		}
+	}
+}
+
+// GradeAnswer 手动评定答卷中某道题的得分，总分随之更新，需要填写原因并记录审计日志
+func GradeAnswer(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Points *int   `json:"points" binding:"required"`
+			Reason string `json:"reason" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Points and reason are required"})
+			return
+		}
+
+		var result models.ExamResult
+		if err := db.Preload("ExamAssignment.Exam").First(&result, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
+			return
+		}
+
+		// 修改成绩需要对分配的班级或试卷有编辑权限
+		if assignmentAccess(db, c, result.ExamAssignmentID) < accessEdit {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No permission to modify this result"})
+			return
+		}
+
+		var record models.ResultAnswer
+		if err := db.Where("exam_result_id = ? AND question_id = ?", result.ID, c.Param("questionId")).
+			First(&record).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Answer not found"})
+			return
+		}
+		if *request.Points < 0 || *request.Points > record.MaxPoints {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Points out of range"})
+			return
+		}
+
+		before := gin.H{"awardedPoints": record.AwardedPoints, "penaltyPoints": record.PenaltyPoints, "manual": record.Manual, "score": result.Score}
+		var score int
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			score, err = setAnswerPoints(tx, c, result, record, *request.Points)
+			return err
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update score"})
+			return
+		}
+
+		recordAudit(db, c, models.AuditAnswerGrade, "exam_result", result.ID, before, gin.H{
+			"questionId":    record.QuestionID,
+			"awardedPoints": *request.Points,
+			"score":         score,
+			"reason":        request.Reason,
+		})
+		go publishLTIScore(db, result.ID)
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":            result.ID,
+			"questionId":    record.QuestionID,
+			"awardedPoints": *request.Points,
+			"score":         score,
+			"message":       "Score updated successfully",
+		})
+	}
+}
+
+// SetAnswerFeedback 填写答卷中某道题的教师评语，按考试安排的 ShowFeedback 设置决定学生是否可见
+func SetAnswerFeedback(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Feedback string `json:"feedback"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feedback"})
+			return
+		}
+
+		var result models.ExamResult
+		if err := db.First(&result, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
+			return
+		}
+
+		// 填写评语需要对分配的班级或试卷有编辑权限
+		if assignmentAccess(db, c, result.ExamAssignmentID) < accessEdit {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No permission to modify this result"})
+			return
+		}
+
+		var record models.ResultAnswer
+		if err := db.Where("exam_result_id = ? AND question_id = ?", result.ID, c.Param("questionId")).
+			First(&record).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Answer not found"})
+			return
+		}
+
+		before := gin.H{"questionId": record.QuestionID, "feedback": record.Feedback}
+		feedback := strings.TrimSpace(request.Feedback)
+		if err := db.Model(&record).Update("feedback", feedback).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update feedback"})
+			return
+		}
+		recordAudit(db, c, models.AuditAnswerFeedback, "exam_result", result.ID, before, gin.H{
+			"questionId": record.QuestionID,
+			"feedback":   feedback,
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":         result.ID,
+			"questionId": record.QuestionID,
+			"feedback":   feedback,
+			"message":    "Feedback updated successfully",
+		})
+	}
+}
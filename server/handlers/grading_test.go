@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"net/http"
+	"server/models"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// gradingFixture 一份两道单选题（各10分，答错倒扣50%）的试卷和一份答卷：第一题答对，第二题答错，各题得分之和为5
+type gradingFixture struct {
+	exam      models.Exam
+	questions []models.Question
+	result    models.ExamResult
+	teacher   models.User
+}
+
+func newGradingFixture(t *testing.T, db *gorm.DB, floorAtZero bool) gradingFixture {
+	t.Helper()
+	f := gradingFixture{teacher: seedUser(t, db, models.User{Username: "teacher", Role: 2, Password: "x"})}
+	f.exam = models.Exam{Title: "Quiz", TotalScore: 20, Status: "published", CreatedBy: f.teacher.ID, FloorAtZero: floorAtZero}
+	if err := db.Create(&f.exam).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		question := models.Question{ExamID: f.exam.ID, Type: "single", Content: "Q" + strconv.Itoa(i+1), Score: 10,
+			Answer: "A", PenaltyPercent: 50, Options: models.Options{{Key: "A", Text: "a"}, {Key: "B", Text: "b"}}}
+		if err := db.Create(&question).Error; err != nil {
+			t.Fatal(err)
+		}
+		f.questions = append(f.questions, question)
+	}
+
+	class := models.Class{Name: "Class " + strconv.FormatUint(uint64(f.exam.ID), 10), Major: "CS", TeacherID: f.teacher.ID}
+	db.Create(&class)
+	student := seedUser(t, db, models.User{Username: "student", Role: 1, Password: "x", ClassId: int(class.ID)})
+	assignment := models.ExamAssignment{ExamID: f.exam.ID, ClassID: class.ID, StartTime: "2026-01-01 00:00:00",
+		EndTime: "2026-01-02 00:00:00", Duration: 60, PassScore: 12}
+	db.Create(&assignment)
+
+	records, breakdown := gradeAnswers(f.exam, f.questions, []ans{
+		{QuestionID: f.questions[0].ID, Answer: "A"},
+		{QuestionID: f.questions[1].ID, Answer: "B"},
+	})
+	f.result = models.ExamResult{ExamAssignmentID: assignment.ID, StudentID: student.ID,
+		Score: breakdown.Score, RawScore: breakdown.Score, Answers: "[]"}
+	if err := db.Create(&f.result).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := range records {
+		records[i].ExamResultID = f.result.ID
+	}
+	if err := db.Create(&records).Error; err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// asUser 以指定用户（拥有 scope.all）访问的路由
+func asUser(userID uint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user", gin.H{"id": userID, "username": "teacher", "permissions": models.Permissions{models.PermScopeAll}})
+	}
+}
+
+func loadResult(t *testing.T, db *gorm.DB, resultID uint) models.ExamResult {
+	t.Helper()
+	var result models.ExamResult
+	if err := db.First(&result, resultID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestOverrideScoreSurvivesAnswerGrading(t *testing.T) {
+	db := newTestDB(t)
+	f := newGradingFixture(t, db, false)
+	router := gin.New()
+	router.PUT("/results/:id/score", asUser(f.teacher.ID), OverrideScore(db))
+	router.PUT("/results/:id/answers/:questionId", asUser(f.teacher.ID), GradeAnswer(db))
+	resultURL := "/results/" + strconv.FormatUint(uint64(f.result.ID), 10)
+
+	if got := loadResult(t, db, f.result.ID).RawScore; got != 5 {
+		t.Fatalf("initial raw score %d, want 5", got)
+	}
+
+	// 手动将总分改为8（比各题得分之和多3分）
+	w := doRequest(router, http.MethodPut, resultURL+"/score", gin.H{"score": 8, "reason": "bonus"}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("override: status %d: %s", w.Code, w.Body.String())
+	}
+	if result := loadResult(t, db, f.result.ID); result.RawScore != 8 || result.ScoreOverride != 3 {
+		t.Fatalf("after override: raw %d override %d, want 8 and 3", result.RawScore, result.ScoreOverride)
+	}
+
+	// 第二题改为4分：各题得分之和为14，保留手动加的3分
+	w = doRequest(router, http.MethodPut, resultURL+"/answers/"+strconv.FormatUint(uint64(f.questions[1].ID), 10),
+		gin.H{"points": 4, "reason": "partial credit"}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("grade answer: status %d: %s", w.Code, w.Body.String())
+	}
+	if got := loadResult(t, db, f.result.ID).RawScore; got != 17 {
+		t.Fatalf("after grading: raw %d, want 17", got)
+	}
+
+	// 不超过试卷总分
+	w = doRequest(router, http.MethodPut, resultURL+"/answers/"+strconv.FormatUint(uint64(f.questions[1].ID), 10),
+		gin.H{"points": 10, "reason": "full credit"}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("grade answer: status %d: %s", w.Code, w.Body.String())
+	}
+	if got := loadResult(t, db, f.result.ID).RawScore; got != 20 {
+		t.Fatalf("after grading: raw %d, want 20", got)
+	}
+}
+
+func TestMigrateScoreOverrides(t *testing.T) {
+	db := newTestDB(t)
+	overridden := newGradingFixture(t, db, false)
+	db.Model(&overridden.result).Updates(map[string]interface{}{"score": 11, "raw_score": 11})
+
+	// 试卷设置了 FloorAtZero 时，各题得分之和为负、总分为0的答卷不是手动修改
+	floored := newGradingFixture(t, db, true)
+	db.Model(&models.ResultAnswer{}).Where("exam_result_id = ?", floored.result.ID).Update("awarded_points", -5)
+	db.Model(&floored.result).Updates(map[string]interface{}{"score": 0, "raw_score": 0})
+
+	MigrateScoreOverrides(db)
+	MigrateScoreOverrides(db)
+
+	if got := loadResult(t, db, overridden.result.ID).ScoreOverride; got != 6 {
+		t.Fatalf("override %d, want 6", got)
+	}
+	if got := loadResult(t, db, floored.result.ID).ScoreOverride; got != 0 {
+		t.Fatalf("floored result got override %d", got)
+	}
+}
+
+// 从旧版数据库升级：raw_score 尚未补充（为0），总分只保存在 score 中
+func TestMigrateScoreOverridesFromBaseline(t *testing.T) {
+	db := newTestDB(t)
+	unchanged := newGradingFixture(t, db, false)
+	db.Model(&unchanged.result).Updates(map[string]interface{}{"score": 5, "raw_score": 0})
+	overridden := newGradingFixture(t, db, false)
+	db.Model(&overridden.result).Updates(map[string]interface{}{"score": 8, "raw_score": 0})
+
+	MigrateScoreOverrides(db)
+
+	if got := loadResult(t, db, unchanged.result.ID).ScoreOverride; got != 0 {
+		t.Fatalf("unchanged result got override %d", got)
+	}
+	if got := loadResult(t, db, overridden.result.ID).ScoreOverride; got != 3 {
+		t.Fatalf("override %d, want 3", got)
+	}
+
+	// 补充原始成绩后重新评定某道题（得分不变），总分保持原有成绩
+	db.Model(&models.ExamResult{}).Where("adjusted = ? AND raw_score <> score", false).Update("raw_score", gorm.Expr("score"))
+	for _, f := range []gradingFixture{unchanged, overridden} {
+		router := gin.New()
+		router.PUT("/results/:id/answers/:questionId", asUser(f.teacher.ID), GradeAnswer(db))
+		before := loadResult(t, db, f.result.ID).Score
+		w := doRequest(router, http.MethodPut, "/results/"+strconv.FormatUint(uint64(f.result.ID), 10)+"/answers/"+
+			strconv.FormatUint(uint64(f.questions[0].ID), 10), gin.H{"points": 10, "reason": "recheck"}, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("grade answer: status %d: %s", w.Code, w.Body.String())
+		}
+		if after := loadResult(t, db, f.result.ID); after.RawScore != before || after.Score != before {
+			t.Fatalf("score changed from %d to raw %d, score %d", before, after.RawScore, after.Score)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"server/models"
+	"server/utils"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestDB 创建测试用的 SQLite 数据库，迁移所有表并创建内置角色
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret")
+	if err := utils.LoadJWTConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Exam{},
+		&models.Question{},
+		&models.ExamResult{},
+		&models.Class{},
+		&models.ExamAssignment{},
+		&models.LoginLog{},
+		&models.Message{},
+		&models.ExamTimer{},
+		&models.UserSession{},
+		&models.RecoveryCode{},
+		&models.SystemSetting{},
+		&models.ResourceShare{},
+		&models.Role{},
+		&models.UserRole{},
+		&models.AuditLog{},
+		&models.UserIdentity{},
+		&models.LTIPlatform{},
+		&models.LTIResourceLink{},
+		&models.LTIDeepLinkRequest{},
+		&models.LTIDeepLinkItem{},
+		&models.APIKey{},
+		&models.ResultAnswer{},
+		&models.Regrade{},
+		&models.RegradeChange{},
+		&models.GradeScale{},
+		&models.ScoreAdjustment{},
+		&models.Appeal{},
+		&models.AppealEvent{},
+		&models.GradebookCategory{},
+		&models.GradebookSetting{},
+		&models.GradebookExcusal{},
+	); err != nil {
+		t.Fatal(err)
+	}
+	for _, builtin := range models.BuiltinRoles {
+		role := builtin
+		if err := db.Create(&role).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// doRequest 向路由发送请求，body 不为 nil 时以 JSON 提交
+func doRequest(router http.Handler, method, target string, body interface{}, token string) *httptest.ResponseRecorder {
+	var reader *strings.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = strings.NewReader(string(data))
+	} else {
+		reader = strings.NewReader("")
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// seedUser 创建启用的账号，未指定密码时本地密码为 local-password
+func seedUser(t *testing.T, db *gorm.DB, user models.User) models.User {
+	t.Helper()
+	user.Status = 1
+	if user.Password == "" {
+		hash, err := models.HashPassword("local-password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		user.Password = hash
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"server/models"
+	"server/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ImpersonateStudent 以学生身份只读查看（模拟登录）
+// 签发的令牌带有模拟人身份且只读，不能提交考试，也不返回刷新令牌
+func ImpersonateStudent(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Reason string `json:"reason" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Reason is required"})
+			return
+		}
+
+		var student models.User
+		if err := db.Where("id = ? AND role = 1", c.Param("id")).First(&student).Error; err != nil { // 1: student
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+			return
+		}
+
+		if !requireStudentClassAccess(db, c, student.ClassId, accessView) {
+			return
+		}
+
+		if student.Status != 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Account is disabled"})
+			return
+		}
+
+		// 模拟会话不能刷新，刷新令牌仅用于占位，不返回给客户端
+		_, refreshTokenHash, err := utils.GenerateRefreshToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+
+		impersonatorID := currentUserID(c)
+		session := models.UserSession{
+			UserID:           student.ID,
+			RefreshTokenHash: refreshTokenHash,
+			ExpiresAt:        time.Now().Add(utils.AccessTokenTTL),
+			IP:               c.ClientIP(),
+			UserAgent:        c.GetHeader("User-Agent"),
+			ImpersonatorID:   impersonatorID,
+		}
+		if err := db.Create(&session).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+
+		token, err := utils.GenerateToken(student.ID, student.Username, student.Role, student.IsAdmin, session.ID,
+			utils.WithImpersonator(impersonatorID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+
+		recordAudit(db, c, models.AuditImpersonateStart, "user", student.ID, nil, gin.H{
+			"sessionId": session.ID,
+			"reason":    request.Reason,
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"token":          token,
+			"expiresIn":      int(utils.AccessTokenTTL.Seconds()),
+			"readOnly":       true,
+			"impersonatorId": impersonatorID,
+			"user": gin.H{
+				"id":        student.ID,
+				"name":      student.Name,
+				"role":      student.Role,
+				"studentId": student.StudentID,
+				"classId":   student.ClassId,
+			},
+			"message": "Impersonation started",
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"server/models"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// itemGroupRatio 区分度计算中高分组、低分组各占的比例
+const itemGroupRatio = 0.27
+
+// itemWrongAnswerLimit 填空题每个空返回的常见错误答案数量
+const itemWrongAnswerLimit = 5
+
+// itemOptionStat 单选题选项的选择情况
+type itemOptionStat struct {
+	Key        string  `json:"key"`
+	Text       string  `json:"text"`
+	Correct    bool    `json:"correct"`
+	Count      int     `json:"count"`
+	Rate       float64 `json:"rate"`       // 选择比例（%）
+	UpperCount int     `json:"upperCount"` // 高分组中的选择人数
+	LowerCount int     `json:"lowerCount"` // 低分组中的选择人数
+}
+
+// itemAnswerCount 答案及人数
+type itemAnswerCount struct {
+	Answer string `json:"answer"`
+	Count  int    `json:"count"`
+}
+
+// itemBlankStat 填空题每个空的作答情况
+type itemBlankStat struct {
+	Index        int               `json:"index"`
+	CorrectRate  float64           `json:"correctRate"` // 答对比例（%）
+	WrongAnswers []itemAnswerCount `json:"wrongAnswers"`
+}
+
+// itemAnalysis 单个题目的分析结果
+type itemAnalysis struct {
+	QuestionID uint   `json:"questionId"`
+	Content    string `json:"content"`
+	Type       string `json:"type"`
+	Score      int    `json:"score"`
+	Answer     string `json:"answer"`
+
+	Responses  int     `json:"responses"`  // 作答人数（含未作答）
+	Unanswered int     `json:"unanswered"` // 未作答人数
+	AvgScore   float64 `json:"avgScore"`
+	// Difficulty 难度指数（p值）：平均得分率，越高越容易
+	Difficulty float64 `json:"difficulty"`
+	// Discrimination 区分度：高分组（前27%）与低分组（后27%）得分率之差
+	Discrimination float64 `json:"discrimination"`
+	// PointBiserial 点二列相关：本题得分与其余题目总分的相关系数，得分无差异时为空
+	PointBiserial *float64 `json:"pointBiserial"`
+
+	Options []itemOptionStat `json:"options,omitempty"`
+	Blanks  []itemBlankStat  `json:"blanks,omitempty"`
+	// Flags 需要关注的问题：too_easy、too_hard、low_discrimination、negative_discrimination
+	Flags []string `json:"flags"`
+}
+
+// itemResponse 一份答卷，total 为各题得分之和（不含成绩调整和手动修改的总分）
+type itemResponse struct {
+	total   int
+	answers map[uint]models.ResultAnswer
+}
+
+// GetItemAnalysis 题目分析：难度、区分度、点二列相关和选项/错误答案统计
+func GetItemAnalysis(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exam, questions, results, ok := loadAnalysisResults(db, c)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"examId":     exam.ID,
+			"examTitle":  exam.Title,
+			"totalScore": exam.TotalScore,
+			"responses":  len(results),
+			"groupSize":  itemGroupSize(len(results)),
+			"questions":  analyzeItems(db, questions, results),
+		})
+	}
+}
+
+// loadAnalysisResults 按试卷（examId，统计可访问的所有考试安排）或考试安排（assignmentId）加载题目和答卷，
+// 失败时直接返回错误响应
+func loadAnalysisResults(db *gorm.DB, c *gin.Context) (models.Exam, []models.Question, []models.ExamResult, bool) {
+	examID := c.Query("examId")
+	assignmentID := c.Query("assignmentId")
+
+	ids, all := accessibleAssignmentIDs(db, c)
+	query := db.Model(&models.ExamResult{})
+	var exam models.Exam
+	switch {
+	case assignmentID != "":
+		var assignment models.ExamAssignment
+		if err := db.First(&assignment, assignmentID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exam assignment not found"})
+			return exam, nil, nil, false
+		}
+		if !all && !containsID(ids, assignment.ID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No permission to access this assignment"})
+			return exam, nil, nil, false
+		}
+		if err := db.First(&exam, assignment.ExamID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+			return exam, nil, nil, false
+		}
+		query = query.Where("exam_assignment_id = ?", assignment.ID)
+	case examID != "":
+		if err := db.First(&exam, examID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+			return exam, nil, nil, false
+		}
+		query = query.Where("exam_assignment_id IN (?)",
+			db.Model(&models.ExamAssignment{}).Select("id").Where("exam_id = ?", exam.ID)).
+			Scopes(resultsScope(db, c))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "examId or assignmentId is required"})
+		return exam, nil, nil, false
+	}
+
+	var results []models.ExamResult
+	if err := query.Order("id").Find(&results).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch results"})
+		return exam, nil, nil, false
+	}
+	var questions []models.Question
+	if err := db.Where("exam_id = ?", exam.ID).Order("id").Find(&questions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
+		return exam, nil, nil, false
+	}
+	return exam, questions, results, true
+}
+
+// itemGroupSize 高分组、低分组的人数
+func itemGroupSize(n int) int {
+	if n < 2 {
+		return 0
+	}
+	size := int(math.Round(float64(n) * itemGroupRatio))
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// analyzeItems 对同一试卷的答卷做题目分析
+func analyzeItems(db *gorm.DB, questions []models.Question, results []models.ExamResult) []itemAnalysis {
+	records := loadResultAnswers(db, resultIDs(results))
+	responses := make([]itemResponse, 0, len(results))
+	for _, result := range results {
+		// 区分度和除去本题的总分相关都按各题得分计算，调分后的 Score 会使 total - 本题得分失去意义
+		total := 0
+		for _, record := range records[result.ID] {
+			total += record.AwardedPoints
+		}
+		responses = append(responses, itemResponse{total: total, answers: records[result.ID]})
+	}
+
+	// 按总分从高到低排序，取前后27%作为高分组和低分组
+	sort.SliceStable(responses, func(i, j int) bool { return responses[i].total > responses[j].total })
+	groupSize := itemGroupSize(len(responses))
+
+	analyses := make([]itemAnalysis, 0, len(questions))
+	for _, question := range questions {
+		analyses = append(analyses, analyzeItem(question, responses, groupSize))
+	}
+	return analyses
+}
+
+// analyzeItem 计算单个题目的统计指标
+func analyzeItem(question models.Question, responses []itemResponse, groupSize int) itemAnalysis {
+	analysis := itemAnalysis{
+		QuestionID: question.ID,
+		Content:    question.Content,
+		Type:       question.Type,
+		Score:      question.Score,
+		Answer:     question.Answer,
+		Responses:  len(responses),
+		Flags:      []string{},
+	}
+
+	n := len(responses)
+	scores := make([]float64, n)
+	rest := make([]float64, n)
+	var sum float64
+	for i, response := range responses {
+		answer := response.answers[question.ID]
+		if !answer.Answered() {
+			analysis.Unanswered++
+		}
+		scores[i] = float64(answer.AwardedPoints)
+		rest[i] = float64(response.total) - scores[i]
+		sum += scores[i]
+	}
+
+	if n > 0 && question.Score > 0 {
+		max := float64(question.Score)
+		analysis.AvgScore = roundStat(sum / float64(n))
+		analysis.Difficulty = roundStat(sum / float64(n) / max)
+
+		if groupSize > 0 {
+			var upper, lower float64
+			for i := 0; i < groupSize; i++ {
+				upper += scores[i]
+				lower += scores[n-1-i]
+			}
+			analysis.Discrimination = roundStat((upper - lower) / float64(groupSize) / max)
+		}
+		if r, ok := correlation(scores, rest); ok {
+			r = roundStat(r)
+			analysis.PointBiserial = &r
+		}
+	}
+
+	switch question.Type {
+	case "single":
+		analysis.Options = optionStats(question, responses, groupSize)
+	case "fill":
+		analysis.Blanks = blankStats(question, responses)
+	}
+
+	if n > 0 {
+		if analysis.Difficulty > 0.9 {
+			analysis.Flags = append(analysis.Flags, "too_easy")
+		}
+		if analysis.Difficulty < 0.2 {
+			analysis.Flags = append(analysis.Flags, "too_hard")
+		}
+		if groupSize > 0 {
+			if analysis.Discrimination < 0 {
+				analysis.Flags = append(analysis.Flags, "negative_discrimination")
+			} else if analysis.Discrimination < 0.2 {
+				analysis.Flags = append(analysis.Flags, "low_discrimination")
+			}
+		}
+	}
+	return analysis
+}
+
+// optionStats 统计单选题各选项的选择人数（含高分组、低分组），未作答计为空选项
+func optionStats(question models.Question, responses []itemResponse, groupSize int) []itemOptionStat {
+	stats := make([]itemOptionStat, 0, len(question.Options)+1)
+	index := map[string]int{}
+	for _, option := range question.Options {
+		index[option.Key] = len(stats)
+		stats = append(stats, itemOptionStat{Key: option.Key, Text: option.Text, Correct: option.Key == question.Answer})
+	}
+
+	n := len(responses)
+	for i, response := range responses {
+		key := response.answers[question.ID].Answer
+		k, exists := index[key]
+		if !exists {
+			// 未作答或选项已被修改
+			index[key] = len(stats)
+			k = len(stats)
+			stats = append(stats, itemOptionStat{Key: key, Correct: key == question.Answer})
+		}
+		stats[k].Count++
+		if i < groupSize {
+			stats[k].UpperCount++
+		}
+		if i >= n-groupSize {
+			stats[k].LowerCount++
+		}
+	}
+
+	for i := range stats {
+		if n > 0 {
+			stats[i].Rate = roundStat(float64(stats[i].Count) / float64(n) * 100)
+		}
+	}
+	return stats
+}
+
+// blankStats 统计填空题每个空的答对比例和最常见的错误答案
+func blankStats(question models.Question, responses []itemResponse) []itemBlankStat {
+	correct := make([]int, len(question.Answers))
+	wrong := make([]map[string]int, len(question.Answers))
+	for k := range wrong {
+		wrong[k] = map[string]int{}
+	}
+	for _, response := range responses {
+		answers := response.answers[question.ID].BlankAnswers
+		for k, ok := range matchBlanks(question.Answers, answers) {
+			if ok {
+				correct[k]++
+			} else if k < len(answers) {
+				if value := strings.TrimSpace(answers[k]); value != "" {
+					wrong[k][value]++
+				}
+			}
+		}
+	}
+
+	stats := make([]itemBlankStat, 0, len(question.Answers))
+	for k := range question.Answers {
+		wrongAnswers := make([]itemAnswerCount, 0, len(wrong[k]))
+		for answer, count := range wrong[k] {
+			wrongAnswers = append(wrongAnswers, itemAnswerCount{Answer: answer, Count: count})
+		}
+		sort.Slice(wrongAnswers, func(i, j int) bool {
+			if wrongAnswers[i].Count != wrongAnswers[j].Count {
+				return wrongAnswers[i].Count > wrongAnswers[j].Count
+			}
+			return wrongAnswers[i].Answer < wrongAnswers[j].Answer
+		})
+		if len(wrongAnswers) > itemWrongAnswerLimit {
+			wrongAnswers = wrongAnswers[:itemWrongAnswerLimit]
+		}
+
+		stat := itemBlankStat{Index: k, WrongAnswers: wrongAnswers}
+		if len(responses) > 0 {
+			stat.CorrectRate = roundStat(float64(correct[k]) / float64(len(responses)) * 100)
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+// correlation 皮尔逊相关系数，任一变量没有差异时无法计算
+func correlation(x, y []float64) (float64, bool) {
+	n := float64(len(x))
+	if n < 2 {
+		return 0, false
+	}
+	var sumX, sumY float64
+	for i := range x {
+		sumX += x[i]
+		sumY += y[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var cov, varX, varY float64
+	for i := range x {
+		dx, dy := x[i]-meanX, y[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return 0, false
+	}
+	return cov / math.Sqrt(varX*varY), true
+}
+
+// roundStat 统计值保留三位小数
+func roundStat(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
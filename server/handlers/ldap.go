@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"server/models"
+	"server/utils"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ldapSyncMutex 防止定时同步和手动同步同时执行
+var ldapSyncMutex sync.Mutex
+
+// 读取目录和验证密码，测试中替换为模拟的目录
+var (
+	ldapFetchDirectory = utils.LDAPFetchDirectory
+	ldapAuthenticate   = utils.LDAPAuthenticate
+)
+
+// errLDAPRoleConflict 目录账号与本地同名账号的角色不一致
+var errLDAPRoleConflict = errors.New("ldap account role conflicts with existing user")
+
+// errLDAPAccountConflict 目录账号与不能自动关联的本地账号（管理员或有本地密码的账号）同名或学号相同
+var errLDAPAccountConflict = errors.New("ldap account conflicts with existing local user")
+
+// ldapUpsertResult upsertLDAPUser 对本地账号的操作
+type ldapUpsertResult int
+
+const (
+	ldapUserUpdated ldapUpsertResult = iota
+	ldapUserCreated
+	ldapUserReactivated // 重新出现在目录中，恢复同步时停用的账号
+)
+
+// ldapSyncResult 目录同步结果
+type ldapSyncResult struct {
+	Created         int      `json:"created"`
+	Updated         int      `json:"updated"`
+	Deactivated     int      `json:"deactivated"`
+	Reactivated     int      `json:"reactivated"`
+	Conflicts       []string `json:"conflicts"`       // 与本地账号冲突而跳过的用户名
+	UnmatchedGroups []string `json:"unmatchedGroups"` // 找不到同名班级的分组
+}
+
+// InitLDAPSync 启动目录定时同步（未配置同步间隔时不启动）
+func InitLDAPSync(db *gorm.DB) {
+	if utils.LDAP == nil || utils.LDAP.SyncInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(utils.LDAP.SyncInterval)
+		defer ticker.Stop()
+		for {
+			if result, err := syncLDAPDirectory(db); err != nil {
+				log.Printf("LDAP sync failed: %v", err)
+			} else {
+				log.Printf("LDAP sync finished: %d created, %d updated, %d deactivated, %d reactivated",
+					result.Created, result.Updated, result.Deactivated, result.Reactivated)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// SyncLDAP 手动同步目录中的学生和教师
+func SyncLDAP(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if utils.LDAP == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "LDAP is not enabled"})
+			return
+		}
+
+		result, err := syncLDAPDirectory(db)
+		if err != nil {
+			log.Printf("LDAP sync failed: %v", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Directory service unavailable"})
+			return
+		}
+		recordAudit(db, c, models.AuditLDAPSync, "ldap", 0, nil, result)
+
+		c.JSON(http.StatusOK, gin.H{
+			"result":  result,
+			"message": "Directory synchronized successfully",
+		})
+	}
+}
+
+// normalizeDN 统一DN的大小写和空格，用于比较分组成员
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ",")
+}
+
+// syncLDAPDirectory 同步目录：创建或更新账号，按分组设置班级，停用目录中已删除的账号
+func syncLDAPDirectory(db *gorm.DB) (ldapSyncResult, error) {
+	ldapSyncMutex.Lock()
+	defer ldapSyncMutex.Unlock()
+
+	result := ldapSyncResult{Conflicts: []string{}, UnmatchedGroups: []string{}}
+	directory, err := ldapFetchDirectory()
+	if err != nil {
+		return result, err
+	}
+
+	// 分组名称与班级名称一致时，分组成员分配到该班级
+	memberClass := map[string]int{}
+	groupNames := make([]string, 0, len(directory.ClassMembers))
+	for name := range directory.ClassMembers {
+		groupNames = append(groupNames, name)
+	}
+	sort.Strings(groupNames)
+	for _, name := range groupNames {
+		var class models.Class
+		if err := db.Where("name = ?", name).First(&class).Error; err != nil {
+			result.UnmatchedGroups = append(result.UnmatchedGroups, name)
+			continue
+		}
+		for _, member := range directory.ClassMembers[name] {
+			if _, exists := memberClass[normalizeDN(member)]; !exists {
+				memberClass[normalizeDN(member)] = int(class.ID)
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, entry := range directory.Users {
+		if seen[entry.Username] {
+			continue
+		}
+		seen[entry.Username] = true
+
+		classID := 0
+		if !entry.Teacher {
+			classID = memberClass[normalizeDN(entry.DN)]
+		}
+
+		var upserted ldapUpsertResult
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var upsertErr error
+			_, upserted, upsertErr = upsertLDAPUser(tx, entry, classID)
+			return upsertErr
+		})
+		switch {
+		case errors.Is(err, errLDAPRoleConflict), errors.Is(err, errLDAPAccountConflict):
+			result.Conflicts = append(result.Conflicts, entry.Username)
+		case err != nil:
+			return result, err
+		case upserted == ldapUserCreated:
+			result.Created++
+		case upserted == ldapUserReactivated:
+			result.Reactivated++
+		default:
+			result.Updated++
+		}
+	}
+
+	// 目录为空通常是配置错误，不停用任何账号
+	if len(directory.Users) == 0 {
+		return result, nil
+	}
+
+	var identities []models.UserIdentity
+	db.Where("provider = ? AND issuer = ?", models.IdentityProviderLDAP, utils.LDAP.BaseDN).Find(&identities)
+	for _, identity := range identities {
+		if seen[identity.Subject] {
+			continue
+		}
+		update := db.Model(&models.User{}).Where("id = ? AND status = 1", identity.UserID).Update("status", 0)
+		if update.Error != nil {
+			return result, update.Error
+		}
+		if update.RowsAffected > 0 {
+			// 记录由同步停用，账号重新出现在目录中时恢复（管理员手动停用的账号不会被恢复）
+			db.Model(&identity).Update("deactivated_at", time.Now())
+			revokeUserSessions(db, identity.UserID)
+			result.Deactivated++
+		}
+	}
+
+	return result, nil
+}
+
+// upsertLDAPUser 按目录账号创建或更新本地账号，classID 为0时不修改班级
+//
+// 首次出现的目录账号只自动关联没有可用本地密码的非管理员账号（如 OIDC、LTI 创建的账号），
+// 管理员和有本地密码的同名账号返回 errLDAPAccountConflict，避免目录中的同名账号接管本地账号
+func upsertLDAPUser(tx *gorm.DB, entry utils.LDAPEntry, classID int) (models.User, ldapUpsertResult, error) {
+	var user models.User
+	var role byte = 1 // 1: student
+	if entry.Teacher {
+		role = 2 // 2: teacher
+	}
+
+	var identity models.UserIdentity
+	linked := tx.Where("provider = ? AND issuer = ? AND subject = ?",
+		models.IdentityProviderLDAP, utils.LDAP.BaseDN, entry.Username).First(&identity).Error == nil
+	if linked {
+		if err := tx.First(&user, identity.UserID).Error; err != nil {
+			// 关联的用户已删除，重新关联或创建
+			tx.Delete(&identity)
+			linked = false
+		}
+	}
+
+	created := false
+	if !linked {
+		query := tx.Where("username = ? AND role = ?", entry.Username, role)
+		if role == 1 && entry.StudentID != "" {
+			query = tx.Where("role = 1 AND (username = ? OR student_id = ?)", entry.Username, entry.StudentID)
+		}
+		var candidates []models.User
+		if err := query.Find(&candidates).Error; err != nil {
+			return user, ldapUserUpdated, err
+		}
+		for _, candidate := range candidates {
+			if candidate.IsAdmin == 1 || !candidate.RandomPassword || isLDAPUser(tx, candidate.ID) {
+				return user, ldapUserUpdated, errLDAPAccountConflict
+			}
+		}
+
+		if len(candidates) > 0 {
+			user = candidates[0]
+		} else {
+			passwordHash, err := randomPasswordHash()
+			if err != nil {
+				return user, ldapUserUpdated, err
+			}
+			user = models.User{
+				Username:       entry.Username,
+				Password:       passwordHash,
+				RandomPassword: true,
+				Role:           role,
+				Name:           entry.Name,
+				Phone:          entry.Phone,
+				StudentID:      entry.StudentID,
+				ClassId:        classID,
+				Major:          entry.Major,
+				Status:         1,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return user, ldapUserUpdated, err
+			}
+			if role == 2 {
+				if err := assignRoles(tx, &user, []string{utils.LDAP.TeacherRole}); err != nil {
+					return user, ldapUserUpdated, err
+				}
+			}
+			created = true
+		}
+
+		if err := tx.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: models.IdentityProviderLDAP,
+			Issuer:   utils.LDAP.BaseDN,
+			Subject:  entry.Username,
+			Username: entry.Username,
+		}).Error; err != nil {
+			return user, ldapUserUpdated, err
+		}
+	}
+
+	if user.Role != role {
+		return user, ldapUserUpdated, errLDAPRoleConflict
+	}
+	if created {
+		return user, ldapUserCreated, nil
+	}
+
+	// 目录中的信息覆盖本地信息（空值不覆盖）
+	updates := map[string]interface{}{}
+	for column, value := range map[string]string{
+		"name":       entry.Name,
+		"phone":      entry.Phone,
+		"student_id": entry.StudentID,
+		"major":      entry.Major,
+	} {
+		if value != "" {
+			updates[column] = value
+		}
+	}
+	if classID != 0 {
+		updates["class_id"] = classID
+	}
+
+	// 同步时因不在目录中而停用的账号重新出现，恢复启用
+	upserted := ldapUserUpdated
+	if linked && identity.DeactivatedAt != nil {
+		if user.Status == 0 {
+			updates["status"] = 1
+			upserted = ldapUserReactivated
+		}
+		if err := tx.Model(&identity).Update("deactivated_at", nil).Error; err != nil {
+			return user, ldapUserUpdated, err
+		}
+	}
+	if err := tx.Model(&user).Updates(updates).Error; err != nil {
+		return user, ldapUserUpdated, err
+	}
+	if upserted == ldapUserReactivated {
+		user.Status = 1
+	}
+	return user, upserted, nil
+}
+
+// isLDAPUser 判断账号是否由目录管理（密码由目录验证）
+func isLDAPUser(db *gorm.DB, userID uint) bool {
+	var count int64
+	db.Model(&models.UserIdentity{}).
+		Where("user_id = ? AND provider = ? AND issuer = ?", userID, models.IdentityProviderLDAP, utils.LDAP.BaseDN).
+		Count(&count)
+	return count > 0
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"net/http"
+	"server/models"
+	"server/utils"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// fakeDirectory 模拟的目录服务，替换 ldapFetchDirectory 和 ldapAuthenticate
+type fakeDirectory struct {
+	users     []utils.LDAPEntry
+	groups    map[string][]string
+	passwords map[string]string // 用户名到目录密码
+}
+
+func newFakeDirectory(t *testing.T) *fakeDirectory {
+	t.Helper()
+	directory := &fakeDirectory{groups: map[string][]string{}, passwords: map[string]string{}}
+
+	previousConfig, previousFetch, previousAuth := utils.LDAP, ldapFetchDirectory, ldapAuthenticate
+	utils.LDAP = &utils.LDAPConfig{BaseDN: "dc=example,dc=edu", TeacherRole: models.RoleTeacher}
+	ldapFetchDirectory = func() (*utils.LDAPDirectory, error) {
+		return &utils.LDAPDirectory{Users: directory.users, ClassMembers: directory.groups}, nil
+	}
+	ldapAuthenticate = func(username, password string, teacher bool) (utils.LDAPEntry, error) {
+		for _, entry := range directory.users {
+			if entry.Username == username && entry.Teacher == teacher && directory.passwords[username] == password {
+				return entry, nil
+			}
+		}
+		return utils.LDAPEntry{}, utils.ErrLDAPInvalidCredentials
+	}
+	t.Cleanup(func() {
+		utils.LDAP, ldapFetchDirectory, ldapAuthenticate = previousConfig, previousFetch, previousAuth
+	})
+	return directory
+}
+
+// add 添加目录用户，password 为空时不能通过目录登录
+func (d *fakeDirectory) add(entry utils.LDAPEntry, password string) {
+	if entry.DN == "" {
+		entry.DN = "uid=" + entry.Username + ",ou=people,dc=example,dc=edu"
+	}
+	d.users = append(d.users, entry)
+	if password != "" {
+		d.passwords[entry.Username] = password
+	}
+}
+
+// remove 从目录中删除用户
+func (d *fakeDirectory) remove(username string) {
+	users := d.users[:0]
+	for _, entry := range d.users {
+		if entry.Username != username {
+			users = append(users, entry)
+		}
+	}
+	d.users = users
+}
+
+func mustSyncLDAP(t *testing.T, db *gorm.DB) ldapSyncResult {
+	t.Helper()
+	result, err := syncLDAPDirectory(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func ldapIdentityCount(db *gorm.DB, userID uint) int64 {
+	var count int64
+	db.Model(&models.UserIdentity{}).Where("user_id = ? AND provider = ?", userID, models.IdentityProviderLDAP).Count(&count)
+	return count
+}
+
+func TestLDAPSyncCreatesUsersAndAssignsClasses(t *testing.T) {
+	db := newTestDB(t)
+	directory := newFakeDirectory(t)
+	class := models.Class{Name: "CS 2026", Major: "CS", TeacherID: 1}
+	db.Create(&class)
+
+	directory.add(utils.LDAPEntry{Username: "alice", Name: "Alice", StudentID: "2026001"}, "")
+	directory.add(utils.LDAPEntry{Username: "prof", Name: "Prof", Teacher: true}, "")
+	directory.groups["CS 2026"] = []string{"UID=alice, ou=people, dc=example, dc=edu"}
+	directory.groups["Unknown"] = []string{}
+
+	result := mustSyncLDAP(t, db)
+	if result.Created != 2 || len(result.Conflicts) != 0 || len(result.UnmatchedGroups) != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	var alice models.User
+	db.Where("username = ? AND role = 1", "alice").First(&alice)
+	if alice.ClassId != int(class.ID) || alice.StudentID != "2026001" || !alice.RandomPassword {
+		t.Fatalf("unexpected student: %+v", alice)
+	}
+	var prof models.User
+	db.Where("username = ? AND role = 2", "prof").First(&prof)
+	var roles int64
+	db.Model(&models.UserRole{}).Where("user_id = ?", prof.ID).Count(&roles)
+	if prof.ID == 0 || roles != 1 {
+		t.Fatalf("teacher not created with the configured role: %+v", prof)
+	}
+}
+
+func TestLDAPSyncDoesNotTakeOverLocalAccounts(t *testing.T) {
+	db := newTestDB(t)
+	directory := newFakeDirectory(t)
+	admin := seedUser(t, db, models.User{Username: "admin", Role: 2, IsAdmin: 1})
+	imported := seedUser(t, db, models.User{Username: "bob", Role: 1, StudentID: "2026002"})
+	byStudentID := seedUser(t, db, models.User{Username: "carol-local", Role: 1, StudentID: "2026003"})
+	external := seedUser(t, db, models.User{Username: "dave", Role: 1, RandomPassword: true})
+
+	directory.add(utils.LDAPEntry{Username: "admin", Teacher: true}, "")
+	directory.add(utils.LDAPEntry{Username: "bob", StudentID: "2026002"}, "")
+	directory.add(utils.LDAPEntry{Username: "carol", StudentID: "2026003"}, "")
+	directory.add(utils.LDAPEntry{Username: "dave", Name: "Dave"}, "")
+
+	result := mustSyncLDAP(t, db)
+	if len(result.Conflicts) != 3 || result.Updated != 1 || result.Created != 0 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	for _, user := range []models.User{admin, imported, byStudentID} {
+		if ldapIdentityCount(db, user.ID) != 0 {
+			t.Fatalf("%s was linked to the directory", user.Username)
+		}
+	}
+
+	// 外部账号创建的随机密码账号可以关联
+	if ldapIdentityCount(db, external.ID) != 1 {
+		t.Fatalf("dave was not linked")
+	}
+	db.First(&external, external.ID)
+	if external.Name != "Dave" {
+		t.Fatalf("directory attributes not applied: %+v", external)
+	}
+}
+
+func TestLDAPSyncReactivatesReturningAccounts(t *testing.T) {
+	db := newTestDB(t)
+	directory := newFakeDirectory(t)
+	directory.add(utils.LDAPEntry{Username: "alice"}, "")
+	directory.add(utils.LDAPEntry{Username: "bob"}, "")
+	directory.add(utils.LDAPEntry{Username: "carol"}, "")
+	mustSyncLDAP(t, db)
+
+	status := func(username string) byte {
+		var user models.User
+		db.Where("username = ?", username).First(&user)
+		return user.Status
+	}
+
+	// alice 离开目录后被停用；carol 由管理员手动停用
+	directory.remove("alice")
+	db.Model(&models.User{}).Where("username = ?", "carol").Update("status", 0)
+	if result := mustSyncLDAP(t, db); result.Deactivated != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if status("alice") != 0 {
+		t.Fatalf("alice was not deactivated")
+	}
+
+	directory.add(utils.LDAPEntry{Username: "alice"}, "")
+	if result := mustSyncLDAP(t, db); result.Reactivated != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if status("alice") != 1 {
+		t.Fatalf("alice was not reactivated")
+	}
+	if status("carol") != 0 {
+		t.Fatalf("manually disabled account was reactivated")
+	}
+}
+
+func TestLDAPLoginReactivatesAndRejectsLocalConflicts(t *testing.T) {
+	db := newTestDB(t)
+	directory := newFakeDirectory(t)
+	router := gin.New()
+	router.POST("/api/auth/login", Login(db))
+
+	directory.add(utils.LDAPEntry{Username: "alice"}, "directory-password")
+	mustSyncLDAP(t, db)
+	directory.remove("alice")
+	mustSyncLDAP(t, db)
+
+	// 目录中恢复后首次登录即恢复启用
+	directory.add(utils.LDAPEntry{Username: "alice"}, "directory-password")
+	w := doRequest(router, http.MethodPost, "/api/auth/login", gin.H{"username": "alice", "password": "directory-password"}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+
+	// 本地管理员仍使用本地密码，目录中的同名账号不能登录
+	seedUser(t, db, models.User{Username: "admin", Role: 2, IsAdmin: 1})
+	directory.add(utils.LDAPEntry{Username: "admin", Teacher: true}, "directory-password")
+	w = doRequest(router, http.MethodPost, "/api/auth/login",
+		gin.H{"username": "admin", "password": "directory-password", "isTeacher": true}, "")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401: %s", w.Code, w.Body.String())
+	}
+	w = doRequest(router, http.MethodPost, "/api/auth/login",
+		gin.H{"username": "admin", "password": "local-password", "isTeacher": true}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"strconv"
 	"time"
@@ -27,6 +28,13 @@ func GetLoginLogs(db *gorm.DB) gin.HandlerFunc {
 			query.Username = username
 		}
 
+		if success, err := strconv.ParseBool(c.Query("success")); err == nil {
+			query.Success = &success
+		}
+
+		query.Reason = c.Query("reason")
+		query.IP = c.Query("ip")
+
 		if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
 			query.Page = page
 		}
@@ -53,11 +61,29 @@ func GetLoginLogs(db *gorm.DB) gin.HandlerFunc {
 
 		dbQuery := db.Model(&models.LoginLog{})
 
+		// 非管理员只能查看自己和可访问班级学生的登录日志
+		if !hasGlobalScope(c) {
+			studentIDs := db.Model(&models.User{}).Select("users.id").Where("role = 1").Scopes(studentsScope(db, c)) // 1: student
+			dbQuery = dbQuery.Where("user_id = ? OR user_id IN (?)", currentUserID(c), studentIDs)
+		}
+
 		// 添加查询条件
 		if query.Username != "" {
 			dbQuery = dbQuery.Where("username LIKE ?", "%"+query.Username+"%")
 		}
 
+		if query.Success != nil {
+			dbQuery = dbQuery.Where("success = ?", *query.Success)
+		}
+
+		if query.Reason != "" {
+			dbQuery = dbQuery.Where("reason = ?", query.Reason)
+		}
+
+		if query.IP != "" {
+			dbQuery = dbQuery.Where("ip = ?", query.IP)
+		}
+
 		dbQuery = dbQuery.Where("created_at BETWEEN ? AND ?", query.StartTime, query.EndTime)
 
 		// 获取总数
@@ -78,3 +104,19 @@ func GetLoginLogs(db *gorm.DB) gin.HandlerFunc {
 		c.JSON(http.StatusOK, response)
 	}
 }
+
+// recordLoginLog 记录一次登录尝试，reason 为空表示登录成功
+func recordLoginLog(db *gorm.DB, c *gin.Context, userID uint, username, reason string) {
+	loginLog := models.LoginLog{
+		UserID:    userID,
+		Username:  username,
+		Success:   reason == "",
+		Reason:    reason,
+		IP:        c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := db.Create(&loginLog).Error; err != nil {
+		log.Printf("Failed to record login log: %v", err)
+	}
+}
@@ -0,0 +1,715 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"server/models"
+	"server/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+// ltiNonceCookie 保存LTI启动nonce的Cookie，启动时与state中的nonce比对
+const ltiNonceCookie = "lti_nonce"
+
+// ltiDeepLinkTTL 教师在LMS中选择考试的最长时间
+const ltiDeepLinkTTL = 30 * time.Minute
+
+var (
+	ltiKeyMutex sync.Mutex
+	ltiKey      *utils.LTIToolKey
+)
+
+// ltiToolKey 加载LTI工具的签名密钥，首次使用时生成并保存到系统设置
+func ltiToolKey(db *gorm.DB) (*utils.LTIToolKey, error) {
+	ltiKeyMutex.Lock()
+	defer ltiKeyMutex.Unlock()
+	if ltiKey != nil {
+		return ltiKey, nil
+	}
+
+	pemData := getSetting(db, models.SettingLTIPrivateKey)
+	if pemData == "" {
+		generated, err := utils.GenerateLTIToolKeyPEM()
+		if err != nil {
+			return nil, err
+		}
+		if err := setSetting(db, models.SettingLTIPrivateKey, generated); err != nil {
+			return nil, err
+		}
+		pemData = generated
+	}
+
+	key, err := utils.ParseLTIToolKey(pemData)
+	if err != nil {
+		return nil, err
+	}
+	ltiKey = key
+	return ltiKey, nil
+}
+
+// requireLTI 检查是否已启用LTI
+func requireLTI(c *gin.Context) bool {
+	if utils.LTI == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "LTI is not enabled"})
+		return false
+	}
+	return true
+}
+
+// GetLTIToolConfig 获取在LMS中注册本工具所需的地址
+func GetLTIToolConfig() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireLTI(c) {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"loginUrl":    utils.LTI.ToolURL + "/api/lti/login",
+			"redirectUrl": utils.LTI.LaunchURL(),
+			"launchUrl":   utils.LTI.LaunchURL(),
+			"deepLinkUrl": utils.LTI.LaunchURL(),
+			"jwksUrl":     utils.LTI.ToolURL + "/api/lti/jwks",
+		})
+	}
+}
+
+// GetLTIJWKS 公布工具的签名公钥，平台用于验证Deep Linking响应和客户端断言
+func GetLTIJWKS(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, err := ltiToolKey(db)
+		if err != nil {
+			log.Printf("Failed to load LTI tool key: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load key"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"keys": []utils.JSONWebKey{key.JWK()}})
+	}
+}
+
+// GetLTIPlatforms 获取已注册的LTI平台
+func GetLTIPlatforms(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		platforms := []models.LTIPlatform{}
+		if err := db.Order("id").Find(&platforms).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch platforms"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"platforms": platforms,
+			"total":     len(platforms),
+		})
+	}
+}
+
+// ltiPlatformRequest 注册/更新LTI平台的请求
+type ltiPlatformRequest struct {
+	Name         string `json:"name" binding:"required"`
+	Issuer       string `json:"issuer" binding:"required"`
+	ClientID     string `json:"clientId" binding:"required"`
+	DeploymentID string `json:"deploymentId"`
+	AuthLoginURL string `json:"authLoginUrl" binding:"required,url"`
+	AuthTokenURL string `json:"authTokenUrl" binding:"required,url"`
+	KeySetURL    string `json:"keySetUrl" binding:"required,url"`
+}
+
+// apply 将请求写入平台
+func (r ltiPlatformRequest) apply(platform *models.LTIPlatform) {
+	platform.Name = r.Name
+	platform.Issuer = r.Issuer
+	platform.ClientID = r.ClientID
+	platform.DeploymentID = r.DeploymentID
+	platform.AuthLoginURL = r.AuthLoginURL
+	platform.AuthTokenURL = r.AuthTokenURL
+	platform.KeySetURL = r.KeySetURL
+}
+
+// CreateLTIPlatform 注册LTI平台
+func CreateLTIPlatform(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request ltiPlatformRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid platform data"})
+			return
+		}
+
+		var existing models.LTIPlatform
+		if err := db.Where("issuer = ? AND client_id = ?", request.Issuer, request.ClientID).First(&existing).Error; err == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Platform already registered"})
+			return
+		}
+
+		var platform models.LTIPlatform
+		request.apply(&platform)
+		if err := db.Create(&platform).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create platform"})
+			return
+		}
+		recordAudit(db, c, models.AuditLTIPlatformCreate, "lti_platform", platform.ID, nil, platform)
+
+		c.JSON(http.StatusCreated, gin.H{
+			"platform": platform,
+			"message":  "Platform created successfully",
+		})
+	}
+}
+
+// UpdateLTIPlatform 更新LTI平台
+func UpdateLTIPlatform(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var platform models.LTIPlatform
+		if err := db.First(&platform, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Platform not found"})
+			return
+		}
+
+		var request ltiPlatformRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid platform data"})
+			return
+		}
+
+		var existing models.LTIPlatform
+		if err := db.Where("issuer = ? AND client_id = ? AND id <> ?", request.Issuer, request.ClientID, platform.ID).
+			First(&existing).Error; err == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Platform already registered"})
+			return
+		}
+
+		before := platform
+		request.apply(&platform)
+		if err := db.Save(&platform).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update platform"})
+			return
+		}
+		recordAudit(db, c, models.AuditLTIPlatformUpdate, "lti_platform", platform.ID, before, platform)
+
+		c.JSON(http.StatusOK, gin.H{
+			"platform": platform,
+			"message":  "Platform updated successfully",
+		})
+	}
+}
+
+// DeleteLTIPlatform 删除LTI平台及其资源链接
+func DeleteLTIPlatform(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var platform models.LTIPlatform
+		if err := db.First(&platform, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Platform not found"})
+			return
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("platform_id = ?", platform.ID).Delete(&models.LTIResourceLink{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("platform_id = ?", platform.ID).Delete(&models.LTIDeepLinkRequest{}).Error; err != nil {
+				return err
+			}
+			return tx.Unscoped().Delete(&platform).Error
+		}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete platform"})
+			return
+		}
+		recordAudit(db, c, models.AuditLTIPlatformDelete, "lti_platform", platform.ID, platform, nil)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Platform deleted successfully"})
+	}
+}
+
+// LTILogin LTI第三方登录发起：平台跳转到此地址，工具再跳转回平台完成OIDC认证
+func LTILogin(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireLTI(c) {
+			return
+		}
+
+		issuer := c.Request.FormValue("iss")
+		loginHint := c.Request.FormValue("login_hint")
+		if issuer == "" || loginHint == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid login request"})
+			return
+		}
+
+		query := db.Where("issuer = ?", issuer)
+		if clientID := c.Request.FormValue("client_id"); clientID != "" {
+			query = query.Where("client_id = ?", clientID)
+		}
+		var platforms []models.LTIPlatform
+		if err := query.Limit(2).Find(&platforms).Error; err != nil || len(platforms) != 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown platform"})
+			return
+		}
+		platform := platforms[0]
+
+		nonce, err := utils.RandomToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start launch"})
+			return
+		}
+		state, err := utils.GenerateStateToken(utils.TokenTypeLTIState, nonce, platform.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start launch"})
+			return
+		}
+
+		params := url.Values{
+			"scope":         {"openid"},
+			"response_type": {"id_token"},
+			"response_mode": {"form_post"},
+			"prompt":        {"none"},
+			"client_id":     {platform.ClientID},
+			"redirect_uri":  {utils.LTI.LaunchURL()},
+			"login_hint":    {loginHint},
+			"state":         {state},
+			"nonce":         {nonce},
+		}
+		if messageHint := c.Request.FormValue("lti_message_hint"); messageHint != "" {
+			params.Set("lti_message_hint", messageHint)
+		}
+		separator := "?"
+		if strings.Contains(platform.AuthLoginURL, "?") {
+			separator = "&"
+		}
+
+		// 工具通常嵌入在LMS的iframe中，HTTPS下需要 SameSite=None 才能在启动时带上Cookie
+		if c.Request.TLS != nil {
+			c.SetSameSite(http.SameSiteNoneMode)
+		} else {
+			c.SetSameSite(http.SameSiteLaxMode)
+		}
+		c.SetCookie(ltiNonceCookie, nonce, 600, "/api/lti", "", c.Request.TLS != nil, true)
+		c.Redirect(http.StatusFound, platform.AuthLoginURL+separator+params.Encode())
+	}
+}
+
+// LTILaunch 处理平台提交的id_token：资源链接启动进入考试，Deep Linking 启动由教师选择考试
+func LTILaunch(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireLTI(c) {
+			return
+		}
+
+		state, err := utils.ParseChallengeToken(c.PostForm("state"), utils.TokenTypeLTIState)
+		nonce, _ := c.Cookie(ltiNonceCookie)
+		if err != nil || nonce == "" || nonce != state.ID {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid state"})
+			return
+		}
+		c.SetCookie(ltiNonceCookie, "", -1, "/api/lti", "", c.Request.TLS != nil, true)
+
+		var platform models.LTIPlatform
+		if err := db.First(&platform, state.UserID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown platform"})
+			return
+		}
+
+		claims, err := utils.ParseLTIToken(c.Request.Context(), c.PostForm("id_token"), platform.KeySetURL, platform.Issuer, platform.ClientID)
+		if err != nil {
+			log.Printf("LTI launch from %s rejected: %v", platform.Issuer, err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid id_token"})
+			return
+		}
+		if claimString(claims, "nonce") != nonce {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid nonce"})
+			return
+		}
+		if claimString(claims, utils.LTIClaimVersion) != "1.3.0" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported LTI version"})
+			return
+		}
+		deploymentID := claimString(claims, utils.LTIClaimDeploymentID)
+		if platform.DeploymentID != "" && deploymentID != platform.DeploymentID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Unknown deployment"})
+			return
+		}
+
+		user, err := ltiUser(db, platform, claims)
+		if err != nil {
+			log.Printf("Failed to provision LTI user from %s: %v", platform.Issuer, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create account"})
+			return
+		}
+		if rejectLockedUser(db, c, user) || rejectDisabledUser(db, c, user) {
+			return
+		}
+
+		switch claimString(claims, utils.LTIClaimMessageType) {
+		case utils.LTIMessageDeepLinking:
+			if user.Role != 2 { // 2: teacher
+				c.JSON(http.StatusForbidden, gin.H{"error": "Only instructors can select exams"})
+				return
+			}
+			settings := claimMap(claims, utils.LTIClaimDeepLinkSettings)
+			returnURL, _ := settings["deep_link_return_url"].(string)
+			if returnURL == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Missing deep_link_return_url"})
+				return
+			}
+			data, _ := settings["data"].(string)
+
+			request := models.LTIDeepLinkRequest{
+				PlatformID:   platform.ID,
+				UserID:       user.ID,
+				DeploymentID: deploymentID,
+				ReturnURL:    returnURL,
+				Data:         data,
+				ExpiresAt:    time.Now().Add(ltiDeepLinkTTL),
+			}
+			if err := db.Create(&request).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start deep linking"})
+				return
+			}
+			completeLTILaunch(db, c, user, url.Values{"deepLinkId": {strconv.FormatUint(uint64(request.ID), 10)}})
+
+		case utils.LTIMessageResourceLink:
+			assignment, ok := ltiResourceLinkAssignment(db, c, platform, claims)
+			if !ok {
+				return
+			}
+
+			// 学生需要已经在考试所在的班级中（由管理员分班，启动时不会自动加入班级）
+			if user.Role == 1 && user.ClassId != int(assignment.ClassID) { // 1: student
+				c.JSON(http.StatusForbidden, gin.H{"error": "Not enrolled in this class"})
+				return
+			}
+			completeLTILaunch(db, c, user, url.Values{"assignmentId": {strconv.FormatUint(uint64(assignment.ID), 10)}})
+
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported message type"})
+		}
+	}
+}
+
+// ltiUser 按平台用户ID查找账号，首次启动时创建（教师角色对应教师账号，其他为学生）
+func ltiUser(db *gorm.DB, platform models.LTIPlatform, claims jwt.MapClaims) (models.User, error) {
+	var user models.User
+	subject := claimString(claims, "sub")
+
+	var identity models.UserIdentity
+	if err := db.Where("provider = ? AND issuer = ? AND subject = ?", models.IdentityProviderLTI, platform.Issuer, subject).
+		First(&identity).Error; err == nil {
+		if err := db.First(&user, identity.UserID).Error; err == nil {
+			return user, nil
+		}
+		// 关联的用户已删除，重新创建
+		db.Delete(&identity)
+	}
+
+	var role byte = 1 // 1: student
+	if ltiIsInstructor(claims) {
+		role = 2 // 2: teacher
+	}
+	name := claimString(claims, "name")
+	if name == "" {
+		name = strings.TrimSpace(claimString(claims, "family_name") + claimString(claims, "given_name"))
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		passwordHash, err := randomPasswordHash()
+		if err != nil {
+			return err
+		}
+		user = models.User{
+			Username:       "lti_" + strconv.FormatUint(uint64(platform.ID), 10) + "_" + subject,
+			Password:       passwordHash,
+			RandomPassword: true,
+			Role:           role,
+			Name:           name,
+			Status:         1,
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if role == 2 {
+			if err := assignRoles(tx, &user, []string{models.RoleTeacher}); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: models.IdentityProviderLTI,
+			Issuer:   platform.Issuer,
+			Subject:  subject,
+			Username: claimString(claims, "email"),
+		}).Error
+	})
+	return user, err
+}
+
+// ltiIsInstructor 判断启动用户在LMS课程中是否为教师或管理员
+func ltiIsInstructor(claims jwt.MapClaims) bool {
+	roles, _ := claims[utils.LTIClaimRoles].([]interface{})
+	for _, role := range roles {
+		value, _ := role.(string)
+		if strings.HasSuffix(value, "#Instructor") || strings.HasSuffix(value, "#Administrator") {
+			return true
+		}
+	}
+	return false
+}
+
+// ltiResourceLinkAssignment 查找资源链接对应的考试安排，首次启动时按 Deep Linking 签发给该平台的 link_token 建立对应关系
+func ltiResourceLinkAssignment(db *gorm.DB, c *gin.Context, platform models.LTIPlatform, claims jwt.MapClaims) (models.ExamAssignment, bool) {
+	var assignment models.ExamAssignment
+	resourceLinkID, _ := claimMap(claims, utils.LTIClaimResourceLink)["id"].(string)
+	if resourceLinkID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing resource link"})
+		return assignment, false
+	}
+	lineItemURL, _ := claimMap(claims, utils.LTIClaimAGSEndpoint)["lineitem"].(string)
+
+	var link models.LTIResourceLink
+	if err := db.Where("platform_id = ? AND resource_link_id = ?", platform.ID, resourceLinkID).First(&link).Error; err != nil {
+		// 只接受本工具签发给同一平台的 Token，不能直接在自定义参数中填写考试安排ID
+		token := claimString(claimMap(claims, utils.LTIClaimCustom), "link_token")
+		var item models.LTIDeepLinkItem
+		if token == "" || db.Where("platform_id = ? AND token = ?", platform.ID, token).First(&item).Error != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Resource link is not associated with an exam"})
+			return assignment, false
+		}
+		link = models.LTIResourceLink{
+			PlatformID:       platform.ID,
+			ResourceLinkID:   resourceLinkID,
+			ExamAssignmentID: item.ExamAssignmentID,
+			LineItemURL:      lineItemURL,
+		}
+		if err := db.Create(&link).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save resource link"})
+			return assignment, false
+		}
+	} else if lineItemURL != "" && lineItemURL != link.LineItemURL {
+		db.Model(&link).Update("line_item_url", lineItemURL)
+	}
+
+	if err := db.First(&assignment, link.ExamAssignmentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam assignment not found"})
+		return assignment, false
+	}
+	return assignment, true
+}
+
+// completeLTILaunch 签发令牌并跳转到前端，令牌放在URL片段中避免出现在服务器日志里
+func completeLTILaunch(db *gorm.DB, c *gin.Context, user models.User, values url.Values) {
+	// 教师账号仍需完成两步验证
+	challengeType := ""
+	if user.Role == 2 { // 2: teacher
+		if user.TwoFactorEnabled {
+			challengeType = utils.TokenTypeTwoFactor
+		} else if getSetting(db, models.SettingRequireTeacher2FA) == "true" {
+			challengeType = utils.TokenTypeTwoFactorSetup
+		}
+	}
+
+	if challengeType != "" {
+		challengeToken, err := utils.GenerateChallengeToken(user.ID, challengeType)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		values.Set("challengeToken", challengeToken)
+		if challengeType == utils.TokenTypeTwoFactorSetup {
+			values.Set("twoFactorSetupRequired", "true")
+		} else {
+			values.Set("twoFactorRequired", "true")
+		}
+	} else {
+		recordLoginLog(db, c, user.ID, user.Username, "")
+		tokens, err := createSession(db, c, user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		values.Set("token", tokens["token"].(string))
+		values.Set("refreshToken", tokens["refreshToken"].(string))
+		values.Set("expiresIn", strconv.Itoa(tokens["expiresIn"].(int)))
+	}
+	values.Set("role", strconv.Itoa(int(user.Role)))
+
+	c.Redirect(http.StatusFound, utils.LTI.FrontendURL+"/lti/launch#"+values.Encode())
+}
+
+// CompleteLTIDeepLink 教师选择考试安排后生成签名的 Deep Linking 响应，由前端以表单提交到LMS
+func CompleteLTIDeepLink(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireLTI(c) {
+			return
+		}
+
+		var request models.LTIDeepLinkRequest
+		if err := db.Where("id = ? AND user_id = ? AND expires_at > ?", c.Param("id"), currentUserID(c), time.Now()).
+			First(&request).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Deep linking request not found or expired"})
+			return
+		}
+
+		var body struct {
+			AssignmentIDs []uint `json:"assignmentIds"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		var platform models.LTIPlatform
+		if err := db.First(&platform, request.PlatformID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Platform not found"})
+			return
+		}
+
+		// 只能选择自己可以访问的考试安排
+		ids, all := accessibleAssignmentIDs(db, c)
+		contentItems := []gin.H{}
+		for _, id := range body.AssignmentIDs {
+			if !all && !containsID(ids, id) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "No permission to access this assignment"})
+				return
+			}
+			var assignment models.ExamAssignment
+			if err := db.Preload("Exam").Preload("Class").First(&assignment, id).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Exam assignment not found"})
+				return
+			}
+
+			// 签发给该平台的 Token，资源链接首次启动时据此绑定考试安排
+			token, err := utils.RandomToken()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign response"})
+				return
+			}
+			if err := db.Create(&models.LTIDeepLinkItem{
+				PlatformID:       platform.ID,
+				ExamAssignmentID: assignment.ID,
+				Token:            token,
+				CreatedBy:        currentUserID(c),
+			}).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save content item"})
+				return
+			}
+
+			title := assignment.Exam.Title + " - " + assignment.Class.Name
+			contentItems = append(contentItems, gin.H{
+				"type":   "ltiResourceLink",
+				"title":  title,
+				"text":   assignment.Description,
+				"url":    utils.LTI.LaunchURL(),
+				"custom": gin.H{"link_token": token},
+				"lineItem": gin.H{
+					"scoreMaximum": assignment.Exam.TotalScore,
+					"label":        title,
+					"resourceId":   "assignment-" + strconv.FormatUint(uint64(assignment.ID), 10),
+				},
+			})
+		}
+
+		key, err := ltiToolKey(db)
+		if err != nil {
+			log.Printf("Failed to load LTI tool key: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load key"})
+			return
+		}
+		nonce, err := utils.RandomToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign response"})
+			return
+		}
+
+		now := time.Now()
+		claims := jwt.MapClaims{
+			"iss":                      platform.ClientID,
+			"aud":                      platform.Issuer,
+			"iat":                      now.Unix(),
+			"exp":                      now.Add(5 * time.Minute).Unix(),
+			"nonce":                    nonce,
+			utils.LTIClaimMessageType:  utils.LTIMessageDeepLinkingResp,
+			utils.LTIClaimVersion:      "1.3.0",
+			utils.LTIClaimDeploymentID: request.DeploymentID,
+			utils.LTIClaimContentItems: contentItems,
+		}
+		if request.Data != "" {
+			claims[utils.LTIClaimDeepLinkData] = request.Data
+		}
+		signed, err := key.Sign(claims)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign response"})
+			return
+		}
+
+		db.Delete(&request)
+
+		c.JSON(http.StatusOK, gin.H{
+			"returnUrl": request.ReturnURL,
+			"jwt":       signed,
+		})
+	}
+}
+
+// publishLTIScore 将考试成绩回传到LMS成绩册（通过LTI启动的学生才会回传，成绩公布前不回传）
+func publishLTIScore(db *gorm.DB, resultID uint) {
+	var result models.ExamResult
+	if err := db.Preload("ExamAssignment.Exam").First(&result, resultID).Error; err != nil {
+		return
+	}
+	// 成绩公布后才回传
+	if !resultsReleased(result.ExamAssignment) {
+		return
+	}
+
+	var links []models.LTIResourceLink
+	db.Where("exam_assignment_id = ? AND line_item_url <> ''", result.ExamAssignmentID).Find(&links)
+	if len(links) == 0 {
+		return
+	}
+
+	key, err := ltiToolKey(db)
+	if err != nil {
+		log.Printf("Failed to load LTI tool key: %v", err)
+		return
+	}
+
+	for _, link := range links {
+		var platform models.LTIPlatform
+		if err := db.First(&platform, link.PlatformID).Error; err != nil {
+			continue
+		}
+		var identity models.UserIdentity
+		if err := db.Where("user_id = ? AND provider = ? AND issuer = ?", result.StudentID, models.IdentityProviderLTI, platform.Issuer).
+			First(&identity).Error; err != nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		accessToken, err := utils.FetchLTIAccessToken(ctx, key, platform.AuthTokenURL, platform.ClientID, utils.LTIScopeScore)
+		if err == nil {
+			err = utils.PostLTIScore(ctx, link.LineItemURL, accessToken, utils.LTIScore{
+				UserID:           identity.Subject,
+				ScoreGiven:       float64(result.Score),
+				ScoreMaximum:     float64(result.ExamAssignment.Exam.TotalScore),
+				ActivityProgress: "Completed",
+				GradingProgress:  "FullyGraded",
+				Timestamp:        time.Now().Format(time.RFC3339),
+			})
+		}
+		cancel()
+		if err != nil {
+			log.Printf("Failed to publish score of result %d to %s: %v", result.ID, platform.Issuer, err)
+		}
+	}
+}
+
+// claimMap 读取对象类型的声明
+func claimMap(claims map[string]interface{}, name string) map[string]interface{} {
+	value, _ := claims[name].(map[string]interface{})
+	return value
+}
@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"server/middlewares"
+	"server/models"
+	"server/utils"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+// ltiPlatformSim 模拟的LMS平台：公布JWKS，签发 id_token，并验证工具返回的 Deep Linking 响应
+type ltiPlatformSim struct {
+	t        *testing.T
+	key      *rsa.PrivateKey
+	server   *httptest.Server
+	platform models.LTIPlatform
+}
+
+func newLTIPlatformSim(t *testing.T, db *gorm.DB, issuer string) *ltiPlatformSim {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := &ltiPlatformSim{t: t, key: key}
+	sim.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(gin.H{"keys": []utils.JSONWebKey{utils.RSAPublicJWK(&key.PublicKey, "platform-key")}})
+	}))
+	t.Cleanup(sim.server.Close)
+
+	sim.platform = models.LTIPlatform{
+		Name:         issuer,
+		Issuer:       issuer,
+		ClientID:     "tool-client",
+		DeploymentID: "deployment-1",
+		AuthLoginURL: issuer + "/auth",
+		AuthTokenURL: issuer + "/token",
+		KeySetURL:    sim.server.URL + "/jwks",
+	}
+	if err := db.Create(&sim.platform).Error; err != nil {
+		t.Fatal(err)
+	}
+	return sim
+}
+
+// launch 完成一次LTI启动：第三方登录发起、平台认证（签发 id_token）、提交到工具的启动地址
+func (p *ltiPlatformSim) launch(router http.Handler, subject string, claims jwt.MapClaims) *httptest.ResponseRecorder {
+	p.t.Helper()
+	login := doRequest(router, http.MethodGet, "/api/lti/login?"+url.Values{
+		"iss":        {p.platform.Issuer},
+		"login_hint": {subject},
+		"client_id":  {p.platform.ClientID},
+	}.Encode(), nil, "")
+	if login.Code != http.StatusFound {
+		p.t.Fatalf("login: status %d: %s", login.Code, login.Body.String())
+	}
+	location, err := url.Parse(login.Header().Get("Location"))
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	params := location.Query()
+
+	now := time.Now()
+	idClaims := jwt.MapClaims{
+		"iss":                      p.platform.Issuer,
+		"aud":                      p.platform.ClientID,
+		"sub":                      subject,
+		"iat":                      now.Unix(),
+		"exp":                      now.Add(5 * time.Minute).Unix(),
+		"nonce":                    params.Get("nonce"),
+		utils.LTIClaimVersion:      "1.3.0",
+		utils.LTIClaimDeploymentID: p.platform.DeploymentID,
+	}
+	for name, value := range claims {
+		idClaims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, idClaims)
+	token.Header["kid"] = "platform-key"
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	form := url.Values{"state": {params.Get("state")}, "id_token": {idToken}}
+	req := httptest.NewRequest(http.MethodPost, "/api/lti/launch", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range login.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// resourceLinkClaims 资源链接启动的声明
+func resourceLinkClaims(resourceLinkID string, custom gin.H, roles ...string) jwt.MapClaims {
+	return jwt.MapClaims{
+		utils.LTIClaimMessageType:  utils.LTIMessageResourceLink,
+		utils.LTIClaimResourceLink: gin.H{"id": resourceLinkID},
+		utils.LTIClaimCustom:       custom,
+		utils.LTIClaimRoles:        roles,
+	}
+}
+
+// launchFragment 启动成功时跳转到前端，返回URL片段中的参数
+func launchFragment(t *testing.T, w *httptest.ResponseRecorder) url.Values {
+	t.Helper()
+	if w.Code != http.StatusFound {
+		t.Fatalf("launch: status %d: %s", w.Code, w.Body.String())
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := url.ParseQuery(location.Fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func newLTIRouter(t *testing.T, db *gorm.DB) *gin.Engine {
+	t.Helper()
+	previous := utils.LTI
+	utils.LTI = &utils.LTIConfig{ToolURL: "https://tool.example.edu", FrontendURL: "https://exam.example.edu"}
+	t.Cleanup(func() { utils.LTI = previous })
+
+	r := gin.New()
+	lti := r.Group("/api/lti")
+	lti.GET("/login", LTILogin(db))
+	lti.POST("/launch", LTILaunch(db))
+	lti.GET("/jwks", GetLTIJWKS(db))
+	lti.POST("/deep-link/:id", middlewares.AuthMiddleware(db), middlewares.TeacherAuthMiddleware(), CompleteLTIDeepLink(db))
+	return r
+}
+
+// ltiFixture 一名教师的班级和考试安排
+func ltiFixture(t *testing.T, db *gorm.DB, teacherID uint) (models.Class, models.ExamAssignment) {
+	t.Helper()
+	class := models.Class{Name: "Class " + t.Name(), Major: "CS", TeacherID: teacherID}
+	exam := models.Exam{Title: "Midterm", TotalScore: 100, Status: "published", CreatedBy: teacherID}
+	if err := db.Create(&class).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&exam).Error; err != nil {
+		t.Fatal(err)
+	}
+	assignment := models.ExamAssignment{ExamID: exam.ID, ClassID: class.ID, StartTime: "2026-01-01 00:00:00",
+		EndTime: "2099-01-01 00:00:00", Duration: 60, PassScore: 60}
+	if err := db.Create(&assignment).Error; err != nil {
+		t.Fatal(err)
+	}
+	return class, assignment
+}
+
+// ltiSeedAccount 创建已关联平台用户的账号，相当于之前启动过一次
+func ltiSeedAccount(t *testing.T, db *gorm.DB, platform models.LTIPlatform, subject string, role byte, classID uint) models.User {
+	t.Helper()
+	user := models.User{Username: "lti_" + subject, Password: "x", Role: role, Name: subject, Status: 1, ClassId: int(classID)}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if role == 2 { // 2: teacher
+		if err := assignRoles(db, &user, []string{models.RoleTeacher}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Create(&models.UserIdentity{UserID: user.ID, Provider: models.IdentityProviderLTI,
+		Issuer: platform.Issuer, Subject: subject}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// ltiAccount 平台用户在本系统中的账号
+func ltiAccount(t *testing.T, db *gorm.DB, platform models.LTIPlatform, subject string) models.User {
+	t.Helper()
+	var identity models.UserIdentity
+	if err := db.Where("provider = ? AND issuer = ? AND subject = ?", models.IdentityProviderLTI, platform.Issuer, subject).
+		First(&identity).Error; err != nil {
+		t.Fatalf("identity for %s not found: %v", subject, err)
+	}
+	var user models.User
+	if err := db.First(&user, identity.UserID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// deepLink 教师通过 Deep Linking 选择考试安排，返回平台收到的内容项中的 link_token
+func deepLink(t *testing.T, router http.Handler, db *gorm.DB, sim *ltiPlatformSim, teacherSubject string, assignmentID uint) string {
+	t.Helper()
+	values := launchFragment(t, sim.launch(router, teacherSubject, jwt.MapClaims{
+		utils.LTIClaimMessageType:      utils.LTIMessageDeepLinking,
+		utils.LTIClaimRoles:            []string{"http://purl.imsglobal.org/vocab/lis/v2/membership#Instructor"},
+		utils.LTIClaimDeepLinkSettings: gin.H{"deep_link_return_url": sim.platform.Issuer + "/return"},
+	}))
+	if values.Get("deepLinkId") == "" || values.Get("token") == "" {
+		t.Fatalf("deep linking launch missing parameters: %v", values)
+	}
+
+	w := doRequest(router, http.MethodPost, "/api/lti/deep-link/"+values.Get("deepLinkId"),
+		gin.H{"assignmentIds": []uint{assignmentID}}, values.Get("token"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("deep link: status %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		JWT string `json:"jwt"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	// 平台使用工具公布的公钥验证响应
+	key, err := ltiToolKey(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(response.JWT, claims, func(*jwt.Token) (interface{}, error) {
+		return &key.Key.PublicKey, nil
+	}); err != nil {
+		t.Fatalf("deep linking response signature: %v", err)
+	}
+	items, _ := claims[utils.LTIClaimContentItems].([]interface{})
+	if len(items) != 1 {
+		t.Fatalf("expected 1 content item, got %v", claims[utils.LTIClaimContentItems])
+	}
+	custom, _ := items[0].(map[string]interface{})["custom"].(map[string]interface{})
+	if _, ok := custom["assignment_id"]; ok {
+		t.Fatalf("content item exposes assignment_id: %v", custom)
+	}
+	token, _ := custom["link_token"].(string)
+	if token == "" {
+		t.Fatalf("content item missing link_token: %v", custom)
+	}
+	return token
+}
+
+func TestLTIDeepLinkThenResourceLinkLaunch(t *testing.T) {
+	db := newTestDB(t)
+	router := newLTIRouter(t, db)
+	sim := newLTIPlatformSim(t, db, "https://lms.example.edu")
+
+	teacher := ltiSeedAccount(t, db, sim.platform, "teacher-1", 2, 0) // 2: teacher
+	class, assignment := ltiFixture(t, db, teacher.ID)
+	linkToken := deepLink(t, router, db, sim, "teacher-1", assignment.ID)
+
+	// 学生已由管理员分班
+	ltiSeedAccount(t, db, sim.platform, "student-1", 1, class.ID) // 1: student
+
+	values := launchFragment(t, sim.launch(router, "student-1", resourceLinkClaims("link-1", gin.H{"link_token": linkToken})))
+	if values.Get("assignmentId") != strconv.FormatUint(uint64(assignment.ID), 10) || values.Get("token") == "" {
+		t.Fatalf("unexpected launch parameters: %v", values)
+	}
+
+	var link models.LTIResourceLink
+	if err := db.Where("platform_id = ? AND resource_link_id = ?", sim.platform.ID, "link-1").First(&link).Error; err != nil {
+		t.Fatalf("resource link not saved: %v", err)
+	}
+	if link.ExamAssignmentID != assignment.ID {
+		t.Fatalf("resource link bound to %d, want %d", link.ExamAssignmentID, assignment.ID)
+	}
+
+	// 已绑定的资源链接之后不再需要 link_token
+	values = launchFragment(t, sim.launch(router, "student-1", resourceLinkClaims("link-1", gin.H{})))
+	if values.Get("assignmentId") != strconv.FormatUint(uint64(assignment.ID), 10) {
+		t.Fatalf("unexpected launch parameters: %v", values)
+	}
+}
+
+func TestLTIResourceLinkRejectsUnissuedBinding(t *testing.T) {
+	db := newTestDB(t)
+	router := newLTIRouter(t, db)
+	sim := newLTIPlatformSim(t, db, "https://lms.example.edu")
+	other := newLTIPlatformSim(t, db, "https://other-lms.example.edu")
+
+	teacher := ltiSeedAccount(t, db, sim.platform, "teacher-1", 2, 0) // 2: teacher
+	_, assignment := ltiFixture(t, db, teacher.ID)
+	linkToken := deepLink(t, router, db, sim, "teacher-1", assignment.ID)
+
+	tests := []struct {
+		name   string
+		sim    *ltiPlatformSim
+		custom gin.H
+	}{
+		{"assignment id in custom parameters", sim, gin.H{"assignment_id": strconv.FormatUint(uint64(assignment.ID), 10)}},
+		{"unknown token", sim, gin.H{"link_token": "forged"}},
+		{"token issued to another platform", other, gin.H{"link_token": linkToken}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := tt.sim.launch(router, "student-x", resourceLinkClaims("link-"+tt.name, tt.custom))
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("status %d, want 404: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	var count int64
+	db.Model(&models.LTIResourceLink{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d resource links were bound", count)
+	}
+}
+
+func TestLTILaunchDoesNotEnrollStudent(t *testing.T) {
+	db := newTestDB(t)
+	router := newLTIRouter(t, db)
+	sim := newLTIPlatformSim(t, db, "https://lms.example.edu")
+
+	teacher := ltiSeedAccount(t, db, sim.platform, "teacher-1", 2, 0) // 2: teacher
+	_, assignment := ltiFixture(t, db, teacher.ID)
+	linkToken := deepLink(t, router, db, sim, "teacher-1", assignment.ID)
+
+	w := sim.launch(router, "student-1", resourceLinkClaims("link-1", gin.H{"link_token": linkToken}))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403: %s", w.Code, w.Body.String())
+	}
+	if student := ltiAccount(t, db, sim.platform, "student-1"); student.ClassId != 0 {
+		t.Fatalf("student was placed in class %d", student.ClassId)
+	}
+}
+
+func TestLTILaunchRejectsInvalidSignature(t *testing.T) {
+	db := newTestDB(t)
+	router := newLTIRouter(t, db)
+	sim := newLTIPlatformSim(t, db, "https://lms.example.edu")
+
+	// 使用不在平台JWKS中的密钥签名
+	forger, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.key = forger
+	w := sim.launch(router, "student-1", resourceLinkClaims("link-1", gin.H{}))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401: %s", w.Code, w.Body.String())
+	}
+}
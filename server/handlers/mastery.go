@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"net/http"
+	"server/models"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// masteryDecay 掌握度的衰减系数：每出现一次更新的考试，之前考试结果的权重乘以该系数，越近的考试权重越大
+const masteryDecay = 0.7
+
+// 掌握程度，按 tagStrongPercent、tagWeakPercent 划分
+const (
+	masteryMastered   = "mastered"
+	masteryDeveloping = "developing"
+	masteryWeak       = "weak"
+)
+
+// tagMastery 学生对一个知识点的掌握度
+type tagMastery struct {
+	Tag         string    `json:"tag"`
+	Mastery     float64   `json:"mastery"` // 各次考试得分率按时间加权的平均（0-100）
+	Level       string    `json:"level"`
+	Exams       int       `json:"exams"`     // 考查过该知识点的答卷数
+	Questions   int       `json:"questions"` // 作答过的该知识点题目数
+	LastPercent float64   `json:"lastPercent"`
+	LastSeen    time.Time `json:"lastSeen"`
+
+	weighted float64
+	weights  float64
+}
+
+// masteryLevel 按掌握度划分掌握程度
+func masteryLevel(mastery float64) string {
+	switch {
+	case mastery >= tagStrongPercent:
+		return masteryMastered
+	case mastery < tagWeakPercent:
+		return masteryWeak
+	}
+	return masteryDeveloping
+}
+
+// buildMastery 按答卷中每道题的得分计算学生对各知识点的掌握度
+//
+// 每份答卷先算出各知识点的得分率，再按提交时间指数加权：每有一份更新的答卷考查该知识点，之前的权重乘以 masteryDecay。
+// 重考的答卷也计入。releasedOnly 为 true 时只使用已公布的成绩。返回结果按掌握度从低到高排列
+func buildMastery(db *gorm.DB, studentIDs []uint, releasedOnly bool) (map[uint][]tagMastery, error) {
+	masteries := map[uint][]tagMastery{}
+	if len(studentIDs) == 0 {
+		return masteries, nil
+	}
+
+	var results []models.ExamResult
+	if err := db.Preload("ExamAssignment").Where("student_id IN ?", studentIDs).
+		Order("created_at, id").Find(&results).Error; err != nil {
+		return nil, err
+	}
+	var resultIDs []uint
+	for _, result := range results {
+		resultIDs = append(resultIDs, result.ID)
+	}
+	records := loadResultAnswers(db, resultIDs)
+	tagsByQuestion := questionTags(db, records)
+
+	byStudent := map[uint]map[string]*tagMastery{}
+	for _, result := range results {
+		if releasedOnly && !resultsReleased(result.ExamAssignment) {
+			continue
+		}
+
+		// 本份答卷各知识点的得分
+		type tagScore struct{ earned, max, questions int }
+		scores := map[string]*tagScore{}
+		for questionID, record := range records[result.ID] {
+			for _, tag := range tagsByQuestion[questionID] {
+				if scores[tag] == nil {
+					scores[tag] = &tagScore{}
+				}
+				scores[tag].earned += record.AwardedPoints
+				scores[tag].max += record.MaxPoints
+				scores[tag].questions++
+			}
+		}
+
+		if byStudent[result.StudentID] == nil {
+			byStudent[result.StudentID] = map[string]*tagMastery{}
+		}
+		for tag, score := range scores {
+			if score.max <= 0 {
+				continue
+			}
+			mastery := byStudent[result.StudentID][tag]
+			if mastery == nil {
+				mastery = &tagMastery{Tag: tag}
+				byStudent[result.StudentID][tag] = mastery
+			}
+			percent := scorePercent(score.earned, score.max)
+			if percent < 0 {
+				percent = 0
+			}
+			mastery.weighted = mastery.weighted*masteryDecay + percent
+			mastery.weights = mastery.weights*masteryDecay + 1
+			mastery.Exams++
+			mastery.Questions += score.questions
+			mastery.LastPercent = roundPercent(percent)
+			mastery.LastSeen = result.CreatedAt
+		}
+	}
+
+	for _, studentID := range studentIDs {
+		list := []tagMastery{}
+		for _, mastery := range byStudent[studentID] {
+			mastery.Mastery = roundPercent(mastery.weighted / mastery.weights)
+			mastery.Level = masteryLevel(mastery.Mastery)
+			list = append(list, *mastery)
+		}
+		sort.SliceStable(list, func(i, j int) bool {
+			if list[i].Mastery != list[j].Mastery {
+				return list[i].Mastery < list[j].Mastery
+			}
+			return list[i].Tag < list[j].Tag
+		})
+		masteries[studentID] = list
+	}
+	return masteries, nil
+}
+
+// GetStudentMastery 教师查看学生各知识点的掌握度
+func GetStudentMastery(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var student models.User
+		if err := db.Where("id = ? AND role = 1", c.Param("id")).First(&student).Error; err != nil { // 1: student
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+			return
+		}
+
+		// 需要能访问学生所在的班级
+		if _, ok := requireClassAccess(db, c, student.ClassId, accessView); !ok {
+			return
+		}
+
+		masteries, err := buildMastery(db, []uint{student.ID}, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute mastery"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"studentId": student.ID,
+			"studentNo": student.StudentID,
+			"name":      student.Name,
+			"tags":      masteries[student.ID],
+		})
+	}
+}
+
+// GetMyMastery 学生查看自己各知识点的掌握度（只使用已公布的成绩）
+func GetMyMastery(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		studentID := currentUserID(c)
+		masteries, err := buildMastery(db, []uint{studentID}, true)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute mastery"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tags": masteries[studentID]})
+	}
+}
+
+// GetClassMastery 班级各知识点的掌握情况，按平均掌握度从低到高排列，列出未掌握的学生
+func GetClassMastery(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := requireClassAccess(db, c, c.Param("id"), accessView)
+		if !ok {
+			return
+		}
+
+		var students []models.User
+		if err := db.Where("class_id = ? AND role = 1", class.ID).Order("student_id, id").Find(&students).Error; err != nil { // 1: student
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch students"})
+			return
+		}
+		studentIDs := make([]uint, len(students))
+		for i, student := range students {
+			studentIDs[i] = student.ID
+		}
+
+		masteries, err := buildMastery(db, studentIDs, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute mastery"})
+			return
+		}
+
+		type classTag struct {
+			Tag            string  `json:"tag"`
+			AverageMastery float64 `json:"averageMastery"`
+			Level          string  `json:"level"`
+			Students       int     `json:"students"` // 有作答记录的学生数
+			Mastered       int     `json:"mastered"`
+			Developing     int     `json:"developing"`
+			Weak           int     `json:"weak"`
+			WeakStudents   []gin.H `json:"weakStudents"`
+			sum            float64
+		}
+		byTag := map[string]*classTag{}
+		for _, student := range students {
+			for _, mastery := range masteries[student.ID] {
+				tag := byTag[mastery.Tag]
+				if tag == nil {
+					tag = &classTag{Tag: mastery.Tag, WeakStudents: []gin.H{}}
+					byTag[mastery.Tag] = tag
+				}
+				tag.Students++
+				tag.sum += mastery.Mastery
+				switch mastery.Level {
+				case masteryMastered:
+					tag.Mastered++
+				case masteryDeveloping:
+					tag.Developing++
+				default:
+					tag.Weak++
+					tag.WeakStudents = append(tag.WeakStudents, gin.H{
+						"studentId": student.ID,
+						"studentNo": student.StudentID,
+						"name":      student.Name,
+						"mastery":   mastery.Mastery,
+					})
+				}
+			}
+		}
+
+		tags := make([]classTag, 0, len(byTag))
+		for _, tag := range byTag {
+			tag.AverageMastery = roundPercent(tag.sum / float64(tag.Students))
+			tag.Level = masteryLevel(tag.AverageMastery)
+			tags = append(tags, *tag)
+		}
+		sort.SliceStable(tags, func(i, j int) bool {
+			if tags[i].AverageMastery != tags[j].AverageMastery {
+				return tags[i].AverageMastery < tags[j].AverageMastery
+			}
+			return tags[i].Tag < tags[j].Tag
+		})
+
+		// 全班平均掌握度未达到弱项线的知识点
+		notGrasped := []string{}
+		for _, tag := range tags {
+			if tag.Level == masteryWeak {
+				notGrasped = append(notGrasped, tag.Tag)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"classId":       class.ID,
+			"className":     class.Name,
+			"totalStudents": len(students),
+			"tags":          tags,
+			"notGrasped":    notGrasped,
+		})
+	}
+}
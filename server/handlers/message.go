@@ -51,6 +51,7 @@ func (s *MessageScheduler) run() {
 		select {
 		case <-s.ticker.C:
 			s.checkPendingMessages()
+			releaseClosedAssignments(s.db)
 		case <-s.stopChan:
 			return
 		}
@@ -94,7 +95,15 @@ func (s *MessageScheduler) sendMessage(msg *models.Message) {
 
 	// 根据目标类型发送消息
 	var success bool
-	if msg.TargetStudent > 0 {
+	if msg.TargetTeacher > 0 {
+		// 发送给指定教师
+		if err := SendNotification(msg.TargetTeacher, "teacher", wsMessage); err != nil {
+			log.Printf("Failed to send message to teacher %d: %v", msg.TargetTeacher, err)
+			success = false
+		} else {
+			success = true
+		}
+	} else if msg.TargetStudent > 0 {
 		// 发送给指定学生
 		if err := SendNotification(msg.TargetStudent, "student", wsMessage); err != nil {
 			log.Printf("Failed to send message to student %d: %v", msg.TargetStudent, err)
@@ -102,9 +111,20 @@ func (s *MessageScheduler) sendMessage(msg *models.Message) {
 		} else {
 			success = true
 		}
+	} else if msg.TargetClass > 0 {
+		// 发送给指定班级的学生
+		var studentIDs []uint
+		s.db.Model(&models.User{}).Where("class_id = ? AND role = 1", msg.TargetClass).Pluck("id", &studentIDs) // 1: student
+		sendToStudents(studentIDs, wsMessage)
+		success = true
 	} else if msg.TargetExam > 0 {
-		// 发送给指定考试的所有学生
-		broadcastToStudents(msg.TargetExam, wsMessage)
+		// 发送给分配了指定考试的班级的学生
+		var studentIDs []uint
+		s.db.Model(&models.User{}).
+			Where("role = 1 AND class_id IN (?)", // 1: student
+				s.db.Model(&models.ExamAssignment{}).Select("class_id").Where("exam_id = ?", msg.TargetExam)).
+			Pluck("id", &studentIDs)
+		sendToStudents(studentIDs, wsMessage)
 		success = true
 	} else {
 		// 发送给所有学生
@@ -146,6 +166,14 @@ func broadcastToAllStudents(message gin.H) {
 	}
 }
 
+// sendToStudents 发送消息给指定的在线学生
+func sendToStudents(studentIDs []uint, message gin.H) {
+	for _, studentID := range studentIDs {
+		// 学生不在线时忽略
+		SendNotification(studentID, "student", message)
+	}
+}
+
 // CreateMessage 创建消息
 func CreateMessage(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -193,10 +221,31 @@ func CreateMessage(db *gorm.DB) gin.HandlerFunc {
 			sendTime = &parsedTime
 		}
 
-		// 获取创建者ID（从JWT token中）
-		createdBy, exists := c.Get("userId")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		// 只能向可访问的班级、考试和学生发送消息
+		if req.TargetClass > 0 {
+			if _, ok := requireClassAccess(db, c, req.TargetClass, accessView); !ok {
+				return
+			}
+		}
+		if req.TargetExam > 0 {
+			if _, ok := requireExamAccess(db, c, req.TargetExam, accessView); !ok {
+				return
+			}
+		}
+		if req.TargetStudent > 0 {
+			var student models.User
+			if err := db.Where("id = ? AND role = 1", req.TargetStudent).First(&student).Error; err != nil { // 1: student
+				c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+				return
+			}
+			if !requireStudentClassAccess(db, c, student.ClassId, accessView) {
+				return
+			}
+		}
+
+		// 没有指定目标的消息会发送给所有学生，只有管理员可以发送
+		if req.TargetClass == 0 && req.TargetExam == 0 && req.TargetStudent == 0 && !hasGlobalScope(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can message all students"})
 			return
 		}
 
@@ -210,13 +259,14 @@ func CreateMessage(db *gorm.DB) gin.HandlerFunc {
 			SendMethod:    req.SendMethod,
 			SendTime:      sendTime,
 			Status:        "pending",
-			CreatedBy:     createdBy.(uint),
+			CreatedBy:     currentUserID(c),
 		}
 
 		if err := db.Create(&message).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create message"})
 			return
 		}
+		recordAudit(db, c, models.AuditMessageSend, "message", message.ID, nil, message)
 
 		// 如果是立即发送，立即发送
 		if req.SendMethod == "immediate" {
@@ -250,8 +300,8 @@ func GetMessages(db *gorm.DB) gin.HandlerFunc {
 		status := c.Query("status")
 		keyword := c.Query("keyword")
 
-		// 构建查询
-		query := db.Model(&models.Message{})
+		// 构建查询，教师只能看到自己创建的消息
+		query := db.Model(&models.Message{}).Scopes(messagesScope(c))
 
 		if messageType != "" {
 			query = query.Where("message_type = ?", messageType)
@@ -299,7 +349,7 @@ func GetMessage(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		var message models.Message
-		if err := db.First(&message, uint(id)).Error; err != nil {
+		if err := db.Scopes(messagesScope(c)).First(&message, uint(id)).Error; err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
 			return
 		}
@@ -320,7 +370,7 @@ func CancelMessage(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		var message models.Message
-		if err := db.First(&message, uint(id)).Error; err != nil {
+		if err := db.Scopes(messagesScope(c)).First(&message, uint(id)).Error; err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
 			return
 		}
@@ -335,6 +385,7 @@ func CancelMessage(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel message"})
 			return
 		}
+		recordAudit(db, c, models.AuditMessageCancel, "message", message.ID, gin.H{"status": "pending"}, gin.H{"status": "cancelled"})
 
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Message cancelled successfully",
@@ -351,10 +402,17 @@ func DeleteMessage(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if err := db.Delete(&models.Message{}, uint(id)).Error; err != nil {
+		var message models.Message
+		if err := db.Scopes(messagesScope(c)).First(&message, uint(id)).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+			return
+		}
+
+		if err := db.Delete(&message).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message"})
 			return
 		}
+		recordAudit(db, c, models.AuditMessageDelete, "message", message.ID, message, nil)
 
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Message deleted successfully",
@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"server/models"
+	"server/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+// oidcNonceCookie 保存OIDC登录nonce的Cookie，回调时与state中的nonce比对，防止登录CSRF
+const oidcNonceCookie = "oidc_nonce"
+
+var errIdentityConflict = errors.New("username already exists")
+
+// requireOIDC 检查是否已启用OIDC登录
+func requireOIDC(c *gin.Context) bool {
+	if utils.OIDC == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC login is not enabled"})
+		return false
+	}
+	return true
+}
+
+// oidcAuthURL 生成授权地址并写入nonce Cookie
+func oidcAuthURL(c *gin.Context, linkUserID uint) (string, bool) {
+	nonce, err := utils.RandomToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start OIDC login"})
+		return "", false
+	}
+	state, err := utils.GenerateStateToken(utils.TokenTypeOIDCState, nonce, linkUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start OIDC login"})
+		return "", false
+	}
+
+	authURL, err := utils.OIDCAuthCodeURL(c.Request.Context(), state, nonce)
+	if err != nil {
+		log.Printf("Failed to load OIDC provider: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return "", false
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcNonceCookie, nonce, 600, "/api/auth/oidc", "", c.Request.TLS != nil, true)
+	return authURL, true
+}
+
+// OIDCLogin 跳转到身份提供方登录
+func OIDCLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireOIDC(c) {
+			return
+		}
+
+		authURL, ok := oidcAuthURL(c, 0)
+		if !ok {
+			return
+		}
+		c.Redirect(http.StatusFound, authURL)
+	}
+}
+
+// LinkOIDCIdentity 为当前账号关联外部账号，返回授权地址，回调完成后关联
+func LinkOIDCIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireOIDC(c) {
+			return
+		}
+
+		authURL, ok := oidcAuthURL(c, currentUserID(c))
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"url": authURL})
+	}
+}
+
+// OIDCCallback 处理身份提供方回调：验证ID令牌后登录，首次登录自动创建账号；
+// state 中带有用户ID时为关联外部账号
+func OIDCCallback(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireOIDC(c) {
+			return
+		}
+
+		var request struct {
+			Code  string `json:"code" binding:"required"`
+			State string `json:"state" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		state, err := utils.ParseChallengeToken(request.State, utils.TokenTypeOIDCState)
+		nonce, _ := c.Cookie(oidcNonceCookie)
+		if err != nil || nonce == "" || nonce != state.ID {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid state"})
+			return
+		}
+		c.SetCookie(oidcNonceCookie, "", -1, "/api/auth/oidc", "", c.Request.TLS != nil, true)
+
+		claims, err := utils.OIDCExchange(c.Request.Context(), request.Code, nonce)
+		if err != nil {
+			log.Printf("OIDC login failed: %v", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "External login failed"})
+			return
+		}
+		subject := claimString(claims, "sub")
+		username := claimString(claims, utils.OIDC.UsernameClaim)
+
+		var identity models.UserIdentity
+		identityErr := db.Where("issuer = ? AND subject = ?", utils.OIDC.Issuer, subject).First(&identity).Error
+
+		if state.UserID != 0 {
+			linkOIDCIdentity(db, c, state.UserID, identity, identityErr == nil, subject, username)
+			return
+		}
+
+		var user models.User
+		if identityErr == nil {
+			if err := db.First(&user, identity.UserID).Error; err != nil {
+				// 关联的用户已删除，按首次登录处理
+				db.Delete(&identity)
+				identityErr = err
+			}
+		}
+		if identityErr != nil {
+			if user, err = provisionOIDCUser(db, claims, subject, username); err != nil {
+				if errors.Is(err, errIdentityConflict) {
+					c.JSON(http.StatusConflict, gin.H{"error": "Account already exists, sign in and link it first"})
+					return
+				}
+				log.Printf("Failed to provision OIDC user %s: %v", username, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create account"})
+				return
+			}
+		}
+
+		// 账号锁定或停用时拒绝登录
+		if rejectLockedUser(db, c, user) || rejectDisabledUser(db, c, user) {
+			return
+		}
+
+		db.Model(&models.UserIdentity{}).
+			Where("issuer = ? AND subject = ?", utils.OIDC.Issuer, subject).
+			Update("last_login_at", time.Now())
+
+		completePrimaryLogin(db, c, user)
+	}
+}
+
+// linkOIDCIdentity 将外部账号关联到已登录的用户
+func linkOIDCIdentity(db *gorm.DB, c *gin.Context, userID uint, identity models.UserIdentity, exists bool, subject, username string) {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if exists {
+		if identity.UserID != user.ID {
+			c.JSON(http.StatusConflict, gin.H{"error": "External account is already linked to another user"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "External account already linked"})
+		return
+	}
+
+	identity = models.UserIdentity{
+		UserID:   user.ID,
+		Provider: models.IdentityProviderOIDC,
+		Issuer:   utils.OIDC.Issuer,
+		Subject:  subject,
+		Username: username,
+	}
+	if err := db.Create(&identity).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link external account"})
+		return
+	}
+
+	// 回调请求未经过认证中间件，以state中的用户作为操作人记录审计日志
+	c.Set("user", gin.H{"id": user.ID, "username": user.Username})
+	recordAudit(db, c, models.AuditIdentityLink, "user", user.ID, nil, identity)
+
+	c.JSON(http.StatusOK, gin.H{
+		"identity": identity,
+		"message":  "External account linked successfully",
+	})
+}
+
+// provisionOIDCUser 外部账号首次登录：按配置以学号关联已有的学生账号，否则按声明创建新账号
+//
+// 管理员和教师账号不会自动关联，需要先用原有方式登录后在个人设置中关联外部账号
+func provisionOIDCUser(db *gorm.DB, claims jwt.MapClaims, subject, username string) (models.User, error) {
+	var user models.User
+	if username == "" {
+		return user, errors.New("missing username claim")
+	}
+
+	roleNames := oidcRoleNames(claims)
+	var role byte = 1 // 1: student
+	if len(roleNames) > 0 {
+		role = 2 // 2: teacher
+	}
+	studentID := claimString(claims, utils.OIDC.StudentIDClaim)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// 只按身份提供方签发的学号匹配学生，用户名可能由用户自行修改，不作为关联依据
+		linked := false
+		if role == 1 && studentID != "" {
+			err := tx.Where("role = 1 AND is_admin = 0 AND student_id = ?", studentID).First(&user).Error // 1: student
+			if err == nil {
+				// 已关联同一身份提供方其他外部账号的学生不再自动关联
+				var linkedCount int64
+				tx.Model(&models.UserIdentity{}).Where("user_id = ? AND issuer = ?", user.ID, utils.OIDC.Issuer).Count(&linkedCount)
+				if !utils.OIDC.LinkExisting || linkedCount > 0 {
+					return errIdentityConflict
+				}
+				linked = true
+			}
+		}
+
+		if !linked {
+			var count int64
+			tx.Model(&models.User{}).Where("username = ?", username).Count(&count)
+			if count > 0 {
+				return errIdentityConflict
+			}
+
+			passwordHash, err := randomPasswordHash()
+			if err != nil {
+				return err
+			}
+
+			user = models.User{
+				Username:       username,
+				Password:       passwordHash,
+				RandomPassword: true,
+				Role:           role,
+				Name:           claimString(claims, utils.OIDC.NameClaim),
+				StudentID:      studentID,
+				Status:         1,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			if role == 2 {
+				if err := assignRoles(tx, &user, roleNames); err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: models.IdentityProviderOIDC,
+			Issuer:   utils.OIDC.Issuer,
+			Subject:  subject,
+			Username: username,
+		}).Error
+	})
+	return user, err
+}
+
+// randomPasswordHash 外部账号使用随机密码，只能通过身份提供方登录
+func randomPasswordHash() (string, error) {
+	password, err := models.GeneratePassword()
+	if err != nil {
+		return "", err
+	}
+	return models.HashPassword(password)
+}
+
+// oidcRoleNames 按角色映射将角色声明转换为系统角色名称
+func oidcRoleNames(claims jwt.MapClaims) []string {
+	var values []string
+	switch v := claims[utils.OIDC.RoleClaim].(type) {
+	case string:
+		values = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	var roleNames []string
+	for _, value := range values {
+		if roleName, ok := utils.OIDC.RoleMapping[value]; ok {
+			roleNames = append(roleNames, roleName)
+		}
+	}
+	return uniqueStrings(roleNames)
+}
+
+// claimString 读取字符串声明（数字类型的学号等转换为字符串）
+func claimString(claims jwt.MapClaims, name string) string {
+	switch v := claims[name].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// GetIdentities 获取当前账号关联的外部账号
+func GetIdentities(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identities := []models.UserIdentity{}
+		if err := db.Where("user_id = ?", currentUserID(c)).Order("id").Find(&identities).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch identities"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"identities": identities,
+			"total":      len(identities),
+		})
+	}
+}
+
+// DeleteIdentity 取消关联外部账号
+func DeleteIdentity(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var identity models.UserIdentity
+		if err := db.Where("id = ? AND user_id = ?", c.Param("id"), currentUserID(c)).First(&identity).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+			return
+		}
+
+		if err := db.Delete(&identity).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink external account"})
+			return
+		}
+		recordAudit(db, c, models.AuditIdentityUnlink, "user", identity.UserID, identity, nil)
+
+		c.JSON(http.StatusOK, gin.H{"message": "External account unlinked successfully"})
+	}
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"server/models"
+	"server/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+// oidcProviderSim 模拟的身份提供方：发现文档、JWKS 和令牌端点，授权码由测试直接签发
+type oidcProviderSim struct {
+	t      *testing.T
+	key    *rsa.PrivateKey
+	server *httptest.Server
+
+	mu    sync.Mutex
+	codes map[string]jwt.MapClaims
+}
+
+func newOIDCProviderSim(t *testing.T, linkExisting bool) *oidcProviderSim {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &oidcProviderSim{t: t, key: key, codes: map[string]jwt.MapClaims{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(gin.H{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(gin.H{"keys": []utils.JSONWebKey{utils.RSAPublicJWK(&key.PublicKey, "idp-key")}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		claims, ok := p.codes[r.FormValue("code")]
+		delete(p.codes, r.FormValue("code"))
+		p.mu.Unlock()
+		if !ok {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "idp-key"
+		idToken, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(gin.H{"id_token": idToken, "token_type": "Bearer"})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	t.Setenv("OIDC_ISSUER", p.server.URL)
+	t.Setenv("OIDC_CLIENT_ID", "exam-client")
+	t.Setenv("OIDC_REDIRECT_URL", "https://exam.example.edu/oidc/callback")
+	if linkExisting {
+		t.Setenv("OIDC_LINK_EXISTING", "true")
+	}
+	if err := utils.LoadOIDCConfig(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { utils.OIDC = nil })
+	return p
+}
+
+// authorize 用户在身份提供方完成登录，返回回调中的授权码
+func (p *oidcProviderSim) authorize(authURL, subject string, claims jwt.MapClaims) string {
+	p.t.Helper()
+	location, err := url.Parse(authURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	now := time.Now()
+	idClaims := jwt.MapClaims{
+		"iss":   p.server.URL,
+		"aud":   "exam-client",
+		"sub":   subject,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": location.Query().Get("nonce"),
+	}
+	for name, value := range claims {
+		idClaims[name] = value
+	}
+
+	code, err := utils.RandomToken()
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.codes[code] = idClaims
+	p.mu.Unlock()
+	return code
+}
+
+// signIn 完成一次外部登录（userID 不为0时为已登录用户关联外部账号），返回回调的响应
+func (p *oidcProviderSim) signIn(router http.Handler, userID uint, subject string, claims jwt.MapClaims) *httptest.ResponseRecorder {
+	p.t.Helper()
+	var start *httptest.ResponseRecorder
+	var authURL string
+	if userID == 0 {
+		start = doRequest(router, http.MethodGet, "/api/auth/oidc/login", nil, "")
+		if start.Code != http.StatusFound {
+			p.t.Fatalf("login: status %d: %s", start.Code, start.Body.String())
+		}
+		authURL = start.Header().Get("Location")
+	} else {
+		start = doRequest(router, http.MethodPost, "/api/auth/oidc/link?user="+strconv.FormatUint(uint64(userID), 10), nil, "")
+		var body struct {
+			URL string `json:"url"`
+		}
+		if start.Code != http.StatusOK || json.Unmarshal(start.Body.Bytes(), &body) != nil {
+			p.t.Fatalf("link: status %d: %s", start.Code, start.Body.String())
+		}
+		authURL = body.URL
+	}
+
+	location, _ := url.Parse(authURL)
+	code := p.authorize(authURL, subject, claims)
+	data, _ := json.Marshal(gin.H{"code": code, "state": location.Query().Get("state")})
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/oidc/callback", strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	for _, cookie := range start.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func newOIDCRouter(db *gorm.DB) *gin.Engine {
+	r := gin.New()
+	auth := r.Group("/api/auth")
+	auth.GET("/oidc/login", OIDCLogin())
+	auth.POST("/oidc/callback", OIDCCallback(db))
+	// 关联外部账号需要登录，测试中以查询参数指定当前用户
+	auth.POST("/oidc/link", func(c *gin.Context) {
+		var user models.User
+		db.First(&user, c.Query("user"))
+		c.Set("user", gin.H{"id": user.ID, "username": user.Username})
+	}, LinkOIDCIdentity())
+	return r
+}
+
+// loginUserID 登录成功的响应中的用户ID
+func loginUserID(t *testing.T, w *httptest.ResponseRecorder) uint {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Token string `json:"token"`
+		User  struct {
+			ID uint `json:"id"`
+		} `json:"user"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Token == "" {
+		t.Fatalf("unexpected login response: %s", w.Body.String())
+	}
+	return body.User.ID
+}
+
+func TestOIDCFirstLoginCreatesStudent(t *testing.T) {
+	db := newTestDB(t)
+	idp := newOIDCProviderSim(t, true)
+	router := newOIDCRouter(db)
+
+	id := loginUserID(t, idp.signIn(router, 0, "sub-1", jwt.MapClaims{
+		"preferred_username": "alice", "name": "Alice", "student_id": "2026001",
+	}))
+	var user models.User
+	db.First(&user, id)
+	if user.Username != "alice" || user.Role != 1 || user.StudentID != "2026001" {
+		t.Fatalf("unexpected account: %+v", user)
+	}
+
+	// 再次登录使用同一账号
+	if again := loginUserID(t, idp.signIn(router, 0, "sub-1", jwt.MapClaims{"preferred_username": "alice"})); again != id {
+		t.Fatalf("second login returned user %d, want %d", again, id)
+	}
+}
+
+func TestOIDCLinksStudentByStudentID(t *testing.T) {
+	db := newTestDB(t)
+	idp := newOIDCProviderSim(t, true)
+	router := newOIDCRouter(db)
+	student := seedUser(t, db, models.User{Username: "imported-2026001", Role: 1, StudentID: "2026001"})
+
+	id := loginUserID(t, idp.signIn(router, 0, "sub-1", jwt.MapClaims{
+		"preferred_username": "alice", "student_id": "2026001",
+	}))
+	if id != student.ID {
+		t.Fatalf("logged in as %d, want imported student %d", id, student.ID)
+	}
+
+	// 学号相同但已关联其他外部账号的学生不会再被关联
+	w := idp.signIn(router, 0, "sub-2", jwt.MapClaims{"preferred_username": "mallory", "student_id": "2026001"})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status %d, want 409: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestOIDCDoesNotAutoLinkPrivilegedOrUnverifiedAccounts(t *testing.T) {
+	db := newTestDB(t)
+	idp := newOIDCProviderSim(t, true)
+	router := newOIDCRouter(db)
+	seedUser(t, db, models.User{Username: "admin", Role: 2, IsAdmin: 1})
+	seedUser(t, db, models.User{Username: "teacher", Role: 2})
+	seedUser(t, db, models.User{Username: "bob", Role: 1, StudentID: "2026002"})
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+	}{
+		{"admin username", jwt.MapClaims{"preferred_username": "admin", "roles": []string{"teacher"}}},
+		{"admin username as student", jwt.MapClaims{"preferred_username": "admin"}},
+		{"teacher username", jwt.MapClaims{"preferred_username": "teacher", "roles": []string{"teacher"}}},
+		{"student username without student id", jwt.MapClaims{"preferred_username": "bob"}},
+		{"student username with another student id", jwt.MapClaims{"preferred_username": "bob", "student_id": "2026999"}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := idp.signIn(router, 0, "attacker-"+strconv.Itoa(i), tt.claims)
+			if w.Code != http.StatusConflict {
+				t.Fatalf("status %d, want 409: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	var count int64
+	db.Model(&models.UserIdentity{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d identities were linked", count)
+	}
+}
+
+func TestOIDCLinkExistingDisabled(t *testing.T) {
+	db := newTestDB(t)
+	idp := newOIDCProviderSim(t, false)
+	router := newOIDCRouter(db)
+	seedUser(t, db, models.User{Username: "imported", Role: 1, StudentID: "2026001"})
+
+	w := idp.signIn(router, 0, "sub-1", jwt.MapClaims{"preferred_username": "alice", "student_id": "2026001"})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status %d, want 409: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestOIDCLinkFromSignedInAccount(t *testing.T) {
+	db := newTestDB(t)
+	idp := newOIDCProviderSim(t, true)
+	router := newOIDCRouter(db)
+	admin := seedUser(t, db, models.User{Username: "admin", Role: 2, IsAdmin: 1})
+
+	w := idp.signIn(router, admin.ID, "admin-sub", jwt.MapClaims{"preferred_username": "admin"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("link: status %d: %s", w.Code, w.Body.String())
+	}
+
+	// 关联后可以通过身份提供方登录
+	if id := loginUserID(t, idp.signIn(router, 0, "admin-sub", jwt.MapClaims{"preferred_username": "admin"})); id != admin.ID {
+		t.Fatalf("logged in as %d, want %d", id, admin.ID)
+	}
+}
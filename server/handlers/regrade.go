@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// regradePlan 一份答卷的重新评分结果
+type regradePlan struct {
+	change      models.RegradeChange
+	studentName string
+	records     []models.ResultAnswer // 需要保存的作答记录（ID为0时新建）
+	removed     []uint                // 题目已删除的作答记录
+}
+
+// planRegrade 按试卷当前的题目和答案重新评分所有答卷，不写入数据库
+//
+// 手动评定的题目保留教师给的分数（不超过新的满分）；通过 OverrideScore 手动修改过的总分
+// 保留保存的调整量，即按各题得分的变化量调整
+func planRegrade(db *gorm.DB, exam models.Exam) ([]regradePlan, error) {
+	var questions []models.Question
+	if err := db.Where("exam_id = ?", exam.ID).Order("id").Find(&questions).Error; err != nil {
+		return nil, err
+	}
+	var results []models.ExamResult
+	if err := db.Where("exam_assignment_id IN (?)",
+		db.Model(&models.ExamAssignment{}).Select("id").Where("exam_id = ?", exam.ID)).
+		Order("id").Find(&results).Error; err != nil {
+		return nil, err
+	}
+	records := loadResultAnswers(db, resultIDs(results))
+
+	studentIDs := make([]uint, len(results))
+	for i, result := range results {
+		studentIDs[i] = result.StudentID
+	}
+	var students []models.User
+	db.Select("id", "name").Where("id IN ?", studentIDs).Find(&students)
+	names := make(map[uint]string, len(students))
+	for _, student := range students {
+		names[student.ID] = student.Name
+	}
+
+	plans := []regradePlan{}
+	for _, result := range results {
+		existing := records[result.ID]
+		plan := regradePlan{
+			change: models.RegradeChange{
+				ExamResultID: result.ID,
+				StudentID:    result.StudentID,
+				OldScore:     result.RawScore,
+			},
+			studentName: names[result.StudentID],
+		}
+
+		newSum := 0
+		for _, question := range questions {
+			record, exists := existing[question.ID]
+			graded := gradeAnswer(question, ans{QuestionID: question.ID, Answer: record.Answer, Answers: record.BlankAnswers})
+			if record.Manual {
+				graded.AwardedPoints = record.AwardedPoints
+				if graded.AwardedPoints > question.Score {
+					graded.AwardedPoints = question.Score
+				}
+				graded.PenaltyPoints = record.PenaltyPoints
+				graded.Manual = true
+				graded.GradedBy = record.GradedBy
+			}
+			newSum += graded.AwardedPoints
+
+			if exists && graded.AwardedPoints == record.AwardedPoints && graded.PenaltyPoints == record.PenaltyPoints &&
+				graded.MaxPoints == record.MaxPoints {
+				continue
+			}
+			graded.ID = record.ID
+			graded.ExamResultID = result.ID
+			graded.CreatedAt = record.CreatedAt
+			plan.records = append(plan.records, graded)
+		}
+		for questionID, record := range existing {
+			if !containsQuestion(questions, questionID) {
+				plan.removed = append(plan.removed, record.ID)
+			}
+		}
+
+		newScore := overriddenScore(exam, newSum, result.ScoreOverride)
+		plan.change.NewScore = newScore
+
+		if len(plan.records) > 0 || len(plan.removed) > 0 || newScore != result.RawScore {
+			plans = append(plans, plan)
+		}
+	}
+	return plans, nil
+}
+
+// containsQuestion 题目是否仍在试卷中
+func containsQuestion(questions []models.Question, id uint) bool {
+	for _, question := range questions {
+		if question.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// regradeChanges 成绩发生变化的答卷
+func regradeChanges(plans []regradePlan) []gin.H {
+	changes := []gin.H{}
+	for _, plan := range plans {
+		if plan.change.NewScore == plan.change.OldScore {
+			continue
+		}
+		changes = append(changes, gin.H{
+			"resultId":    plan.change.ExamResultID,
+			"studentId":   plan.change.StudentID,
+			"studentName": plan.studentName,
+			"oldScore":    plan.change.OldScore,
+			"newScore":    plan.change.NewScore,
+			"delta":       plan.change.NewScore - plan.change.OldScore,
+		})
+	}
+	return changes
+}
+
+// PreviewRegrade 预览按当前答案重新评分后每个学生的成绩变化
+func PreviewRegrade(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exam, ok := requireExamAccess(db, c, c.Param("id"), accessEdit)
+		if !ok {
+			return
+		}
+
+		plans, err := planRegrade(db, exam)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regrade results"})
+			return
+		}
+
+		changes := regradeChanges(plans)
+		c.JSON(http.StatusOK, gin.H{
+			"examId":         exam.ID,
+			"examTitle":      exam.Title,
+			"affectedCount":  len(changes),
+			"changes":        changes,
+			"recordsChanged": len(plans),
+		})
+	}
+}
+
+// RegradeExam 按当前答案重新评分并保存，记录重新评分历史，可选通知成绩变化的学生
+func RegradeExam(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Reason string `json:"reason" binding:"required"`
+			Notify bool   `json:"notify"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Reason is required"})
+			return
+		}
+
+		exam, ok := requireExamAccess(db, c, c.Param("id"), accessEdit)
+		if !ok {
+			return
+		}
+
+		plans, err := planRegrade(db, exam)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regrade results"})
+			return
+		}
+
+		regrade := models.Regrade{
+			ExamID:    exam.ID,
+			Reason:    request.Reason,
+			Notified:  request.Notify,
+			CreatedBy: currentUserID(c),
+		}
+		for _, plan := range plans {
+			if plan.change.NewScore != plan.change.OldScore {
+				regrade.Changes = append(regrade.Changes, plan.change)
+			}
+		}
+		regrade.AffectedCount = len(regrade.Changes)
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for _, plan := range plans {
+				for i := range plan.records {
+					if err := tx.Save(&plan.records[i]).Error; err != nil {
+						return err
+					}
+				}
+				if len(plan.removed) > 0 {
+					if err := tx.Delete(&models.ResultAnswer{}, plan.removed).Error; err != nil {
+						return err
+					}
+				}
+				if plan.change.NewScore != plan.change.OldScore {
+					if _, err := setRawScore(tx, plan.change.ExamResultID, plan.change.NewScore); err != nil {
+						return err
+					}
+				}
+			}
+			return tx.Create(&regrade).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regrade results"})
+			return
+		}
+
+		recordAudit(db, c, models.AuditExamRegrade, "exam", exam.ID, nil, gin.H{
+			"regradeId":     regrade.ID,
+			"reason":        request.Reason,
+			"affectedCount": regrade.AffectedCount,
+		})
+
+		for _, change := range regrade.Changes {
+			go publishLTIScore(db, change.ExamResultID)
+			if request.Notify {
+				notifyRegrade(db, c, exam, change)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":            regrade.ID,
+			"affectedCount": regrade.AffectedCount,
+			"changes":       regradeChanges(plans),
+			"message":       "Exam regraded successfully",
+		})
+	}
+}
+
+// notifyRegrade 通过站内消息通知学生成绩变化（成绩尚未公布的不通知）
+func notifyRegrade(db *gorm.DB, c *gin.Context, exam models.Exam, change models.RegradeChange) {
+	var result models.ExamResult
+	if err := db.Preload("ExamAssignment").First(&result, change.ExamResultID).Error; err != nil || !resultsReleased(result.ExamAssignment) {
+		return
+	}
+
+	message := models.Message{
+		MessageType:   "system_notice",
+		TargetExam:    exam.ID,
+		TargetStudent: change.StudentID,
+		Title:         "成绩已更新",
+		Content:       fmt.Sprintf("《%s》的答案已更正并重新评分，你的成绩由 %d 分变为 %d 分。", exam.Title, change.OldScore, change.NewScore),
+		SendMethod:    "immediate",
+		Status:        "pending",
+		CreatedBy:     currentUserID(c),
+	}
+	if err := db.Create(&message).Error; err != nil {
+		return
+	}
+	if scheduler != nil {
+		go scheduler.sendMessage(&message)
+	}
+}
+
+// GetRegrades 获取试卷的重新评分历史
+func GetRegrades(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exam, ok := requireExamAccess(db, c, c.Param("id"), accessView)
+		if !ok {
+			return
+		}
+
+		regrades := []models.Regrade{}
+		if err := db.Preload("Changes").Where("exam_id = ?", exam.ID).Order("id DESC").Find(&regrades).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch regrades"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"regrades": regrades,
+			"total":    len(regrades),
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"server/models"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// regradeScore 修改第一题答案为 key 后重新评分，返回答卷的新成绩
+func regradeScore(t *testing.T, db *gorm.DB, f gradingFixture, key string) int {
+	t.Helper()
+	db.Model(&f.questions[0]).Update("answer", key)
+	plans, err := planRegrade(db, f.exam)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plan := range plans {
+		if plan.change.ExamResultID == f.result.ID {
+			return plan.change.NewScore
+		}
+	}
+	return loadResult(t, db, f.result.ID).RawScore
+}
+
+func TestRegradeKeepsStoredOverride(t *testing.T) {
+	tests := []struct {
+		name        string
+		floorAtZero bool
+		want        int
+	}{
+		// 各题得分之和 -5-5=-10，加上手动调整的 -5
+		{"floor off", false, -15},
+		{"floor on", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			f := newGradingFixture(t, db, tt.floorAtZero)
+			// 手动将总分从5改为0
+			db.Model(&f.result).Updates(map[string]interface{}{"raw_score": 0, "score_override": -5})
+
+			if got := regradeScore(t, db, f, "C"); got != tt.want {
+				t.Fatalf("new score %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegradeWithoutOverrideFollowsFloorSetting(t *testing.T) {
+	db := newTestDB(t)
+	f := newGradingFixture(t, db, false)
+	// 两题都答错时提交的成绩为 -10，之后试卷开启 FloorAtZero
+	db.Model(&f.questions[0]).Update("answer", "C")
+	db.Model(&models.ResultAnswer{}).Where("exam_result_id = ?", f.result.ID).Update("awarded_points", -5)
+	db.Model(&f.result).Update("raw_score", -10)
+	f.exam.FloorAtZero = true
+	db.Model(&f.exam).Update("floor_at_zero", true)
+
+	// 没有保存的调整量，不应当把与当前设置不一致的旧成绩当作手动修改
+	if got := regradeScore(t, db, f, "C"); got != 0 {
+		t.Fatalf("new score %d, want 0", got)
+	}
+}
+
+func TestGradingAndRegradeUseTheSameBound(t *testing.T) {
+	tests := []struct {
+		name       string
+		totalScore int
+		want       int
+	}{
+		// 各题满分之和为20，两题满分加上手动调整的3分为23
+		{"total below question scores", 15, 15},
+		{"total above question scores", 25, 23},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			f := newGradingFixture(t, db, false)
+			f.exam.TotalScore = tt.totalScore
+			db.Model(&f.exam).Update("total_score", tt.totalScore)
+			db.Model(&f.result).Updates(map[string]interface{}{"raw_score": 8, "score_override": 3})
+
+			router := gin.New()
+			router.PUT("/results/:id/answers/:questionId", asUser(f.teacher.ID), GradeAnswer(db))
+			w := doRequest(router, http.MethodPut, "/results/"+strconv.FormatUint(uint64(f.result.ID), 10)+
+				"/answers/"+strconv.FormatUint(uint64(f.questions[1].ID), 10), gin.H{"points": 10, "reason": "full credit"}, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("grade answer: status %d: %s", w.Code, w.Body.String())
+			}
+			if got := loadResult(t, db, f.result.ID).RawScore; got != tt.want {
+				t.Fatalf("after grading: raw %d, want %d", got, tt.want)
+			}
+
+			// 答案没有变化，重新评分得到同样的成绩
+			if got := regradeScore(t, db, f, "A"); got != tt.want {
+				t.Fatalf("after regrade: %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
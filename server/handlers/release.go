@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"server/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// resultsReleased 考试安排的成绩是否已向学生公布
+//
+// immediate（默认）提交后立即公布；after_close 在考试结束后公布；manual 在教师发布后公布。
+// after_close 也可以由教师提前发布
+func resultsReleased(assignment models.ExamAssignment) bool {
+	switch assignment.ReleasePolicy {
+	case models.ReleaseManual:
+		return assignment.ReleasedAt != nil
+	case models.ReleaseAfterClose:
+		return assignment.ReleasedAt != nil || getExamStatus(assignment.StartTime, assignment.EndTime) == "已结束"
+	}
+	return true
+}
+
+// releasePolicy 考试安排的成绩公布方式（旧数据为空时视为 immediate）
+func releasePolicy(assignment models.ExamAssignment) string {
+	if assignment.ReleasePolicy == "" {
+		return models.ReleaseImmediate
+	}
+	return assignment.ReleasePolicy
+}
+
+// validReleasePolicy 成绩公布方式是否有效（空值视为 immediate）
+func validReleasePolicy(policy string) bool {
+	switch policy {
+	case "", models.ReleaseImmediate, models.ReleaseAfterClose, models.ReleaseManual:
+		return true
+	}
+	return false
+}
+
+// publishAssignmentScores 将考试安排的所有成绩回传到LMS
+func publishAssignmentScores(db *gorm.DB, assignmentID uint) {
+	var ids []uint
+	db.Model(&models.ExamResult{}).Where("exam_assignment_id = ?", assignmentID).Pluck("id", &ids)
+	for _, id := range ids {
+		publishLTIScore(db, id)
+	}
+}
+
+// releaseClosedAssignments 考试结束后公布 after_close 的成绩，并回传到LMS
+func releaseClosedAssignments(db *gorm.DB) {
+	var assignments []models.ExamAssignment
+	if err := db.Where("release_policy = ? AND released_at IS NULL", models.ReleaseAfterClose).
+		Find(&assignments).Error; err != nil {
+		log.Printf("Failed to fetch unreleased assignments: %v", err)
+		return
+	}
+
+	for _, assignment := range assignments {
+		if !resultsReleased(assignment) {
+			continue
+		}
+		now := time.Now()
+		if err := db.Model(&assignment).Update("released_at", &now).Error; err != nil {
+			log.Printf("Failed to release results of assignment %d: %v", assignment.ID, err)
+			continue
+		}
+		go publishAssignmentScores(db, assignment.ID)
+	}
+}
+
+// ReleaseResults 向学生发布考试安排的成绩，可选通知班级学生
+func ReleaseResults(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Notify bool `json:"notify"`
+		}
+		// 请求体可选
+		c.ShouldBindJSON(&request)
+
+		var assignment models.ExamAssignment
+		if err := db.Preload("Exam").First(&assignment, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+			return
+		}
+
+		// 与阅卷、成绩调整相同，需要对分配的班级或试卷有编辑权限
+		if assignmentAccess(db, c, assignment.ID) < accessEdit {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No permission to access this assignment"})
+			return
+		}
+
+		if assignment.ReleasedAt != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Results already released"})
+			return
+		}
+
+		now := time.Now()
+		if err := db.Model(&assignment).Update("released_at", &now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release results"})
+			return
+		}
+		recordAudit(db, c, models.AuditResultRelease, "exam_assignment", assignment.ID, nil, gin.H{
+			"releasedAt": now,
+			"notify":     request.Notify,
+		})
+
+		go publishAssignmentScores(db, assignment.ID)
+		if request.Notify {
+			message := models.Message{
+				MessageType: "system_notice",
+				TargetExam:  assignment.ExamID,
+				TargetClass: assignment.ClassID,
+				Title:       "成绩已发布",
+				Content:     fmt.Sprintf("《%s》的成绩已发布，可以在考试结果中查看。", assignment.Exam.Title),
+				SendMethod:  "immediate",
+				Status:      "pending",
+				CreatedBy:   currentUserID(c),
+			}
+			if err := db.Create(&message).Error; err == nil && scheduler != nil {
+				go scheduler.sendMessage(&message)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":         assignment.ID,
+			"releasedAt": now,
+			"message":    "Results released successfully",
+		})
+	}
+}
+
+// WithholdResults 撤回已发布的成绩，after_close 的考试结束后不能撤回
+func WithholdResults(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var assignment models.ExamAssignment
+		if err := db.First(&assignment, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+			return
+		}
+
+		// 与阅卷、成绩调整相同，需要对分配的班级或试卷有编辑权限
+		if assignmentAccess(db, c, assignment.ID) < accessEdit {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No permission to access this assignment"})
+			return
+		}
+
+		if assignment.ReleasedAt == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Results not released"})
+			return
+		}
+		if assignment.ReleasePolicy == models.ReleaseAfterClose && getExamStatus(assignment.StartTime, assignment.EndTime) == "已结束" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Results are visible after the exam closes"})
+			return
+		}
+
+		before := gin.H{"releasedAt": assignment.ReleasedAt}
+		if err := db.Model(&assignment).Update("released_at", nil).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to withhold results"})
+			return
+		}
+		recordAudit(db, c, models.AuditResultWithhold, "exam_assignment", assignment.ID, before, nil)
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":      assignment.ID,
+			"message": "Results withheld successfully",
+		})
+	}
+}
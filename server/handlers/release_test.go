@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"server/models"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReleaseResultsAllowsExamEditors(t *testing.T) {
+	db := newTestDB(t)
+	f := newGradingFixture(t, db, false)
+	var assignment models.ExamAssignment
+	db.First(&assignment, f.result.ExamAssignmentID)
+	// 班级属于另一名教师，试卷所有者仍可以发布成绩
+	classTeacher := seedUser(t, db, models.User{Username: "class-teacher", Role: 2, Password: "x"})
+	db.Model(&models.Class{}).Where("id = ?", assignment.ClassID).Update("teacher_id", classTeacher.ID)
+	db.Model(&assignment).Update("release_policy", models.ReleaseManual)
+	other := seedUser(t, db, models.User{Username: "other", Role: 2, Password: "x"})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		id, _ := strconv.ParseUint(c.Query("user"), 10, 32)
+		c.Set("user", gin.H{"id": uint(id), "username": "teacher", "permissions": models.Permissions{}})
+	})
+	router.POST("/exam-assignments/:id/release", ReleaseResults(db))
+	router.POST("/exam-assignments/:id/withhold", WithholdResults(db))
+	target := func(action string, user models.User) string {
+		return "/exam-assignments/" + strconv.FormatUint(uint64(assignment.ID), 10) + "/" + action +
+			"?user=" + strconv.FormatUint(uint64(user.ID), 10)
+	}
+
+	if w := doRequest(router, http.MethodPost, target("release", other), nil, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403: %s", w.Code, w.Body.String())
+	}
+	for _, action := range []string{"release", "withhold"} {
+		if w := doRequest(router, http.MethodPost, target(action, f.teacher), nil, ""); w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", action, w.Code, w.Body.String())
+		}
+	}
+}
@@ -1,11 +1,11 @@
 package handlers
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"server/models"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -14,23 +14,26 @@ import (
 // GetResultsAnalysis 获取结果分析数据
 func GetResultsAnalysis(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 只统计当前教师可访问的数据
+		scopeResults := resultsScope(db, c)
+
 		// 获取统计信息
 		var totalExams int64
-		db.Model(&models.Exam{}).Count(&totalExams)
+		db.Model(&models.Exam{}).Scopes(examsScope(db, c)).Count(&totalExams)
 
 		var totalStudents int64
-		db.Model(&models.User{}).Where("role = 1").Count(&totalStudents) // 1: student
+		db.Model(&models.User{}).Where("role = 1").Scopes(studentsScope(db, c)).Count(&totalStudents) // 1: student
 
 		var totalResults int64
-		db.Model(&models.ExamResult{}).Count(&totalResults)
+		db.Model(&models.ExamResult{}).Scopes(scopeResults).Count(&totalResults)
 
 		// 计算平均分
 		var avgScore float64
-		db.Model(&models.ExamResult{}).Select("COALESCE(AVG(score), 0)").Scan(&avgScore)
+		db.Model(&models.ExamResult{}).Scopes(scopeResults).Select("COALESCE(AVG(score), 0)").Scan(&avgScore)
 
-		// 计算及格率
+		// 计算及格率（按各考试安排的及格分）
 		var passCount int64
-		db.Model(&models.ExamResult{}).Where("score >= 60").Count(&passCount)
+		db.Model(&models.ExamResult{}).Scopes(scopeResults, joinResultExam).Where(passCondition).Count(&passCount)
 		var passRate float64
 		if totalResults > 0 {
 			passRate = float64(passCount) / float64(totalResults) * 100
@@ -48,167 +51,322 @@ func GetResultsAnalysis(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// ExportExamReport 导出考试分析报告
-func ExportExamReport(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// 获取统计信息
-		var totalExams int64
-		db.Model(&models.Exam{}).Count(&totalExams)
-
-		var totalStudents int64
-		db.Model(&models.User{}).Where("role = 1").Count(&totalStudents) // 1: student
+// resultsAnalysisQuery 结果分析的答卷查询：关联考试安排、试卷、学生和班级，只包含可访问的答卷，
+// 按查询参数 examId、classId、scoreFilter（excellent、good、pass、fail）、keyword 过滤
+func resultsAnalysisQuery(db *gorm.DB, c *gin.Context) *gorm.DB {
+	examID := c.DefaultQuery("examId", "")
+	classID := c.DefaultQuery("classId", "")
+	scoreFilter := c.DefaultQuery("scoreFilter", "")
+	keyword := c.DefaultQuery("keyword", "")
+
+	query := db.Model(&models.ExamResult{}).
+		Joins("JOIN exam_assignments ON exam_results.exam_assignment_id = exam_assignments.id").
+		Joins("JOIN exams ON exam_assignments.exam_id = exams.id").
+		Joins("JOIN users ON exam_results.student_id = users.id").
+		Joins("JOIN classes ON users.class_id = classes.id").
+		Where("users.role = 1"). // 1: student
+		Scopes(resultsScope(db, c))
+
+	// 过滤条件
+	if examID != "" {
+		query = query.Where("exam_assignments.exam_id = ?", examID)
+	}
+	if classID != "" {
+		query = query.Where("users.class_id = ?", classID)
+	}
+	if scoreFilter != "" {
+		// 与成绩分布一致：优秀、良好按得分率，及格按考试安排的及格分
+		switch scoreFilter {
+		case "excellent":
+			query = query.Where(excellentCondition)
+		case "good":
+			query = query.Where("exam_results.score * 100 >= exams.total_score * 80").Not(excellentCondition)
+		case "pass":
+			query = query.Where(passCondition).Where("exam_results.score * 100 < exams.total_score * 80")
+		case "fail":
+			query = query.Where(failCondition)
+		}
+	}
+	if keyword != "" {
+		search := "%" + keyword + "%"
+		query = query.Where("users.name LIKE ? OR users.student_id LIKE ?", search, search)
+	}
+	return query
+}
 
-		var totalResults int64
-		db.Model(&models.ExamResult{}).Count(&totalResults)
+// examReport 考试分析报告，按结果分析的筛选条件统计
+type examReport struct {
+	Stats struct {
+		TotalExams    int64   `json:"totalExams"`
+		TotalStudents int64   `json:"totalStudents"`
+		TotalResults  int64   `json:"totalResults"`
+		AvgScore      float64 `json:"avgScore"`
+		PassRate      float64 `json:"passRate"`
+	} `json:"stats"`
+	ScoreDistribution struct {
+		Excellent int64 `json:"excellent"` // 90%以上
+		Good      int64 `json:"good"`      // 80%-90%
+		Pass      int64 `json:"pass"`      // 及格但低于80%
+		Fail      int64 `json:"fail"`      // 不及格
+	} `json:"scoreDistribution"`
+	Questions       []gin.H `json:"questions"`
+	StudentResults  []gin.H `json:"studentResults"`
+	ClassStatistics []gin.H `json:"classStatistics"`
+}
 
-		// 计算平均分
-		var avgScore float64
-		db.Model(&models.ExamResult{}).Select("COALESCE(AVG(score), 0)").Scan(&avgScore)
+// buildExamReport 统计考试分析报告的数据
+func buildExamReport(db *gorm.DB, c *gin.Context) (examReport, error) {
+	var report examReport
+	report.Questions = []gin.H{}
+	report.StudentResults = []gin.H{}
+	report.ClassStatistics = []gin.H{}
+
+	var results []models.ExamResult
+	if err := resultsAnalysisQuery(db, c).Select("exam_results.*").Preload("ExamAssignment.Exam").
+		Order("exam_results.id").Find(&results).Error; err != nil {
+		return report, err
+	}
 
-		// 计算及格率
-		var passCount int64
-		db.Model(&models.ExamResult{}).Where("score >= 60").Count(&passCount)
-		var passRate float64
-		if totalResults > 0 {
-			passRate = float64(passCount) / float64(totalResults) * 100
+	// 试卷按 examId 和 classId 过滤（分配给该班级的试卷）
+	examFilter := func(query *gorm.DB) *gorm.DB {
+		if examID := c.Query("examId"); examID != "" {
+			query = query.Where("exams.id = ?", examID)
 		}
-
-		// 获取分数段分布
-		var scoreDistribution struct {
-			Excellent int64 `json:"excellent"` // 90分以上
-			Good      int64 `json:"good"`      // 80-89分
-			Pass      int64 `json:"pass"`      // 60-79分
-			Fail      int64 `json:"fail"`      // 不及格(<60)
+		if classID := c.Query("classId"); classID != "" {
+			query = query.Where("exams.id IN (?)", db.Model(&models.ExamAssignment{}).Select("exam_id").Where("class_id = ?", classID))
 		}
+		return query
+	}
+	db.Model(&models.Exam{}).Scopes(examsScope(db, c), examFilter).Count(&report.Stats.TotalExams)
 
-		db.Model(&models.ExamResult{}).Where("score >= 90").Count(&scoreDistribution.Excellent)
-		db.Model(&models.ExamResult{}).Where("score >= 80 AND score < 90").Count(&scoreDistribution.Good)
-		db.Model(&models.ExamResult{}).Where("score >= 60 AND score < 80").Count(&scoreDistribution.Pass)
-		db.Model(&models.ExamResult{}).Where("score < 60").Count(&scoreDistribution.Fail)
+	studentQuery := db.Model(&models.User{}).Where("role = 1").Scopes(studentsScope(db, c)) // 1: student
+	if classID := c.Query("classId"); classID != "" {
+		studentQuery = studentQuery.Where("class_id = ?", classID)
+	}
+	if keyword := c.Query("keyword"); keyword != "" {
+		search := "%" + keyword + "%"
+		studentQuery = studentQuery.Where("name LIKE ? OR student_id LIKE ?", search, search)
+	}
+	studentQuery.Count(&report.Stats.TotalStudents)
 
-		// 获取题目分析
-		var questions []models.Question
-		db.Find(&questions)
+	var classes []models.Class
+	classQuery := db.Model(&models.Class{}).Scopes(classesScope(db, c))
+	if classID := c.Query("classId"); classID != "" {
+		classQuery = classQuery.Where("id = ?", classID)
+	}
+	classQuery.Find(&classes)
+	classNames := map[uint]string{}
+	for _, class := range classes {
+		classNames[class.ID] = class.Name
+	}
 
-		var questionAnalysis []gin.H
-		for _, question := range questions {
-			// 计算题目正确率
-			var totalCount int64
-			var correctCount int64
-
-			// 获取该题目相关的考试结果
-			var results []models.ExamResult
-			db.Where("exam_id = ?", question.ExamID).Find(&results)
-
-			totalCount = int64(len(results))
-
-			// 计算正确数量
-			for _, result := range results {
-				var answers []string
-				if err := json.Unmarshal([]byte(result.Answers), &answers); err == nil {
-					if len(answers) > 0 && answers[0] == question.Answer {
-						correctCount++
-					}
-				}
-			}
+	studentIDs := []uint{}
+	for _, result := range results {
+		studentIDs = append(studentIDs, result.StudentID)
+	}
+	students := map[uint]models.User{}
+	for start := 0; start < len(studentIDs); start += 500 {
+		end := start + 500
+		if end > len(studentIDs) {
+			end = len(studentIDs)
+		}
+		var batch []models.User
+		db.Where("id IN ?", studentIDs[start:end]).Find(&batch)
+		for _, student := range batch {
+			students[student.ID] = student
+		}
+	}
 
-			var correctRate float64
-			if totalCount > 0 {
-				correctRate = float64(correctCount) / float64(totalCount) * 100
-			}
+	// 成绩统计和分数段分布（按得分率：优秀90%以上，良好80%以上，其余按及格分划分）
+	type classTotals struct {
+		count, passed, excellent int64
+		score                    float64
+	}
+	byClass := map[uint]*classTotals{}
+	examResults := map[uint][]models.ExamResult{}
+	var totalScore float64
+	var passCount int64
+	for _, result := range results {
+		assignment := result.ExamAssignment
+		percent := scorePercent(result.Score, assignment.Exam.TotalScore)
+		passed := result.Score >= assignment.PassScore
+		totalScore += float64(result.Score)
+		switch {
+		case percent >= excellentPercent:
+			report.ScoreDistribution.Excellent++
+		case percent >= 80:
+			report.ScoreDistribution.Good++
+		case passed:
+			report.ScoreDistribution.Pass++
+		default:
+			report.ScoreDistribution.Fail++
+		}
+		if passed {
+			passCount++
+		}
 
-			questionAnalysis = append(questionAnalysis, gin.H{
-				"id":          question.ID,
-				"content":     question.Content,
-				"type":        question.Type,
-				"score":       question.Score,
-				"answer":      question.Answer,
-				"correctRate": correctRate,
-			})
+		student := students[result.StudentID]
+		classID := uint(student.ClassId)
+		if byClass[classID] == nil {
+			byClass[classID] = &classTotals{}
+		}
+		byClass[classID].count++
+		byClass[classID].score += float64(result.Score)
+		if passed {
+			byClass[classID].passed++
 		}
+		if percent >= excellentPercent {
+			byClass[classID].excellent++
+		}
+		examResults[assignment.ExamID] = append(examResults[assignment.ExamID], result)
+
+		report.StudentResults = append(report.StudentResults, gin.H{
+			"studentId":   student.StudentID,
+			"studentName": student.Name,
+			"classId":     student.ClassId,
+			"className":   classNames[classID],
+			"examTitle":   assignment.Exam.Title,
+			"score":       result.Score,
+			"rawScore":    result.RawScore,
+			"grade":       result.Grade,
+			"totalScore":  assignment.Exam.TotalScore,
+			"timeUsed":    result.TimeUsed,
+			"passed":      passed,
+			"submitTime":  result.CreatedAt,
+		})
+	}
+	report.Stats.TotalResults = int64(len(results))
+	if len(results) > 0 {
+		report.Stats.AvgScore = totalScore / float64(len(results))
+		report.Stats.PassRate = float64(passCount) / float64(len(results)) * 100
+	}
 
-		// 获取学生成绩
-		var studentResults []gin.H
-		var results []models.ExamResult
-		db.Preload("ExamAssignment").Preload("ExamAssignment.Exam").Find(&results)
+	// 题目分析（按试卷分别统计得分率和区分度）
+	var questions []models.Question
+	db.Model(&models.Question{}).Joins("JOIN exams ON exams.id = questions.exam_id").
+		Scopes(examsScope(db, c), examFilter).Order("questions.exam_id, questions.id").Find(&questions)
 
-		for _, result := range results {
-			// 获取学生信息
-			var student models.User
-			db.Where("id = ? AND role = 1", result.StudentID).First(&student) // 1: student
-
-			studentResults = append(studentResults, gin.H{
-				"studentId":   student.StudentID,
-				"studentName": student.Name,
-				"classId":     student.ClassId,
-				"examTitle":   result.ExamAssignment.Exam.Title,
-				"score":       result.Score,
-				"totalScore":  result.ExamAssignment.Exam.TotalScore,
-				"timeUsed":    result.TimeUsed,
-				"passed":      result.Score >= 60,
+	examQuestions := map[uint][]models.Question{}
+	var examIDs []uint
+	for _, question := range questions {
+		if _, exists := examQuestions[question.ExamID]; !exists {
+			examIDs = append(examIDs, question.ExamID)
+		}
+		examQuestions[question.ExamID] = append(examQuestions[question.ExamID], question)
+	}
+	for _, examID := range examIDs {
+		for _, item := range analyzeItems(db, examQuestions[examID], examResults[examID]) {
+			report.Questions = append(report.Questions, gin.H{
+				"id":             item.QuestionID,
+				"examId":         examID,
+				"content":        item.Content,
+				"type":           item.Type,
+				"score":          item.Score,
+				"answer":         item.Answer,
+				"responses":      item.Responses,
+				"avgScore":       item.AvgScore,
+				"correctRate":    roundStat(item.Difficulty * 100),
+				"discrimination": item.Discrimination,
 			})
 		}
+	}
 
-		// 获取班级统计
-		var classes []models.Class
-		db.Find(&classes)
-
-		var classStatistics []gin.H
-		for _, class := range classes {
-			var classResults []models.ExamResult
-			db.Joins("JOIN users ON exam_results.student_id = users.id").
-				Where("users.class_id = ? AND users.role = 1", class.ID). // 1: student
-				Find(&classResults)
+	// 班级统计
+	for _, class := range classes {
+		totals := byClass[class.ID]
+		if totals == nil {
+			totals = &classTotals{}
+		}
+		var avgScore, passRate, excellentRate float64
+		if totals.count > 0 {
+			avgScore = totals.score / float64(totals.count)
+			passRate = float64(totals.passed) / float64(totals.count) * 100
+			excellentRate = float64(totals.excellent) / float64(totals.count) * 100
+		}
+		report.ClassStatistics = append(report.ClassStatistics, gin.H{
+			"className":     class.Name,
+			"studentCount":  totals.count,
+			"avgScore":      avgScore,
+			"passRate":      passRate,
+			"excellentRate": excellentRate,
+		})
+	}
+	return report, nil
+}
 
-			var totalScore float64
-			var passCount, excellentCount int64
-			var studentCount int64
+// ExportExamReport 导出考试分析报告，筛选条件与 GetExamResultsAnalysis 相同
+//
+// format=xlsx（默认）生成包含统计概览、学生成绩、题目分析、班级统计四个工作表的文件；
+// format=csv 输出 sheet 参数选择的工作表（summary、students 默认、questions、classes）；format=json 返回报告数据
+func ExportExamReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := buildExamReport(db, c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build exam report"})
+			return
+		}
+		if c.Query("format") == "json" {
+			c.JSON(http.StatusOK, report)
+			return
+		}
 
-			for _, result := range classResults {
-				totalScore += float64(result.Score)
-				studentCount++
+		table, ok := startExport(c, "exam-report", []string{"summary", "students", "questions", "classes"}, "students")
+		if !ok {
+			return
+		}
 
-				if result.Score >= 60 {
-					passCount++
-				}
-				if result.Score >= 90 {
-					excellentCount++
-				}
+		table.Sheet("summary", "统计概览")
+		table.Header("考试分析报告", time.Now().Format("2006-01-02"))
+		filters := []struct{ name, label string }{
+			{"examId", "试卷ID"}, {"classId", "班级ID"}, {"scoreFilter", "成绩筛选"}, {"keyword", "关键词"},
+		}
+		for _, filter := range filters {
+			if value := c.Query(filter.name); value != "" {
+				table.Row("筛选："+filter.label, value)
 			}
-
-			var avgScore float64
-			var passRate, excellentRate float64
-			if studentCount > 0 {
-				avgScore = totalScore / float64(studentCount)
-				passRate = float64(passCount) / float64(studentCount) * 100
-				excellentRate = float64(excellentCount) / float64(studentCount) * 100
+		}
+		table.Row()
+		table.Header("统计指标", "数值")
+		table.Row("考试场次", report.Stats.TotalExams)
+		table.Row("参考学生", report.Stats.TotalStudents)
+		table.Row("答卷数", report.Stats.TotalResults)
+		table.Row("平均分", roundStat(report.Stats.AvgScore))
+		table.Row("及格率(%)", roundStat(report.Stats.PassRate))
+		table.Row()
+		table.Header("分数段", "人数")
+		table.Row("优秀（得分率90%以上）", report.ScoreDistribution.Excellent)
+		table.Row("良好（得分率80%-90%）", report.ScoreDistribution.Good)
+		table.Row("及格", report.ScoreDistribution.Pass)
+		table.Row("不及格", report.ScoreDistribution.Fail)
+
+		table.Sheet("students", "学生成绩")
+		table.Header("学号", "姓名", "班级", "考试名称", "得分", "原始分", "等级", "总分", "用时(分钟)", "状态", "提交时间")
+		for _, result := range report.StudentResults {
+			status := "不及格"
+			if result["passed"].(bool) {
+				status = "及格"
 			}
+			table.Row(result["studentId"], result["studentName"], result["className"], result["examTitle"],
+				result["score"], result["rawScore"], result["grade"], result["totalScore"], result["timeUsed"], status, result["submitTime"])
+		}
 
-			classStatistics = append(classStatistics, gin.H{
-				"className":     class.Name,
-				"studentCount":  studentCount,
-				"avgScore":      avgScore,
-				"passRate":      passRate,
-				"excellentRate": excellentRate,
-			})
+		table.Sheet("questions", "题目分析")
+		table.Header("题目ID", "试卷ID", "题目内容", "题目类型", "分值", "正确答案", "作答人数", "平均得分", "得分率(%)", "区分度")
+		for _, question := range report.Questions {
+			table.Row(question["id"], question["examId"], question["content"], question["type"], question["score"],
+				question["answer"], question["responses"], question["avgScore"], question["correctRate"], question["discrimination"])
 		}
 
-		// 构建报告数据
-		reportData := gin.H{
-			"stats": gin.H{
-				"totalExams":    totalExams,
-				"totalStudents": totalStudents,
-				"totalResults":  totalResults,
-				"avgScore":      avgScore,
-				"passRate":      passRate,
-			},
-			"scoreDistribution": scoreDistribution,
-			"questions":         questionAnalysis,
-			"studentResults":    studentResults,
-			"classStatistics":   classStatistics,
+		table.Sheet("classes", "班级统计")
+		table.Header("班级名称", "答卷数", "平均分", "及格率(%)", "优秀率(%)")
+		for _, class := range report.ClassStatistics {
+			table.Row(class["className"], class["studentCount"], roundStat(class["avgScore"].(float64)),
+				roundStat(class["passRate"].(float64)), roundStat(class["excellentRate"].(float64)))
 		}
 
-		c.JSON(http.StatusOK, reportData)
+		if err := table.Close(); err != nil {
+			c.Error(err)
+		}
 	}
 }
 
@@ -218,10 +376,6 @@ func GetExamResultsAnalysis(db *gorm.DB) gin.HandlerFunc {
 		// 分页参数
 		page := c.DefaultQuery("page", "1")
 		pageSize := c.DefaultQuery("pageSize", "10")
-		examID := c.DefaultQuery("examId", "")
-		classID := c.DefaultQuery("classId", "")
-		scoreFilter := c.DefaultQuery("scoreFilter", "")
-		keyword := c.DefaultQuery("keyword", "")
 
 		pageNum := 1
 		pageSizeNum := 10
@@ -235,37 +389,8 @@ func GetExamResultsAnalysis(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// 构建查询
-		query := db.Model(&models.ExamResult{}).
-			Joins("JOIN exam_assignments ON exam_results.exam_assignment_id = exam_assignments.id").
-			Joins("JOIN exams ON exam_assignments.exam_id = exams.id").
-			Joins("JOIN users ON exam_results.student_id = users.id").
-			Joins("JOIN classes ON users.class_id = classes.id").
-			Select("exam_results.*, exams.title as exam_title, users.name as student_name, users.student_id, classes.name as class_name").
-			Where("users.role = 1") // 1: student
-
-		// 过滤条件
-		if examID != "" {
-			query = query.Where("exam_assignments.exam_id = ?", examID)
-		}
-		if classID != "" {
-			query = query.Where("users.class_id = ?", classID)
-		}
-		if scoreFilter != "" {
-			switch scoreFilter {
-			case "excellent":
-				query = query.Where("exam_results.score >= 90")
-			case "good":
-				query = query.Where("exam_results.score >= 80 AND exam_results.score < 90")
-			case "pass":
-				query = query.Where("exam_results.score >= 60 AND exam_results.score < 80")
-			case "fail":
-				query = query.Where("exam_results.score < 60")
-			}
-		}
-		if keyword != "" {
-			search := "%" + keyword + "%"
-			query = query.Where("users.name LIKE ? OR users.student_id LIKE ?", search, search)
-		}
+		query := resultsAnalysisQuery(db, c).
+			Select("exam_results.*, exams.title as exam_title, users.name as student_name, users.student_id, classes.name as class_name")
 
 		// 获取总数
 		var total int64
@@ -275,7 +400,8 @@ func GetExamResultsAnalysis(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// 分页查询
-		var results []gin.H
+		// GORM 只能扫描到 []map[string]interface{}，不能用 gin.H
+		var results []map[string]interface{}
 		offset := (pageNum - 1) * pageSizeNum
 		if err := query.Offset(offset).Limit(pageSizeNum).Order("exam_results.score DESC").Scan(&results).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch results"})
@@ -284,7 +410,7 @@ func GetExamResultsAnalysis(db *gorm.DB) gin.HandlerFunc {
 
 		// 确保返回空数组而不是null
 		if results == nil {
-			results = []gin.H{}
+			results = []map[string]interface{}{}
 		}
 
 		c.JSON(http.StatusOK, gin.H{
@@ -299,7 +425,7 @@ func GetExamResultsAnalysis(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// GetScoreDistribution 获取成绩分布数据
+// GetScoreDistribution 获取成绩分布数据（按得分率分组，不同总分的试卷可以一起统计）
 func GetScoreDistribution(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		rangeSize := c.DefaultQuery("range", "10") // 5, 10, 20
@@ -311,18 +437,33 @@ func GetScoreDistribution(db *gorm.DB) gin.HandlerFunc {
 			rangeInt = 10
 		}
 
-		// 获取成绩分布
+		var results []models.ExamResult
+		if err := db.Preload("ExamAssignment.Exam").Scopes(resultsScope(db, c)).Find(&results).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch results"})
+			return
+		}
+
+		// 每组为 [start, end]（得分率%），最后一组包含100%
+		counts := make([]int64, 100/rangeInt)
+		for _, result := range results {
+			i := int(scorePercent(result.Score, result.ExamAssignment.Exam.TotalScore)) / rangeInt
+			if i < 0 {
+				i = 0
+			}
+			if i >= len(counts) {
+				i = len(counts) - 1
+			}
+			counts[i]++
+		}
+
 		var distributions []gin.H
-		for i := 0; i < 100; i += rangeInt {
-			start := i
-			end := i + rangeInt - 1
-			if end > 100 {
+		for i, count := range counts {
+			start := i * rangeInt
+			end := start + rangeInt - 1
+			if i == len(counts)-1 {
 				end = 100
 			}
 
-			var count int64
-			db.Model(&models.ExamResult{}).Where("score >= ? AND score <= ?", start, end).Count(&count)
-
 			distributions = append(distributions, gin.H{
 				"range": fmt.Sprintf("%d-%d", start, end),
 				"count": count,
@@ -344,10 +485,11 @@ func GetClassComparison(db *gorm.DB) gin.HandlerFunc {
 		metric := c.DefaultQuery("metric", "avg") // avg, pass, excellent
 
 		var classes []models.Class
-		if err := db.Find(&classes).Error; err != nil {
+		if err := db.Model(&models.Class{}).Scopes(classesScope(db, c)).Find(&classes).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch classes"})
 			return
 		}
+		scopeResults := resultsScope(db, c)
 
 		var comparisons []gin.H
 		for _, class := range classes {
@@ -356,7 +498,7 @@ func GetClassComparison(db *gorm.DB) gin.HandlerFunc {
 			switch metric {
 			case "avg":
 				var avgScore float64
-				db.Model(&models.ExamResult{}).
+				db.Model(&models.ExamResult{}).Scopes(scopeResults).
 					Joins("JOIN users ON exam_results.student_id = users.id").
 					Where("users.class_id = ? AND users.role = 1", class.ID). // 1: student
 					Select("COALESCE(AVG(score), 0)").
@@ -368,13 +510,15 @@ func GetClassComparison(db *gorm.DB) gin.HandlerFunc {
 				}
 			case "pass":
 				var totalCount, passCount int64
-				db.Model(&models.ExamResult{}).
+				db.Model(&models.ExamResult{}).Scopes(scopeResults).
 					Joins("JOIN users ON exam_results.student_id = users.id").
 					Where("users.class_id = ? AND users.role = 1", class.ID). // 1: student
 					Count(&totalCount)
-				db.Model(&models.ExamResult{}).
+				db.Model(&models.ExamResult{}).Scopes(scopeResults).
 					Joins("JOIN users ON exam_results.student_id = users.id").
-					Where("users.class_id = ? AND users.role = 1 AND score >= 60", class.ID). // 1: student
+					Scopes(joinResultExam).
+					Where("users.class_id = ? AND users.role = 1", class.ID). // 1: student
+					Where(passCondition).
 					Count(&passCount)
 				var passRate float64
 				if totalCount > 0 {
@@ -387,13 +531,15 @@ func GetClassComparison(db *gorm.DB) gin.HandlerFunc {
 				}
 			case "excellent":
 				var totalCount, excellentCount int64
-				db.Model(&models.ExamResult{}).
+				db.Model(&models.ExamResult{}).Scopes(scopeResults).
 					Joins("JOIN users ON exam_results.student_id = users.id").
 					Where("users.class_id = ? AND users.role = 1", class.ID). // 1: student
 					Count(&totalCount)
-				db.Model(&models.ExamResult{}).
+				db.Model(&models.ExamResult{}).Scopes(scopeResults).
 					Joins("JOIN users ON exam_results.student_id = users.id").
-					Where("users.class_id = ? AND users.role = 1 AND score >= 90", class.ID). // 1: student
+					Scopes(joinResultExam).
+					Where("users.class_id = ? AND users.role = 1", class.ID). // 1: student
+					Where(excellentCondition).
 					Count(&excellentCount)
 				var excellentRate float64
 				if totalCount > 0 {
@@ -433,6 +579,12 @@ func GetExamDetail(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 需要能访问该考试的班级或试卷
+		if ids, all := accessibleAssignmentIDs(db, c); !all && !containsID(ids, result.ExamAssignmentID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No permission to access this result"})
+			return
+		}
+
 		// 获取学生信息
 		var student models.User
 		db.Where("id = ? AND role = 1", result.StudentID).First(&student) // 1: student
@@ -443,60 +595,36 @@ func GetExamDetail(db *gorm.DB) gin.HandlerFunc {
 
 		// 获取题目信息
 		var questions []models.Question
-		db.Where("exam_id = ?", result.ExamAssignment.ExamID).Find(&questions)
-
-		// 解析学生答案
-		var studentAnswers []ans
-		if err := json.Unmarshal([]byte(result.Answers), &studentAnswers); err != nil {
-			studentAnswers = []ans{}
-		}
-
-		// 构建题目分析
-		var questionDetails []gin.H
-		for _, studentAnswer := range studentAnswers {
-			// 找到对应的题目
-			var question models.Question
-			for _, q := range questions {
-				if q.ID == studentAnswer.QuestionID {
-					question = q
-					break
-				}
-			}
-
-			if question.ID == 0 {
-				continue // 题目不存在
-			}
+		db.Where("exam_id = ?", result.ExamAssignment.ExamID).Order("id").Find(&questions)
 
-			correct := false
-
-			if question.Type == "single" {
-				// 单选题：使用 Answer 字段
-				correct = studentAnswer.Answer == question.Answer
-			} else if question.Type == "fill" {
-				// 填空题：使用 Answers 字段
-				if len(studentAnswer.Answers) > 0 {
-					for k, answer := range studentAnswer.Answers {
-						for _, correctAnswer := range question.Answers[k].Options {
-							if answer == correctAnswer {
-								correct = true
-								break
-							}
-						}
-						if correct {
-							break
-						}
-					}
-				}
+		// 按保存的作答记录构建题目分析
+		records := loadResultAnswers(db, []uint{result.ID})[result.ID]
+		questionDetails := make([]gin.H, 0, len(questions))
+		for _, question := range questions {
+			record, exists := records[question.ID]
+			if !exists {
+				record = models.ResultAnswer{QuestionID: question.ID, MaxPoints: question.Score}
 			}
 
 			questionDetails = append(questionDetails, gin.H{
-				"id":            question.ID,
-				"content":       question.Content,
-				"type":          question.Type,
-				"score":         question.Score,
-				"studentAnswer": studentAnswer,
-				"correctAnswer": question.Answer,
-				"correct":       correct,
+				"id":      question.ID,
+				"content": question.Content,
+				"type":    question.Type,
+				"score":   question.Score,
+				"studentAnswer": gin.H{
+					"questionId": question.ID,
+					"answer":     record.Answer,
+					"answers":    record.BlankAnswers,
+				},
+				"correctAnswer":  question.Answer,
+				"correctAnswers": question.Answers,
+				"awardedPoints":  record.AwardedPoints,
+				"penaltyPoints":  record.PenaltyPoints,
+				"maxPoints":      record.MaxPoints,
+				"manual":         record.Manual,
+				"feedback":       record.Feedback,
+				"answered":       record.Answered(),
+				"correct":        record.MaxPoints > 0 && record.AwardedPoints == record.MaxPoints,
 			})
 		}
 
@@ -508,10 +636,14 @@ func GetExamDetail(db *gorm.DB) gin.HandlerFunc {
 			"studentName":     student.Name,
 			"classId":         student.ClassId,
 			"score":           result.Score,
+			"rawScore":        result.RawScore,
+			"adjusted":        result.Adjusted,
+			"grade":           result.Grade,
+			"gradePoint":      result.GradePoint,
 			"totalScore":      exam.TotalScore,
 			"timeUsed":        result.TimeUsed,
 			"submitTime":      result.CreatedAt,
-			"passed":          result.Score >= 60,
+			"passed":          result.Score >= result.ExamAssignment.PassScore,
 			"questionDetails": questionDetails,
 		}
 
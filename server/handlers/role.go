@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errUnknownRole = errors.New("unknown role")
+	errLastAdmin   = errors.New("cannot remove the last admin")
+)
+
+// GetPermissions 获取所有可分配的权限
+func GetPermissions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"permissions": models.AllPermissions,
+		})
+	}
+}
+
+// GetRoles 获取角色列表
+func GetRoles(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var roles []models.Role
+		if err := db.Order("id").Find(&roles).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+			return
+		}
+
+		var response []gin.H
+		for _, role := range roles {
+			var userCount int64
+			db.Model(&models.UserRole{}).Where("role_id = ?", role.ID).Count(&userCount)
+
+			response = append(response, gin.H{
+				"id":          role.ID,
+				"name":        role.Name,
+				"displayName": role.DisplayName,
+				"description": role.Description,
+				"permissions": role.Permissions,
+				"builtIn":     role.BuiltIn,
+				"userCount":   userCount,
+			})
+		}
+
+		// 确保返回空数组而不是null
+		if response == nil {
+			response = []gin.H{}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"roles": response,
+			"total": len(response),
+		})
+	}
+}
+
+// roleRequest 创建/更新角色的请求
+type roleRequest struct {
+	Name        string             `json:"name"`
+	DisplayName string             `json:"displayName"`
+	Description string             `json:"description"`
+	Permissions models.Permissions `json:"permissions"`
+}
+
+// validatePermissions 检查权限列表是否都存在
+func validatePermissions(c *gin.Context, permissions models.Permissions) bool {
+	for _, permission := range permissions {
+		if !models.IsValidPermission(permission) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + permission})
+			return false
+		}
+	}
+	return true
+}
+
+// CreateRole 创建自定义角色
+func CreateRole(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request roleRequest
+		if err := c.ShouldBindJSON(&request); err != nil || request.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role data"})
+			return
+		}
+
+		if !validatePermissions(c, request.Permissions) {
+			return
+		}
+
+		// 检查角色名称是否已存在
+		var existingRole models.Role
+		if err := db.Where("name = ?", request.Name).First(&existingRole).Error; err == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role name already exists"})
+			return
+		}
+
+		role := models.Role{
+			Name:        request.Name,
+			DisplayName: request.DisplayName,
+			Description: request.Description,
+			Permissions: models.Permissions{}.Merge(request.Permissions),
+		}
+		if err := db.Create(&role).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+			return
+		}
+		recordAudit(db, c, models.AuditRoleCreate, "role", role.ID, nil, role)
+
+		c.JSON(http.StatusCreated, gin.H{
+			"role":    role,
+			"message": "Role created successfully",
+		})
+	}
+}
+
+// UpdateRole 更新角色（内置管理员角色不能修改，避免失去管理权限）
+func UpdateRole(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var role models.Role
+		if err := db.First(&role, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+
+		if role.Name == models.RoleAdmin {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot modify the admin role"})
+			return
+		}
+
+		before := role
+
+		var request roleRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role data"})
+			return
+		}
+
+		if !validatePermissions(c, request.Permissions) {
+			return
+		}
+
+		// 内置角色的名称不能修改
+		if request.Name != "" && request.Name != role.Name {
+			if role.BuiltIn {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot rename a built-in role"})
+				return
+			}
+			var existingRole models.Role
+			if err := db.Where("name = ?", request.Name).First(&existingRole).Error; err == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Role name already exists"})
+				return
+			}
+			role.Name = request.Name
+		}
+		if request.DisplayName != "" {
+			role.DisplayName = request.DisplayName
+		}
+		if request.Description != "" {
+			role.Description = request.Description
+		}
+		if request.Permissions != nil {
+			role.Permissions = models.Permissions{}.Merge(request.Permissions)
+		}
+
+		if err := db.Save(&role).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+			return
+		}
+		recordAudit(db, c, models.AuditRoleUpdate, "role", role.ID, before, role)
+
+		c.JSON(http.StatusOK, gin.H{
+			"role":    role,
+			"message": "Role updated successfully",
+		})
+	}
+}
+
+// DeleteRole 删除自定义角色
+func DeleteRole(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var role models.Role
+		if err := db.First(&role, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+
+		if role.BuiltIn {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete a built-in role"})
+			return
+		}
+
+		var userCount int64
+		db.Model(&models.UserRole{}).Where("role_id = ?", role.ID).Count(&userCount)
+		if userCount > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete a role assigned to users"})
+			return
+		}
+
+		if err := db.Unscoped().Delete(&role).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+			return
+		}
+		recordAudit(db, c, models.AuditRoleDelete, "role", role.ID, role, nil)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+	}
+}
+
+// SetUserRoles 设置教师账号的角色
+func SetUserRoles(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var teacher models.User
+		if err := db.Where("id = ? AND role = 2", c.Param("id")).First(&teacher).Error; err != nil { // 2: teacher
+			c.JSON(http.StatusNotFound, gin.H{"error": "Teacher not found"})
+			return
+		}
+
+		var request struct {
+			Roles []string `json:"roles" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role data"})
+			return
+		}
+
+		// 不能修改自己的角色，避免误操作失去管理权限
+		if teacher.ID == currentUserID(c) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot change your own roles"})
+			return
+		}
+		before := userRoleNames(db, teacher.ID)
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return assignRoles(tx, &teacher, request.Roles)
+		}); err != nil {
+			switch {
+			case errors.Is(err, errUnknownRole):
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+			case errors.Is(err, errLastAdmin):
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot remove the last admin"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update roles"})
+			}
+			return
+		}
+		recordAudit(db, c, models.AuditUserRoles, "user", teacher.ID, before, userRoleNames(db, teacher.ID))
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":      teacher.ID,
+			"roles":   request.Roles,
+			"isAdmin": teacher.IsAdmin,
+			"message": "Roles updated successfully",
+		})
+	}
+}
+
+// assignRoles 按角色名称替换用户的角色，并同步 IsAdmin 标志
+func assignRoles(tx *gorm.DB, user *models.User, roleNames []string) error {
+	var roles []models.Role
+	if err := tx.Where("name IN ?", roleNames).Find(&roles).Error; err != nil {
+		return err
+	}
+	if len(roles) != len(uniqueStrings(roleNames)) {
+		return errUnknownRole
+	}
+
+	// 不能移除最后一个管理员
+	isAdmin := byte(0)
+	for _, role := range roles {
+		if role.Name == models.RoleAdmin {
+			isAdmin = 1
+		}
+	}
+	if user.IsAdmin == 1 && isAdmin == 0 {
+		var adminCount int64
+		tx.Model(&models.User{}).Where("role = 2 AND is_admin = 1 AND id <> ?", user.ID).Count(&adminCount) // 2: teacher
+		if adminCount == 0 {
+			return errLastAdmin
+		}
+	}
+
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserRole{}).Error; err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if err := tx.Create(&models.UserRole{UserID: user.ID, RoleID: role.ID}).Error; err != nil {
+			return err
+		}
+	}
+
+	user.IsAdmin = isAdmin
+	return tx.Model(user).Update("is_admin", isAdmin).Error
+}
+
+// userRoleNames 查询用户的角色名称
+func userRoleNames(db *gorm.DB, userID uint) []string {
+	names := []string{}
+	db.Model(&models.Role{}).
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.id").
+		Pluck("roles.name", &names)
+	return names
+}
+
+// uniqueStrings 去除重复元素
+func uniqueStrings(items []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+	return result
+}
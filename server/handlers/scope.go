@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"net/http"
+	"server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// accessLevel 教师对试卷/班级的访问级别
+type accessLevel int
+
+const (
+	accessNone  accessLevel = iota
+	accessView              // 共享只读
+	accessEdit              // 共享可编辑
+	accessOwner             // 所有者（或管理员）
+)
+
+// accessLevelName 访问级别在接口中的名称
+func accessLevelName(level accessLevel) string {
+	switch level {
+	case accessOwner:
+		return "owner"
+	case accessEdit:
+		return models.ShareRoleEdit
+	case accessView:
+		return models.ShareRoleView
+	}
+	return "none"
+}
+
+// currentUserID 获取当前登录用户ID
+func currentUserID(c *gin.Context) uint {
+	user, exists := c.Get("user")
+	if !exists {
+		return 0
+	}
+	return user.(gin.H)["id"].(uint)
+}
+
+// hasPermission 判断当前用户是否拥有指定权限
+func hasPermission(c *gin.Context, permission string) bool {
+	user, exists := c.Get("user")
+	if !exists {
+		return false
+	}
+	permissions, _ := user.(gin.H)["permissions"].(models.Permissions)
+	return permissions.Has(permission)
+}
+
+// hasGlobalScope 拥有 scope.all 权限（管理员、教研组长、审计员）可以访问所有教师的数据
+func hasGlobalScope(c *gin.Context) bool {
+	return hasPermission(c, models.PermScopeAll)
+}
+
+// shareAccess 查询共享给当前教师的访问级别
+func shareAccess(db *gorm.DB, resourceType string, resourceID, teacherID uint) accessLevel {
+	var share models.ResourceShare
+	if err := db.Where("resource_type = ? AND resource_id = ? AND teacher_id = ?", resourceType, resourceID, teacherID).
+		First(&share).Error; err != nil {
+		return accessNone
+	}
+	if share.Role == models.ShareRoleEdit {
+		return accessEdit
+	}
+	return accessView
+}
+
+// examAccess 计算当前教师对试卷的访问级别
+func examAccess(db *gorm.DB, c *gin.Context, exam models.Exam) accessLevel {
+	if hasGlobalScope(c) || exam.CreatedBy == currentUserID(c) {
+		return accessOwner
+	}
+	return shareAccess(db, models.ShareResourceExam, exam.ID, currentUserID(c))
+}
+
+// classAccess 计算当前教师对班级的访问级别
+func classAccess(db *gorm.DB, c *gin.Context, class models.Class) accessLevel {
+	if hasGlobalScope(c) || class.TeacherID == currentUserID(c) {
+		return accessOwner
+	}
+	return shareAccess(db, models.ShareResourceClass, class.ID, currentUserID(c))
+}
+
+// studentClassAccess 计算当前教师对某班级学生的访问级别，未分班的学生（包括LDAP、OIDC、LTI自动创建的账号）只有 scope.all 可以管理
+func studentClassAccess(db *gorm.DB, c *gin.Context, classID int) accessLevel {
+	if classID == 0 {
+		if hasGlobalScope(c) {
+			return accessOwner
+		}
+		return accessNone
+	}
+	var class models.Class
+	if err := db.First(&class, classID).Error; err != nil {
+		return accessNone
+	}
+	return classAccess(db, c, class)
+}
+
+// requireStudentClassAccess 检查对某班级学生的访问级别，失败时直接返回错误响应
+func requireStudentClassAccess(db *gorm.DB, c *gin.Context, classID int, level accessLevel) bool {
+	if studentClassAccess(db, c, classID) < level {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No permission to access this class"})
+		return false
+	}
+	return true
+}
+
+// requireExamAccess 加载试卷并检查访问级别，失败时直接返回错误响应
+func requireExamAccess(db *gorm.DB, c *gin.Context, id interface{}, level accessLevel) (models.Exam, bool) {
+	var exam models.Exam
+	if err := db.First(&exam, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+		return exam, false
+	}
+	if examAccess(db, c, exam) < level {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No permission to access this exam"})
+		return exam, false
+	}
+	return exam, true
+}
+
+// requireClassAccess 加载班级并检查访问级别，失败时直接返回错误响应
+func requireClassAccess(db *gorm.DB, c *gin.Context, id interface{}, level accessLevel) (models.Class, bool) {
+	var class models.Class
+	if err := db.First(&class, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+		return class, false
+	}
+	if classAccess(db, c, class) < level {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No permission to access this class"})
+		return class, false
+	}
+	return class, true
+}
+
+// assignmentAccess 当前教师对考试安排的访问级别，取分配的班级和试卷中较高的级别
+func assignmentAccess(db *gorm.DB, c *gin.Context, assignmentID uint) accessLevel {
+	if hasGlobalScope(c) {
+		return accessOwner
+	}
+	var assignment models.ExamAssignment
+	if err := db.First(&assignment, assignmentID).Error; err != nil {
+		return accessNone
+	}
+
+	level := accessNone
+	var class models.Class
+	if err := db.First(&class, assignment.ClassID).Error; err == nil {
+		level = classAccess(db, c, class)
+	}
+	var exam models.Exam
+	if err := db.First(&exam, assignment.ExamID).Error; err == nil {
+		if examLevel := examAccess(db, c, exam); examLevel > level {
+			level = examLevel
+		}
+	}
+	return level
+}
+
+// accessibleExamIDs 当前教师拥有或被共享的试卷ID，管理员返回 all=true
+func accessibleExamIDs(db *gorm.DB, c *gin.Context, level accessLevel) ([]uint, bool) {
+	if hasGlobalScope(c) {
+		return nil, true
+	}
+
+	userID := currentUserID(c)
+	var ids []uint
+	db.Model(&models.Exam{}).Where("created_by = ?", userID).Pluck("id", &ids)
+	ids = append(ids, sharedResourceIDs(db, models.ShareResourceExam, userID, level)...)
+	return ids, false
+}
+
+// accessibleClassIDs 当前教师负责或被共享的班级ID，管理员返回 all=true
+func accessibleClassIDs(db *gorm.DB, c *gin.Context, level accessLevel) ([]uint, bool) {
+	if hasGlobalScope(c) {
+		return nil, true
+	}
+
+	userID := currentUserID(c)
+	var ids []uint
+	db.Model(&models.Class{}).Where("teacher_id = ?", userID).Pluck("id", &ids)
+	ids = append(ids, sharedResourceIDs(db, models.ShareResourceClass, userID, level)...)
+	return ids, false
+}
+
+// accessibleAssignmentIDs 当前教师可查看的试卷分配ID（班级或试卷可访问即可），管理员返回 all=true
+func accessibleAssignmentIDs(db *gorm.DB, c *gin.Context) ([]uint, bool) {
+	classIDs, all := accessibleClassIDs(db, c, accessView)
+	if all {
+		return nil, true
+	}
+	examIDs, _ := accessibleExamIDs(db, c, accessView)
+
+	var ids []uint
+	db.Model(&models.ExamAssignment{}).Where("class_id IN ? OR exam_id IN ?", classIDs, examIDs).Pluck("id", &ids)
+	return ids, false
+}
+
+// messagesScope 将消息查询限制为当前教师创建的消息，管理员可以查看全部
+func messagesScope(c *gin.Context) func(*gorm.DB) *gorm.DB {
+	global := hasGlobalScope(c)
+	userID := currentUserID(c)
+	return func(tx *gorm.DB) *gorm.DB {
+		if global {
+			return tx
+		}
+		return tx.Where("created_by = ?", userID)
+	}
+}
+
+// containsID 判断ID列表中是否包含指定ID
+func containsID(ids []uint, id uint) bool {
+	for _, item := range ids {
+		if item == id {
+			return true
+		}
+	}
+	return false
+}
+
+// sharedResourceIDs 共享给教师且不低于指定级别的资源ID
+func sharedResourceIDs(db *gorm.DB, resourceType string, teacherID uint, level accessLevel) []uint {
+	query := db.Model(&models.ResourceShare{}).Where("resource_type = ? AND teacher_id = ?", resourceType, teacherID)
+	if level >= accessEdit {
+		query = query.Where("role = ?", models.ShareRoleEdit)
+	}
+
+	var ids []uint
+	query.Pluck("resource_id", &ids)
+	return ids
+}
+
+// resultsScope 将考试结果查询限制在当前教师可访问的试卷分配内，用于 query.Scopes
+func resultsScope(db *gorm.DB, c *gin.Context) func(*gorm.DB) *gorm.DB {
+	ids, all := accessibleAssignmentIDs(db, c)
+	return func(tx *gorm.DB) *gorm.DB {
+		if all {
+			return tx
+		}
+		return tx.Where("exam_results.exam_assignment_id IN ?", ids)
+	}
+}
+
+// studentsScope 将学生查询限制在当前教师可访问的班级内（未分班学生只有 scope.all 可见），用于 query.Scopes
+func studentsScope(db *gorm.DB, c *gin.Context) func(*gorm.DB) *gorm.DB {
+	ids, all := accessibleClassIDs(db, c, accessView)
+	return func(tx *gorm.DB) *gorm.DB {
+		if all {
+			return tx
+		}
+		return tx.Where("users.class_id IN ?", ids)
+	}
+}
+
+// classesScope 将班级查询限制在当前教师可访问的班级内，用于 query.Scopes
+func classesScope(db *gorm.DB, c *gin.Context) func(*gorm.DB) *gorm.DB {
+	ids, all := accessibleClassIDs(db, c, accessView)
+	return func(tx *gorm.DB) *gorm.DB {
+		if all {
+			return tx
+		}
+		return tx.Where("classes.id IN ?", ids)
+	}
+}
+
+// examsScope 将试卷查询限制在当前教师可访问的试卷内，用于 query.Scopes
+func examsScope(db *gorm.DB, c *gin.Context) func(*gorm.DB) *gorm.DB {
+	ids, all := accessibleExamIDs(db, c, accessView)
+	return func(tx *gorm.DB) *gorm.DB {
+		if all {
+			return tx
+		}
+		return tx.Where("exams.id IN ?", ids)
+	}
+}
@@ -0,0 +1,531 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"server/models"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// adjustmentRequest 成绩调整请求
+type adjustmentRequest struct {
+	Steps        models.AdjustmentSteps `json:"steps"`
+	GradeScaleID *uint                  `json:"gradeScaleId"`
+	Reason       string                 `json:"reason"`
+}
+
+// adjustedResult 一份答卷调整后的成绩
+type adjustedResult struct {
+	ResultID    uint     `json:"resultId"`
+	StudentID   uint     `json:"studentId"`
+	StudentName string   `json:"studentName"`
+	RawScore    int      `json:"rawScore"`
+	Score       int      `json:"score"`
+	Grade       string   `json:"grade"`
+	GradePoint  *float64 `json:"gradePoint"`
+	Passed      bool     `json:"passed"`
+}
+
+// validateAdjustmentSteps 检查成绩调整步骤
+func validateAdjustmentSteps(steps models.AdjustmentSteps) error {
+	for _, step := range steps {
+		switch step.Type {
+		case models.AdjustLinear:
+			if step.TargetSD < 0 {
+				return errors.New("targetSd must not be negative")
+			}
+		case models.AdjustSqrt, models.AdjustBonus:
+		case models.AdjustCap:
+			if step.Max <= 0 {
+				return errors.New("max must be positive")
+			}
+		default:
+			return errors.New("unknown adjustment type: " + step.Type)
+		}
+	}
+	return nil
+}
+
+// validateGradeBands 检查等级分段
+func validateGradeBands(bands models.GradeBands) error {
+	if len(bands) == 0 {
+		return errors.New("at least one grade band is required")
+	}
+	seen := map[string]bool{}
+	for _, band := range bands {
+		if band.Grade == "" || seen[band.Grade] {
+			return errors.New("grade names must be unique and not empty")
+		}
+		if band.MinPercent < 0 || band.MinPercent > 100 {
+			return errors.New("minPercent must be between 0 and 100")
+		}
+		seen[band.Grade] = true
+	}
+	return nil
+}
+
+// resolveAdjustmentSteps 按当前所有原始成绩计算线性变换的系数，返回可直接应用的步骤
+func resolveAdjustmentSteps(steps models.AdjustmentSteps, rawScores []int, totalScore int) models.AdjustmentSteps {
+	resolved := make(models.AdjustmentSteps, len(steps))
+	values := make([]float64, len(rawScores))
+	for i, score := range rawScores {
+		values[i] = float64(score)
+	}
+
+	for k, step := range steps {
+		if step.Type == models.AdjustLinear {
+			var sum float64
+			for _, v := range values {
+				sum += v
+			}
+			mean, sd := 0.0, 0.0
+			if len(values) > 0 {
+				mean = sum / float64(len(values))
+				sd = math.Sqrt(variance(values))
+			}
+			step.Scale = 1
+			if sd > 0 {
+				step.Scale = step.TargetSD / sd
+			}
+			step.Offset = step.TargetMean - step.Scale*mean
+		}
+		resolved[k] = step
+		for i := range values {
+			values[i] = applyAdjustmentStep(step, values[i], float64(totalScore))
+		}
+	}
+	return resolved
+}
+
+// applyAdjustmentStep 应用单个调整步骤
+func applyAdjustmentStep(step models.AdjustmentStep, value, totalScore float64) float64 {
+	switch step.Type {
+	case models.AdjustLinear:
+		return value*step.Scale + step.Offset
+	case models.AdjustSqrt:
+		if value <= 0 || totalScore <= 0 {
+			return 0
+		}
+		return math.Sqrt(value/totalScore) * totalScore
+	case models.AdjustBonus:
+		return value + step.Amount
+	case models.AdjustCap:
+		return math.Min(value, step.Max)
+	}
+	return value
+}
+
+// adjustScore 对原始成绩依次应用调整步骤，结果四舍五入并限制在 0 到总分之间
+func adjustScore(steps models.AdjustmentSteps, rawScore, totalScore int) int {
+	value := float64(rawScore)
+	for _, step := range steps {
+		value = applyAdjustmentStep(step, value, float64(totalScore))
+	}
+	score := int(math.Round(value))
+	if score < 0 {
+		score = 0
+	}
+	if score > totalScore {
+		score = totalScore
+	}
+	return score
+}
+
+// gradeFor 按得分率查找等级，没有等级制或低于所有分段时返回空
+func gradeFor(bands models.GradeBands, score, totalScore int) (string, *float64) {
+	return gradeForPercent(bands, scorePercent(score, totalScore))
+}
+
+// gradeForPercent 按等级制给出得分百分比对应的等级和绩点，没有匹配的等级时返回空
+func gradeForPercent(bands models.GradeBands, percent float64) (string, *float64) {
+	sorted := append(models.GradeBands(nil), bands...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].MinPercent > sorted[j].MinPercent })
+	for _, band := range sorted {
+		if percent >= band.MinPercent {
+			point := band.GradePoint
+			return band.Grade, &point
+		}
+	}
+	return "", nil
+}
+
+// activeAdjustment 考试安排当前生效的成绩调整
+func activeAdjustment(db *gorm.DB, assignmentID uint) (models.ScoreAdjustment, bool) {
+	var adjustment models.ScoreAdjustment
+	err := db.Where("exam_assignment_id = ? AND active = ?", assignmentID, true).Order("id DESC").First(&adjustment).Error
+	return adjustment, err == nil
+}
+
+// setRawScore 保存答卷的原始成绩，并按考试安排生效的成绩调整更新最终成绩和等级，返回最终成绩
+//
+// 评分、手动改分、重新评分都通过此函数写入成绩
+func setRawScore(tx *gorm.DB, resultID uint, rawScore int) (int, error) {
+	var result models.ExamResult
+	if err := tx.Preload("ExamAssignment.Exam").First(&result, resultID).Error; err != nil {
+		return 0, err
+	}
+
+	updates := map[string]interface{}{
+		"raw_score":   rawScore,
+		"score":       rawScore,
+		"adjusted":    false,
+		"grade":       "",
+		"grade_point": nil,
+	}
+	score := rawScore
+	if adjustment, ok := activeAdjustment(tx, result.ExamAssignmentID); ok {
+		totalScore := result.ExamAssignment.Exam.TotalScore
+		score = adjustScore(adjustment.Steps, rawScore, totalScore)
+		grade, point := gradeFor(adjustment.GradeBands, score, totalScore)
+		updates["score"] = score
+		updates["adjusted"] = true
+		updates["grade"] = grade
+		updates["grade_point"] = point
+	}
+	return score, tx.Model(&models.ExamResult{}).Where("id = ?", resultID).Updates(updates).Error
+}
+
+// loadAdjustmentTarget 加载考试安排及其试卷并检查访问级别（预览和历史只需查看权限，应用和撤销需要编辑权限），失败时直接返回错误响应
+func loadAdjustmentTarget(db *gorm.DB, c *gin.Context, level accessLevel) (models.ExamAssignment, bool) {
+	var assignment models.ExamAssignment
+	if err := db.Preload("Exam").First(&assignment, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam assignment not found"})
+		return assignment, false
+	}
+	if assignmentAccess(db, c, assignment.ID) < level {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No permission to access this assignment"})
+		return assignment, false
+	}
+	return assignment, true
+}
+
+// planAdjustment 校验请求并计算每份答卷调整后的成绩，失败时直接返回错误响应
+func planAdjustment(db *gorm.DB, c *gin.Context, assignment models.ExamAssignment, request adjustmentRequest) (models.ScoreAdjustment, []adjustedResult, bool) {
+	adjustment := models.ScoreAdjustment{ExamAssignmentID: assignment.ID, GradeScaleID: request.GradeScaleID}
+	if len(request.Steps) == 0 && request.GradeScaleID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one step or a grade scale is required"})
+		return adjustment, nil, false
+	}
+	if err := validateAdjustmentSteps(request.Steps); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return adjustment, nil, false
+	}
+	if request.GradeScaleID != nil {
+		var scale models.GradeScale
+		if err := db.First(&scale, *request.GradeScaleID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Grade scale not found"})
+			return adjustment, nil, false
+		}
+		adjustment.GradeBands = scale.Bands
+	}
+
+	var results []models.ExamResult
+	if err := db.Where("exam_assignment_id = ?", assignment.ID).Order("id").Find(&results).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch results"})
+		return adjustment, nil, false
+	}
+	rawScores := make([]int, len(results))
+	studentIDs := make([]uint, len(results))
+	for i, result := range results {
+		rawScores[i] = result.RawScore
+		studentIDs[i] = result.StudentID
+	}
+	var students []models.User
+	db.Select("id", "name").Where("id IN ?", studentIDs).Find(&students)
+	names := make(map[uint]string, len(students))
+	for _, student := range students {
+		names[student.ID] = student.Name
+	}
+
+	totalScore := assignment.Exam.TotalScore
+	adjustment.Steps = resolveAdjustmentSteps(request.Steps, rawScores, totalScore)
+	adjusted := make([]adjustedResult, 0, len(results))
+	for _, result := range results {
+		score := adjustScore(adjustment.Steps, result.RawScore, totalScore)
+		grade, point := gradeFor(adjustment.GradeBands, score, totalScore)
+		adjusted = append(adjusted, adjustedResult{
+			ResultID:    result.ID,
+			StudentID:   result.StudentID,
+			StudentName: names[result.StudentID],
+			RawScore:    result.RawScore,
+			Score:       score,
+			Grade:       grade,
+			GradePoint:  point,
+			Passed:      score >= assignment.PassScore,
+		})
+	}
+	return adjustment, adjusted, true
+}
+
+// adjustmentSummary 调整前后的平均分和标准差
+func adjustmentSummary(results []adjustedResult) gin.H {
+	raw := make([]float64, len(results))
+	adjusted := make([]float64, len(results))
+	passed := 0
+	for i, result := range results {
+		raw[i] = float64(result.RawScore)
+		adjusted[i] = float64(result.Score)
+		if result.Passed {
+			passed++
+		}
+	}
+	before := summarizeScores(raw)
+	after := summarizeScores(adjusted)
+	return gin.H{
+		"count":       len(results),
+		"rawMean":     before.Mean,
+		"rawStdDev":   before.StdDev,
+		"mean":        after.Mean,
+		"stdDev":      after.StdDev,
+		"passedCount": passed,
+	}
+}
+
+// PreviewScoreAdjustment 预览成绩调整（线性变换、开方曲线、加分、封顶和等级制）后的成绩
+func PreviewScoreAdjustment(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request adjustmentRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adjustment data"})
+			return
+		}
+		assignment, ok := loadAdjustmentTarget(db, c, accessView)
+		if !ok {
+			return
+		}
+		adjustment, results, ok := planAdjustment(db, c, assignment, request)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"steps":   adjustment.Steps,
+			"summary": adjustmentSummary(results),
+			"results": results,
+		})
+	}
+}
+
+// ApplyScoreAdjustment 应用成绩调整，替换考试安排之前生效的调整，原始成绩保留在 RawScore
+func ApplyScoreAdjustment(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request adjustmentRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adjustment data"})
+			return
+		}
+		if request.Reason == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Reason is required"})
+			return
+		}
+		assignment, ok := loadAdjustmentTarget(db, c, accessEdit)
+		if !ok {
+			return
+		}
+		adjustment, results, ok := planAdjustment(db, c, assignment, request)
+		if !ok {
+			return
+		}
+		adjustment.Reason = request.Reason
+		adjustment.Active = true
+		adjustment.CreatedBy = currentUserID(c)
+
+		now := time.Now()
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.ScoreAdjustment{}).
+				Where("exam_assignment_id = ? AND active = ?", assignment.ID, true).
+				Updates(map[string]interface{}{"active": false, "reverted_at": &now}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&adjustment).Error; err != nil {
+				return err
+			}
+			for _, result := range results {
+				if err := tx.Model(&models.ExamResult{}).Where("id = ?", result.ResultID).Updates(map[string]interface{}{
+					"score":       result.Score,
+					"adjusted":    true,
+					"grade":       result.Grade,
+					"grade_point": result.GradePoint,
+				}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply adjustment"})
+			return
+		}
+
+		recordAudit(db, c, models.AuditScoreAdjust, "exam_assignment", assignment.ID, nil, adjustment)
+		for _, result := range results {
+			go publishLTIScore(db, result.ResultID)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"adjustment": adjustment,
+			"summary":    adjustmentSummary(results),
+			"message":    "Score adjustment applied successfully",
+		})
+	}
+}
+
+// RevertScoreAdjustment 撤销考试安排生效的成绩调整，恢复原始成绩
+func RevertScoreAdjustment(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		assignment, ok := loadAdjustmentTarget(db, c, accessEdit)
+		if !ok {
+			return
+		}
+		adjustment, exists := activeAdjustment(db, assignment.ID)
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No active adjustment"})
+			return
+		}
+
+		now := time.Now()
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&adjustment).Updates(map[string]interface{}{"active": false, "reverted_at": &now}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.ExamResult{}).Where("exam_assignment_id = ?", assignment.ID).
+				Updates(map[string]interface{}{
+					"score":       gorm.Expr("raw_score"),
+					"adjusted":    false,
+					"grade":       "",
+					"grade_point": nil,
+				}).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert adjustment"})
+			return
+		}
+
+		recordAudit(db, c, models.AuditScoreAdjustRevert, "exam_assignment", assignment.ID, gin.H{"adjustmentId": adjustment.ID}, nil)
+		var resultIDs []uint
+		db.Model(&models.ExamResult{}).Where("exam_assignment_id = ?", assignment.ID).Pluck("id", &resultIDs)
+		for _, id := range resultIDs {
+			go publishLTIScore(db, id)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Score adjustment reverted successfully"})
+	}
+}
+
+// GetScoreAdjustments 获取考试安排的成绩调整历史
+func GetScoreAdjustments(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		assignment, ok := loadAdjustmentTarget(db, c, accessView)
+		if !ok {
+			return
+		}
+
+		adjustments := []models.ScoreAdjustment{}
+		if err := db.Where("exam_assignment_id = ?", assignment.ID).Order("id DESC").Find(&adjustments).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch adjustments"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"adjustments": adjustments,
+			"total":       len(adjustments),
+		})
+	}
+}
+
+// GetGradeScales 获取等级制列表
+func GetGradeScales(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scales := []models.GradeScale{}
+		if err := db.Order("id").Find(&scales).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch grade scales"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"gradeScales": scales, "total": len(scales)})
+	}
+}
+
+// CreateGradeScale 创建等级制
+func CreateGradeScale(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Name  string            `json:"name" binding:"required"`
+			Bands models.GradeBands `json:"bands"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid grade scale data"})
+			return
+		}
+		if err := validateGradeBands(request.Bands); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		scale := models.GradeScale{Name: request.Name, Bands: request.Bands, CreatedBy: currentUserID(c)}
+		if err := db.Create(&scale).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create grade scale"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"gradeScale": scale, "message": "Grade scale created successfully"})
+	}
+}
+
+// UpdateGradeScale 修改等级制，已应用的成绩调整保留应用时的分段
+func UpdateGradeScale(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Name  string            `json:"name" binding:"required"`
+			Bands models.GradeBands `json:"bands"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid grade scale data"})
+			return
+		}
+		if err := validateGradeBands(request.Bands); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var scale models.GradeScale
+		if err := db.First(&scale, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Grade scale not found"})
+			return
+		}
+		if scale.CreatedBy != currentUserID(c) && !hasGlobalScope(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No permission to edit this grade scale"})
+			return
+		}
+
+		if err := db.Model(&scale).Updates(models.GradeScale{Name: request.Name, Bands: request.Bands}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update grade scale"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"gradeScale": scale, "message": "Grade scale updated successfully"})
+	}
+}
+
+// DeleteGradeScale 删除等级制
+func DeleteGradeScale(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var scale models.GradeScale
+		if err := db.First(&scale, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Grade scale not found"})
+			return
+		}
+		if scale.CreatedBy != currentUserID(c) && !hasGlobalScope(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No permission to delete this grade scale"})
+			return
+		}
+
+		if err := db.Delete(&scale).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete grade scale"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Grade scale deleted successfully"})
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"server/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// getSetting 读取系统设置，不存在时返回空字符串
+func getSetting(db *gorm.DB, key string) string {
+	var setting models.SystemSetting
+	if err := db.Where(&models.SystemSetting{Key: key}).First(&setting).Error; err != nil {
+		return ""
+	}
+	return setting.Value
+}
+
+// setSetting 保存系统设置
+func setSetting(db *gorm.DB, key, value string) error {
+	setting := models.SystemSetting{Key: key, Value: value, UpdatedAt: time.Now()}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&setting).Error
+}
+
+// GetSecuritySettings 获取安全设置
+func GetSecuritySettings(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"requireTeacher2FA": getSetting(db, models.SettingRequireTeacher2FA) == "true",
+		})
+	}
+}
+
+// UpdateSecuritySettings 更新安全设置
+func UpdateSecuritySettings(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			RequireTeacher2FA *bool `json:"requireTeacher2FA"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid settings data"})
+			return
+		}
+
+		if request.RequireTeacher2FA != nil {
+			before := getSetting(db, models.SettingRequireTeacher2FA)
+			value := strconv.FormatBool(*request.RequireTeacher2FA)
+			if err := setSetting(db, models.SettingRequireTeacher2FA, value); err != nil {
+				log.Printf("Failed to save setting %s: %v", models.SettingRequireTeacher2FA, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+				return
+			}
+			recordAudit(db, c, models.AuditSettingsUpdate, "setting", 0,
+				gin.H{models.SettingRequireTeacher2FA: before}, gin.H{models.SettingRequireTeacher2FA: value})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"requireTeacher2FA": getSetting(db, models.SettingRequireTeacher2FA) == "true",
+			"message":           "Settings updated successfully",
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+	"server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// requireShareOwner 检查当前教师是否为共享资源的所有者，返回资源所有者ID
+func requireShareOwner(db *gorm.DB, c *gin.Context, resourceType string) (uint, uint, bool) {
+	id := c.Param("id")
+	switch resourceType {
+	case models.ShareResourceExam:
+		exam, ok := requireExamAccess(db, c, id, accessOwner)
+		return exam.ID, exam.CreatedBy, ok
+	case models.ShareResourceClass:
+		class, ok := requireClassAccess(db, c, id, accessOwner)
+		return class.ID, class.TeacherID, ok
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resource type"})
+	return 0, 0, false
+}
+
+// GetShares 获取试卷/班级的共享教师列表
+func GetShares(db *gorm.DB, resourceType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resourceID, _, ok := requireShareOwner(db, c, resourceType)
+		if !ok {
+			return
+		}
+
+		var shares []models.ResourceShare
+		if err := db.Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+			Find(&shares).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shares"})
+			return
+		}
+
+		var response []gin.H
+		for _, share := range shares {
+			var teacher models.User
+			db.First(&teacher, share.TeacherID)
+
+			response = append(response, gin.H{
+				"teacherId":   share.TeacherID,
+				"teacherName": teacher.Name,
+				"username":    teacher.Username,
+				"role":        share.Role,
+				"createdAt":   share.CreatedAt,
+			})
+		}
+
+		// 确保返回空数组而不是null
+		if response == nil {
+			response = []gin.H{}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"shares": response,
+			"total":  len(response),
+		})
+	}
+}
+
+// CreateShare 共享试卷/班级给协作教师，已共享时更新角色
+func CreateShare(db *gorm.DB, resourceType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resourceID, ownerID, ok := requireShareOwner(db, c, resourceType)
+		if !ok {
+			return
+		}
+
+		var request struct {
+			TeacherID uint   `json:"teacherId" binding:"required"`
+			Role      string `json:"role" binding:"required,oneof=view edit"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid share data"})
+			return
+		}
+
+		if request.TeacherID == ownerID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot share with the owner"})
+			return
+		}
+
+		// 验证协作教师是否存在
+		var teacher models.User
+		if err := db.Where("id = ? AND role = 2", request.TeacherID).First(&teacher).Error; err != nil { // 2: teacher
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Teacher not found"})
+			return
+		}
+
+		share := models.ResourceShare{
+			ResourceType: resourceType,
+			ResourceID:   resourceID,
+			TeacherID:    request.TeacherID,
+			Role:         request.Role,
+		}
+		if err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "resource_type"}, {Name: "resource_id"}, {Name: "teacher_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at"}),
+		}).Create(&share).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share"})
+			return
+		}
+		recordAudit(db, c, models.AuditShareCreate, resourceType, resourceID, nil, gin.H{
+			"teacherId": request.TeacherID,
+			"role":      request.Role,
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"teacherId":   teacher.ID,
+			"teacherName": teacher.Name,
+			"role":        request.Role,
+			"message":     "Shared successfully",
+		})
+	}
+}
+
+// DeleteShare 取消共享
+func DeleteShare(db *gorm.DB, resourceType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resourceID, _, ok := requireShareOwner(db, c, resourceType)
+		if !ok {
+			return
+		}
+
+		var share models.ResourceShare
+		if err := db.Where("resource_type = ? AND resource_id = ? AND teacher_id = ?", resourceType, resourceID, c.Param("teacherId")).
+			First(&share).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Share not found"})
+			return
+		}
+
+		if err := db.Unscoped().Delete(&share).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete share"})
+			return
+		}
+		recordAudit(db, c, models.AuditShareDelete, resourceType, resourceID, gin.H{
+			"teacherId": share.TeacherID,
+			"role":      share.Role,
+		}, nil)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Share deleted successfully",
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// excellentPercent 优秀线：试卷总分的90%
+const excellentPercent = 90
+
+// maxHistogramBins 直方图最多的分组数
+const maxHistogramBins = 200
+
+// 及格按考试安排设置的及格分、优秀按试卷总分的比例判断，查询需先用 joinResultExam 关联考试安排和试卷
+const (
+	passCondition      = "exam_results.score >= exam_assignments.pass_score"
+	failCondition      = "exam_results.score < exam_assignments.pass_score"
+	excellentCondition = "exam_results.score * 100 >= exams.total_score * 90" // 与 excellentPercent 一致
+)
+
+// joinResultExam 关联答卷对应的考试安排和试卷，用于 query.Scopes
+func joinResultExam(tx *gorm.DB) *gorm.DB {
+	return tx.Joins("JOIN exam_assignments ON exam_assignments.id = exam_results.exam_assignment_id").
+		Joins("JOIN exams ON exams.id = exam_assignments.exam_id")
+}
+
+// scorePercent 得分占试卷总分的百分比
+func scorePercent(score, totalScore int) float64 {
+	if totalScore <= 0 {
+		return 0
+	}
+	return float64(score) * 100 / float64(totalScore)
+}
+
+// scoreSummary 成绩的描述统计
+type scoreSummary struct {
+	Count    int     `json:"count"`
+	Mean     float64 `json:"mean"`
+	Median   float64 `json:"median"`
+	StdDev   float64 `json:"stdDev"` // 标准差（总体）
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+	Q1       float64 `json:"q1"` // 下四分位数
+	Q3       float64 `json:"q3"` // 上四分位数
+	Skewness float64 `json:"skewness"`
+}
+
+// histogramBin 直方图分组，区间为 [start, end)，最后一组包含总分
+type histogramBin struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Count int     `json:"count"`
+}
+
+// GetExamStatistics 试卷或考试安排的成绩统计：描述统计、信度（Cronbach's α / KR-20）、测量标准误和直方图
+//
+// 参数 binWidth 为直方图组距，默认总分的十分之一
+func GetExamStatistics(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exam, questions, results, ok := loadAnalysisResults(db, c)
+		if !ok {
+			return
+		}
+
+		binWidth := math.Max(1, math.Ceil(float64(exam.TotalScore)/10))
+		if raw := c.Query("binWidth"); raw != "" {
+			width, err := strconv.ParseFloat(raw, 64)
+			if err != nil || width <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid binWidth"})
+				return
+			}
+			binWidth = width
+		}
+		if float64(exam.TotalScore)/binWidth > maxHistogramBins {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "binWidth is too small"})
+			return
+		}
+
+		// 按原始成绩统计，成绩调整（曲线）不改变信度和测量标准误
+		scores := make([]float64, len(results))
+		for i, result := range results {
+			scores[i] = float64(result.RawScore)
+		}
+		summary := summarizeScores(scores)
+
+		// 信度按每题得分计算
+		itemScores := make([][]float64, len(questions))
+		dichotomous := len(questions) > 0
+		for i, question := range questions {
+			itemScores[i] = make([]float64, len(results))
+			if question.Type == "fill" && len(question.Answers) > 1 {
+				dichotomous = false // 多空填空题按空给分，不是0/1计分
+			}
+		}
+		records := loadResultAnswers(db, resultIDs(results))
+		for j, result := range results {
+			for i, question := range questions {
+				itemScores[i][j] = float64(records[result.ID][question.ID].AwardedPoints)
+			}
+		}
+
+		reliability := gin.H{"cronbachAlpha": nil, "kr20": nil, "sem": nil}
+		if alpha, ok := cronbachAlpha(itemScores); ok {
+			reliability["cronbachAlpha"] = roundStat(alpha)
+			if dichotomous {
+				// 0/1计分时 KR-20 与 Cronbach's α 相等
+				reliability["kr20"] = roundStat(alpha)
+			}
+			if alpha >= 0 {
+				reliability["sem"] = roundStat(summary.StdDev * math.Sqrt(1-alpha))
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"examId":      exam.ID,
+			"examTitle":   exam.Title,
+			"totalScore":  exam.TotalScore,
+			"questions":   len(questions),
+			"summary":     summary,
+			"reliability": reliability,
+			"binWidth":    binWidth,
+			"histogram":   scoreHistogram(scores, float64(exam.TotalScore), binWidth),
+		})
+	}
+}
+
+// summarizeScores 计算描述统计
+func summarizeScores(values []float64) scoreSummary {
+	summary := scoreSummary{Count: len(values)}
+	if len(values) == 0 {
+		return summary
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := float64(len(sorted))
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	mean := sum / n
+
+	var m2, m3 float64
+	for _, v := range sorted {
+		d := v - mean
+		m2 += d * d
+		m3 += d * d * d
+	}
+	m2 /= n
+	m3 /= n
+
+	summary.Mean = roundStat(mean)
+	summary.StdDev = roundStat(math.Sqrt(m2))
+	summary.Min = sorted[0]
+	summary.Max = sorted[len(sorted)-1]
+	summary.Median = roundStat(quantile(sorted, 0.5))
+	summary.Q1 = roundStat(quantile(sorted, 0.25))
+	summary.Q3 = roundStat(quantile(sorted, 0.75))
+	if m2 > 0 {
+		summary.Skewness = roundStat(m3 / math.Pow(m2, 1.5))
+	}
+	return summary
+}
+
+// quantile 已排序数据的分位数（线性插值）
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := q * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower))
+}
+
+// cronbachAlpha 计算内部一致性信度，itemScores[i][j] 为第j份答卷第i题的得分
+// 少于两道题、少于两份答卷或总分没有差异时无法计算
+func cronbachAlpha(itemScores [][]float64) (float64, bool) {
+	k := len(itemScores)
+	if k < 2 || len(itemScores[0]) < 2 {
+		return 0, false
+	}
+
+	totals := make([]float64, len(itemScores[0]))
+	var itemVariance float64
+	for _, scores := range itemScores {
+		itemVariance += variance(scores)
+		for j, score := range scores {
+			totals[j] += score
+		}
+	}
+	totalVariance := variance(totals)
+	if totalVariance == 0 {
+		return 0, false
+	}
+	return float64(k) / float64(k-1) * (1 - itemVariance/totalVariance), true
+}
+
+// variance 总体方差
+func variance(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return squares / float64(len(values))
+}
+
+// scoreHistogram 按组距统计 0 到总分之间的成绩分布，超出范围的成绩计入首尾两组
+func scoreHistogram(scores []float64, totalScore, binWidth float64) []histogramBin {
+	count := int(math.Ceil(totalScore / binWidth))
+	if count < 1 {
+		count = 1
+	}
+	bins := make([]histogramBin, count)
+	for i := range bins {
+		bins[i].Start = float64(i) * binWidth
+		bins[i].End = math.Min(float64(i+1)*binWidth, totalScore)
+	}
+
+	for _, score := range scores {
+		i := int(math.Floor(score / binWidth))
+		if i < 0 {
+			i = 0
+		}
+		if i >= count {
+			i = count - 1
+		}
+		bins[i].Count++
+	}
+	return bins
+}
@@ -174,8 +174,13 @@ func SubmitExam(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// 计算分数（根据正确答案计算）
-		score := calculateScore(request.Answers, assignment.ExamID, db)
+		// 逐题评分（根据正确答案计算）
+		var questions []models.Question
+		if err := db.Where("exam_id = ?", assignment.ExamID).Order("id").Find(&questions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
+			return
+		}
+		records, breakdown := gradeAnswers(exam, questions, request.Answers)
 		b, err := json.Marshal(request.Answers)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to serialize answers"})
@@ -186,20 +191,58 @@ func SubmitExam(db *gorm.DB) gin.HandlerFunc {
 		result := models.ExamResult{
 			ExamAssignmentID: assignment.ID,
 			StudentID:        studentID,
-			Score:            score,
+			Score:            breakdown.Score,
+			RawScore:         breakdown.Score,
 			Answers:          string(b),
 			TimeUsed:         request.TimeUsed,
 		}
 
-		if err := db.Create(&result).Error; err != nil {
+		score := breakdown.Score
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&result).Error; err != nil {
+				return err
+			}
+			for i := range records {
+				records[i].ExamResultID = result.ID
+			}
+			if len(records) > 0 {
+				if err := tx.Create(&records).Error; err != nil {
+					return err
+				}
+			}
+			// 考试安排已应用成绩调整时（如补考），按同样的调整计算最终成绩
+			var err error
+			score, err = setRawScore(tx, result.ID, breakdown.Score)
+			return err
+		}); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit exam"})
 			return
 		}
 
+		// 通过LMS启动的考试回传成绩
+		go publishLTIScore(db, result.ID)
+
+		// 成绩未公布时不返回分数，避免其他学生考试期间泄露答案
+		if !resultsReleased(assignment) {
+			c.JSON(http.StatusCreated, gin.H{
+				"id":            result.ID,
+				"released":      false,
+				"releasePolicy": releasePolicy(assignment),
+				"totalScore":    exam.TotalScore,
+				"message":       "Exam submitted successfully",
+			})
+			return
+		}
+
 		c.JSON(http.StatusCreated, gin.H{
-			"score":      score,
-			"totalScore": exam.TotalScore,
-			"message":    "Exam submitted successfully",
+			"id":            result.ID,
+			"released":      true,
+			"score":         score,
+			"rawScore":      breakdown.Score,
+			"earnedPoints":  breakdown.Earned,
+			"penaltyPoints": breakdown.Penalty,
+			"totalScore":    exam.TotalScore,
+			"message":       "Exam submitted successfully",
 		})
 	}
 }
@@ -253,16 +296,25 @@ func GetExamResults(db *gorm.DB) gin.HandlerFunc {
 		// 构建响应数据
 		var response []gin.H
 		for _, result := range results {
-			response = append(response, gin.H{
+			item := gin.H{
 				"id":               result.ID,
 				"examAssignmentId": result.ExamAssignmentID,
 				"examTitle":        result.ExamAssignment.Exam.Title,
-				"score":            result.Score,
 				"totalScore":       result.ExamAssignment.Exam.TotalScore,
 				"timeUsed":         result.TimeUsed,
 				"submitTime":       result.CreatedAt,
-				"passed":           result.Score >= 60,
-			})
+				"released":         resultsReleased(result.ExamAssignment),
+			}
+			// 成绩公布前只返回提交信息
+			if resultsReleased(result.ExamAssignment) {
+				item["score"] = result.Score
+				item["rawScore"] = result.RawScore
+				item["adjusted"] = result.Adjusted
+				item["grade"] = result.Grade
+				item["gradePoint"] = result.GradePoint
+				item["passed"] = result.Score >= result.ExamAssignment.PassScore
+			}
+			response = append(response, item)
 		}
 
 		// 确保返回空数组而不是null
@@ -318,7 +370,7 @@ func GetExamDetailsForStudent(db *gorm.DB) gin.HandlerFunc {
 
 		// 获取试卷相关问题
 		var questions []models.Question
-		if err := db.Where("exam_id = ?", assignment.ExamID).Find(&questions).Error; err != nil {
+		if err := db.Where("exam_id = ?", assignment.ExamID).Order("position, id").Find(&questions).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
 			return
 		}
@@ -367,7 +419,9 @@ func GetExamDetailsForStudent(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// GetExamResult 获取单个考试结果详情
+// GetExamResult 学生查看答卷（成绩公布后才返回分数和题目）
+//
+// 每题对错和得分、正确答案、教师评语是否显示由考试安排的 ShowCorrectness、ShowAnswers、ShowFeedback 决定
 func GetExamResult(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		resultID := c.Param("resultId")
@@ -387,18 +441,85 @@ func GetExamResult(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Result not found"})
 			return
 		}
+		assignment := result.ExamAssignment
 
 		response := gin.H{
-			"id":         result.ID,
-			"examId":     result.ExamAssignment.ID,
-			"examTitle":  result.ExamAssignment.Exam.Title,
-			"score":      result.Score,
-			"totalScore": result.ExamAssignment.Exam.TotalScore,
-			"timeUsed":   result.TimeUsed,
-			"submitTime": result.CreatedAt,
-			"passed":     result.Score >= 60,
-			"answers":    result.Answers,
+			"id":               result.ID,
+			"examAssignmentId": assignment.ID,
+			"examTitle":        assignment.Exam.Title,
+			"totalScore":       assignment.Exam.TotalScore,
+			"timeUsed":         result.TimeUsed,
+			"submitTime":       result.CreatedAt,
+			"releasePolicy":    releasePolicy(assignment),
+			"released":         resultsReleased(assignment),
+		}
+		if !resultsReleased(assignment) {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+
+		response["score"] = result.Score
+		response["rawScore"] = result.RawScore
+		response["adjusted"] = result.Adjusted
+		response["grade"] = result.Grade
+		response["gradePoint"] = result.GradePoint
+		response["passed"] = result.Score >= assignment.PassScore
+
+		var questions []models.Question
+		if err := db.Where("exam_id = ?", assignment.ExamID).Order("position, id").Find(&questions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
+			return
+		}
+
+		// 每题得分以保存的作答记录为准
+		records := loadResultAnswers(db, []uint{result.ID})[result.ID]
+		questionResponses := make([]gin.H, 0, len(questions))
+		for _, question := range questions {
+			record, exists := records[question.ID]
+			if !exists {
+				record = models.ResultAnswer{QuestionID: question.ID, MaxPoints: question.Score}
+			}
+
+			questionResponse := gin.H{
+				"id":       question.ID,
+				"type":     question.Type,
+				"content":  question.Content,
+				"score":    question.Score,
+				"answer":   record.Answer,
+				"answers":  record.BlankAnswers,
+				"answered": record.Answered(),
+			}
+			if question.Type == "single" {
+				questionResponse["options"] = question.Options
+			}
+			if assignment.ShowCorrectness {
+				questionResponse["correct"] = record.MaxPoints > 0 && record.AwardedPoints == record.MaxPoints
+				questionResponse["awardedPoints"] = record.AwardedPoints
+				questionResponse["penaltyPoints"] = record.PenaltyPoints
+				questionResponse["maxPoints"] = record.MaxPoints
+			}
+			if assignment.ShowAnswers {
+				if question.Type == "single" {
+					questionResponse["correctAnswer"] = question.Answer
+				} else {
+					// 只返回可接受的答案，不返回判分规则
+					correctAnswers := make([][]string, len(question.Answers))
+					for k, blank := range question.Answers {
+						correctAnswers[k] = blank.Options
+					}
+					questionResponse["correctAnswers"] = correctAnswers
+				}
+			}
+			if assignment.ShowFeedback {
+				questionResponse["feedback"] = record.Feedback
+			}
+
+			questionResponses = append(questionResponses, questionResponse)
 		}
+		response["showCorrectness"] = assignment.ShowCorrectness
+		response["showAnswers"] = assignment.ShowAnswers
+		response["showFeedback"] = assignment.ShowFeedback
+		response["questions"] = questionResponses
 
 		c.JSON(http.StatusOK, response)
 	}
@@ -430,16 +551,26 @@ func GetStudentProfile(db *gorm.DB) gin.HandlerFunc {
 			db.First(&classInfo, student.ClassId)
 		}
 
-		// 获取学习统计
+		// 获取学习统计，参加的考试按考试安排计，重考只算一次
 		var totalExams int64
-		db.Model(&models.ExamResult{}).Where("student_id = ?", studentID).Count(&totalExams)
+		db.Model(&models.ExamResult{}).Where("student_id = ?", studentID).Distinct("exam_assignment_id").Count(&totalExams)
 
-		var Score struct {
-			a float64
-			b float64
-			c int64
+		// 平均分、最高分和及格次数按每次考试最后一次提交计算，只统计已公布的成绩
+		progress, err := buildStudentProgress(db, student, true, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch student stats"})
+			return
+		}
+		avgScore, highestScore := 0.0, 0
+		for i, entry := range progress.Entries {
+			avgScore += float64(entry.Score)
+			if i == 0 || entry.Score > highestScore {
+				highestScore = entry.Score
+			}
+		}
+		if len(progress.Entries) > 0 {
+			avgScore = roundPercent(avgScore / float64(len(progress.Entries)))
 		}
-		db.Model(&models.ExamResult{}).Where("student_id = ?", studentID).Select("COALESCE(AVG(score), 0) a, COALESCE(MAX(score), 0) b, sum(iif(score >= 60,1,0))").Scan(&Score)
 
 		// 构建响应数据
 		response := gin.H{
@@ -451,9 +582,13 @@ func GetStudentProfile(db *gorm.DB) gin.HandlerFunc {
 			"phone":          "13800138000", // 临时使用默认电话
 			"stats": gin.H{
 				"totalExams":   totalExams,
-				"avgScore":     Score.a,
-				"highestScore": Score.b,
-				"passedExams":  Score.c,
+				"avgScore":     avgScore,
+				"highestScore": highestScore,
+				"passedExams":  progress.PassedExams,
+				"failedExams":  progress.FailedExams,
+				"avgPercent":   progress.AveragePercent,
+				"trend":        progress.Trend,
+				"missedExams":  len(progress.Missed),
 			},
 		}
 
@@ -483,6 +618,9 @@ func GetStudents(db *gorm.DB) gin.HandlerFunc {
 		// 构建查询
 		query := db.Model(&models.User{}).Where("role = 1") // 1: student
 
+		// 教师只能看到自己负责或被共享班级的学生
+		query = query.Scopes(studentsScope(db, c))
+
 		// 搜索条件
 		if keyword != "" {
 			search := "%" + keyword + "%"
@@ -512,14 +650,15 @@ func GetStudents(db *gorm.DB) gin.HandlerFunc {
 			db.First(&classInfo, student.ClassId)
 
 			response = append(response, gin.H{
-				"id":         student.ID,
-				"username":   student.Username,
-				"studentId":  student.StudentID,
-				"name":       student.Name,
-				"classId":    student.ClassId,
-				"className":  classInfo.Name,
-				"major":      student.Major,
-				"createTime": student.CreatedAt,
+				"id":          student.ID,
+				"username":    student.Username,
+				"studentId":   student.StudentID,
+				"name":        student.Name,
+				"classId":     student.ClassId,
+				"className":   classInfo.Name,
+				"major":       student.Major,
+				"lockedUntil": student.LockedUntil,
+				"createTime":  student.CreatedAt,
 			})
 		}
 
@@ -553,12 +692,15 @@ func GetTeachers(db *gorm.DB) gin.HandlerFunc {
 		var response []gin.H
 		for _, teacher := range teachers {
 			response = append(response, gin.H{
-				"id":         teacher.ID,
-				"username":   teacher.Username,
-				"name":       teacher.Name,
-				"role":       teacher.Role,
-				"status":     teacher.Status,
-				"createTime": teacher.CreatedAt,
+				"id":          teacher.ID,
+				"username":    teacher.Username,
+				"name":        teacher.Name,
+				"role":        teacher.Role,
+				"isAdmin":     teacher.IsAdmin,
+				"roles":       userRoleNames(db, teacher.ID),
+				"status":      teacher.Status,
+				"lockedUntil": teacher.LockedUntil,
+				"createTime":  teacher.CreatedAt,
 			})
 		}
 
@@ -592,6 +734,11 @@ func CreateStudent(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 只能向可编辑的班级添加学生
+		if !requireStudentClassAccess(db, c, request.ClassId, accessEdit) {
+			return
+		}
+
 		// 检查用户名是否已存在
 		var existingUser models.User
 		if err := db.Where("username = ? AND role = 1", request.Username).First(&existingUser).Error; err == nil {
@@ -608,9 +755,20 @@ func CreateStudent(db *gorm.DB) gin.HandlerFunc {
 			}
 		}
 
+		if err := models.ValidatePassword(request.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		passwordHash, err := models.HashPassword(request.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+
 		student := models.User{
 			Username:  request.Username,
-			Password:  models.HashPassword(request.Password),
+			Password:  passwordHash,
 			Role:      1, // 1: student
 			Name:      request.Name,
 			StudentID: request.StudentID,
@@ -624,6 +782,7 @@ func CreateStudent(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create student"})
 			return
 		}
+		recordAudit(db, c, models.AuditStudentCreate, "user", student.ID, nil, auditUser(student))
 
 		c.JSON(http.StatusCreated, gin.H{
 			"id":        student.ID,
@@ -660,6 +819,17 @@ func UpdateStudent(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		before := auditUser(student)
+
+		// 需要对学生当前班级和目标班级都有编辑权限
+		if !requireStudentClassAccess(db, c, student.ClassId, accessEdit) {
+			return
+		}
+		if request.ClassId != 0 && request.ClassId != student.ClassId &&
+			!requireStudentClassAccess(db, c, request.ClassId, accessEdit) {
+			return
+		}
+
 		if request.Name != "" {
 			student.Name = request.Name
 		}
@@ -670,13 +840,27 @@ func UpdateStudent(db *gorm.DB) gin.HandlerFunc {
 			student.Major = request.Major
 		}
 		if request.Password != "" {
-			student.Password = models.HashPassword(request.Password)
+			if err := models.ValidatePassword(request.Password); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			passwordHash, err := models.HashPassword(request.Password)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+				return
+			}
+			student.Password = passwordHash
+			student.RandomPassword = false
 		}
 
 		if err := db.Save(&student).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update student"})
 			return
 		}
+		recordAudit(db, c, models.AuditStudentUpdate, "user", student.ID, before, auditUser(student))
+		if request.Password != "" {
+			recordAudit(db, c, models.AuditStudentPasswordReset, "user", student.ID, nil, nil)
+		}
 
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Student updated successfully",
@@ -694,10 +878,17 @@ func DeleteStudent(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if !requireStudentClassAccess(db, c, student.ClassId, accessEdit) {
+			return
+		}
+
 		if err := db.Delete(&student).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete student"})
 			return
 		}
+		db.Where("user_id = ?", student.ID).Delete(&models.UserIdentity{})
+		recordAudit(db, c, models.AuditStudentDelete, "user", student.ID, auditUser(student), nil)
+		revokeUserSessions(db, student.ID)
 
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Student deleted successfully",
@@ -725,6 +916,30 @@ func ImportStudents(db *gorm.DB) gin.HandlerFunc {
 				return
 			}
 
+			// 只能向可编辑的班级导入学生
+			if studentClassAccess(db, c, student.ClassId) < accessEdit {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error":   "No permission to access this class",
+					"message": "没有该班级的编辑权限",
+					"classId": student.ClassId,
+					"index":   i,
+				})
+				return
+			}
+
+			// 如果提供了密码，检查是否符合密码策略
+			if student.Password != "" {
+				if err := models.ValidatePassword(student.Password); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{
+						"error":    err.Error(),
+						"message":  "密码不符合安全要求",
+						"username": student.Username,
+						"index":    i,
+					})
+					return
+				}
+			}
+
 			// 检查用户名是否已存在
 			var existingUser models.User
 			if err := db.Where("username = ? AND role = 1", student.Username).First(&existingUser).Error; err == nil {
@@ -752,14 +967,34 @@ func ImportStudents(db *gorm.DB) gin.HandlerFunc {
 			}
 		}
 
-		// 转换为学生用户格式
+		// 转换为学生用户格式，未提供密码的学生生成随机初始密码
 		var userStudents []models.User
-		password := models.HashPassword("123456") // 默认密码
+		var initialPasswords []gin.H
 		for _, student := range students {
+			password := student.Password
+			if password == "" {
+				generated, err := models.GeneratePassword()
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate password"})
+					return
+				}
+				password = generated
+				initialPasswords = append(initialPasswords, gin.H{
+					"username": student.Username,
+					"password": generated,
+				})
+			}
+
+			passwordHash, err := models.HashPassword(password)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+				return
+			}
+
 			userStudents = append(userStudents, models.User{
 				Username:  student.Username,
-				Password:  password, // 默认密码
-				Role:      1,        // 1: student
+				Password:  passwordHash,
+				Role:      1, // 1: student
 				Name:      student.Name,
 				StudentID: student.StudentID,
 				ClassId:   student.ClassId,
@@ -774,101 +1009,82 @@ func ImportStudents(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import students"})
 			return
 		}
+		for _, student := range userStudents {
+			recordAudit(db, c, models.AuditStudentImport, "user", student.ID, nil, auditUser(student))
+		}
+
+		// 确保返回空数组而不是null
+		if initialPasswords == nil {
+			initialPasswords = []gin.H{}
+		}
 
 		c.JSON(http.StatusCreated, gin.H{
-			"message": "Students imported successfully",
-			"count":   len(userStudents),
+			"message":          "Students imported successfully",
+			"count":            len(userStudents),
+			"initialPasswords": initialPasswords,
 		})
 	}
 }
 
-// ExportStudents 导出学生列表
+// ExportStudents 导出学生列表，支持 keyword、classId 过滤
+//
+// format=xlsx（默认）或 csv 下载文件，format=json 返回JSON
 func ExportStudents(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var students []models.User
-		if err := db.Where("role = 1").Find(&students).Error; err != nil { // 1: student
+		query := db.Model(&models.User{}).Where("role = 1").Scopes(studentsScope(db, c)) // 1: student
+		if keyword := c.Query("keyword"); keyword != "" {
+			search := "%" + keyword + "%"
+			query = query.Where("name LIKE ? OR username LIKE ? OR student_id LIKE ?", search, search, search)
+		}
+		if classID := c.Query("classId"); classID != "" {
+			query = query.Where("class_id = ?", classID)
+		}
+		if err := query.Order("class_id, student_id, id").Find(&students).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch students"})
 			return
 		}
 
-		// 转换为导出格式
-		var exportData []gin.H
-		for _, student := range students {
-			// 获取班级信息
-			var classInfo models.Class
-			db.First(&classInfo, student.ClassId)
-
-			exportData = append(exportData, gin.H{
-				"username":   student.Username,
-				"studentId":  student.StudentID,
-				"name":       student.Name,
-				"className":  classInfo.Name,
-				"major":      student.Major,
-				"phone":      student.Phone,
-				"createTime": student.CreatedAt.Format("2006-01-02 15:04:05"),
-			})
+		// 班级名称
+		var classes []models.Class
+		db.Find(&classes)
+		classNames := map[uint]string{}
+		for _, class := range classes {
+			classNames[class.ID] = class.Name
+		}
+
+		if c.Query("format") == "json" {
+			exportData := []gin.H{}
+			for _, student := range students {
+				exportData = append(exportData, gin.H{
+					"username":   student.Username,
+					"studentId":  student.StudentID,
+					"name":       student.Name,
+					"className":  classNames[uint(student.ClassId)],
+					"major":      student.Major,
+					"phone":      student.Phone,
+					"createTime": student.CreatedAt.Format("2006-01-02 15:04:05"),
+				})
+			}
+			c.JSON(http.StatusOK, exportData)
+			return
 		}
 
-		c.JSON(http.StatusOK, exportData)
-	}
-}
-
-// calculateScore 计算考试分数
-func calculateScore(answers []ans, examID uint, db *gorm.DB) int {
-	var totalScore int
-
-	// 获取试卷的所有题目
-	var questions []models.Question
-	if err := db.Where("exam_id = ?", examID).Find(&questions).Error; err != nil {
-		return 0
-	}
-
-	// 创建题目ID到题目的映射
-	questionMap := make(map[uint]models.Question)
-	for _, q := range questions {
-		questionMap[q.ID] = q
-	}
-
-	// 计算分数
-	for _, answer := range answers {
-		question, exists := questionMap[answer.QuestionID]
-		if !exists {
-			continue // 题目不存在
+		table, ok := startExport(c, "students", []string{"students"}, "students")
+		if !ok {
+			return
 		}
-
-		if question.Type == "single" {
-			// 单选题评分
-			if answer.Answer == question.Answer {
-				totalScore += question.Score
-			}
-		} else if question.Type == "fill" {
-			// 填空题评分
-			if c := checkFillAnswerArray(answer.Answers, question.Answers); c > 0 {
-				totalScore += question.Score * c / len(question.Answers)
-			}
+		// 列与导入模板一致，导出的文件可以直接修改后导入
+		table.Sheet("students", "学生列表")
+		table.Header("学生账号", "学号", "姓名", "班级", "专业", "联系电话", "创建时间")
+		for _, student := range students {
+			table.Row(student.Username, student.StudentID, student.Name, classNames[uint(student.ClassId)],
+				student.Major, student.Phone, student.CreatedAt)
 		}
-	}
-
-	return totalScore
-}
-
-// checkFillAnswerArray 检查填空题数组答案是否正确
-func checkFillAnswerArray(studentAnswer []string, correctAnswers models.Answers) int {
-	// 如果学生没有作答，返回false
-	if len(studentAnswer) == 0 {
-		return 0
-	}
-
-	var c int
-	for k, answer := range studentAnswer {
-		for _, correctAnswer := range correctAnswers[k].Options {
-			if answer == correctAnswer {
-				c++
-				break
-			}
+		if err := table.Close(); err != nil {
+			c.Error(err)
 		}
 	}
-	return c
 }
 
 // getExamStatus 根据开始时间和结束时间计算考试状态
@@ -0,0 +1,475 @@
+package handlers
+
+import (
+	"net/http"
+	"server/models"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 学习预警的默认阈值，可以通过查询参数修改
+const (
+	riskWindow       = 5    // 判断趋势和不及格次数时使用最近几次考试
+	riskDecline      = 5.0  // 得分率平均每次考试下降超过多少个百分点视为成绩下滑
+	riskFailCount    = 2    // 最近几次考试中不及格达到多少次
+	riskMissedCount  = 1    // 缺考达到多少次
+	tagStrongPercent = 80.0 // 知识点得分率不低于此值为强项
+	tagWeakPercent   = 60.0 // 知识点得分率低于此值为弱项
+)
+
+// progressEntry 学生一次考试的成绩
+type progressEntry struct {
+	AssignmentID   uint      `json:"assignmentId"`
+	ResultID       uint      `json:"resultId"`
+	ExamTitle      string    `json:"examTitle"`
+	StartTime      string    `json:"startTime"`
+	SubmitTime     time.Time `json:"submitTime"`
+	Score          int       `json:"score"`
+	TotalScore     int       `json:"totalScore"`
+	Percent        float64   `json:"percent"` // 得分率（按试卷总分折算）
+	PassScore      int       `json:"passScore"`
+	Passed         bool      `json:"passed"`
+	PercentileRank float64   `json:"percentileRank"` // 在班级中的百分位（0-100）
+	ClassRank      int       `json:"classRank"`
+	ClassSize      int       `json:"classSize"`
+}
+
+// tagPerformance 学生在某个知识点上的得分情况
+type tagPerformance struct {
+	Tag           string  `json:"tag"`
+	Earned        int     `json:"earned"`
+	MaxPoints     int     `json:"maxPoints"`
+	Percent       float64 `json:"percent"`
+	QuestionCount int     `json:"questionCount"`
+}
+
+// missedExam 考试已结束但没有提交（免考的除外）
+type missedExam struct {
+	AssignmentID uint   `json:"assignmentId"`
+	ExamTitle    string `json:"examTitle"`
+	EndTime      string `json:"endTime"`
+}
+
+// studentProgress 学生的成绩变化、班级排名和知识点掌握情况
+type studentProgress struct {
+	StudentID      uint             `json:"studentId"`
+	StudentNo      string           `json:"studentNo"`
+	Name           string           `json:"name"`
+	ClassID        uint             `json:"classId"`
+	Entries        []progressEntry  `json:"entries"`
+	Trend          *float64         `json:"trend"`       // 所有考试得分率的线性趋势（每次考试变化的百分点）
+	RecentTrend    *float64         `json:"recentTrend"` // 最近几次考试的趋势
+	AveragePercent *float64         `json:"averagePercent"`
+	HighestPercent *float64         `json:"highestPercent"`
+	PassedExams    int              `json:"passedExams"`
+	FailedExams    int              `json:"failedExams"`
+	Missed         []missedExam     `json:"missed"`
+	Tags           []tagPerformance `json:"tags"`
+	Strengths      []string         `json:"strengths"`
+	Weaknesses     []string         `json:"weaknesses"`
+}
+
+// classScoreCache 考试安排中每个学生（最后一次提交）的成绩，计算同一班级多个学生时复用
+type classScoreCache map[uint][]int
+
+// load 加载考试安排的成绩
+func (cache classScoreCache) load(db *gorm.DB, assignmentIDs []uint) {
+	var missing []uint
+	for _, id := range assignmentIDs {
+		if _, ok := cache[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	var results []models.ExamResult
+	db.Select("id", "exam_assignment_id", "student_id", "score").
+		Where("exam_assignment_id IN ?", missing).Order("id").Find(&results)
+	latest := map[[2]uint]int{}
+	for _, result := range results {
+		latest[[2]uint{result.ExamAssignmentID, result.StudentID}] = result.Score
+	}
+	for _, id := range missing {
+		cache[id] = []int{}
+	}
+	for key, score := range latest {
+		cache[key[0]] = append(cache[key[0]], score)
+	}
+}
+
+// percentileRank 成绩在一组成绩中的百分位（低于该成绩的人数加相同成绩人数的一半）和名次
+func percentileRank(scores []int, score int) (float64, int) {
+	if len(scores) == 0 {
+		return 0, 0
+	}
+	below, equal, above := 0, 0, 0
+	for _, other := range scores {
+		switch {
+		case other < score:
+			below++
+		case other == score:
+			equal++
+		default:
+			above++
+		}
+	}
+	return roundPercent((float64(below) + float64(equal)/2) / float64(len(scores)) * 100), above + 1
+}
+
+// trendSlope 得分率随考试次数变化的最小二乘斜率，少于两次考试时返回 nil
+func trendSlope(values []float64) *float64 {
+	n := float64(len(values))
+	if len(values) < 2 {
+		return nil
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for i, value := range values {
+		x := float64(i)
+		sumX += x
+		sumY += value
+		sumXY += x * value
+		sumXX += x * x
+	}
+	slope := roundPercent((n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX))
+	return &slope
+}
+
+// buildStudentProgress 计算学生的成绩变化，每次考试取最后一次提交；releasedOnly 为 true 时只包含已公布的成绩
+func buildStudentProgress(db *gorm.DB, student models.User, releasedOnly bool, cache classScoreCache) (studentProgress, error) {
+	progress := studentProgress{
+		StudentID:  student.ID,
+		StudentNo:  student.StudentID,
+		Name:       student.Name,
+		ClassID:    uint(student.ClassId),
+		Entries:    []progressEntry{},
+		Missed:     []missedExam{},
+		Tags:       []tagPerformance{},
+		Strengths:  []string{},
+		Weaknesses: []string{},
+	}
+	if cache == nil {
+		cache = classScoreCache{}
+	}
+
+	var results []models.ExamResult
+	if err := db.Preload("ExamAssignment.Exam").Where("student_id = ?", student.ID).Order("id").Find(&results).Error; err != nil {
+		return progress, err
+	}
+	latest := map[uint]models.ExamResult{}
+	for _, result := range results {
+		if releasedOnly && !resultsReleased(result.ExamAssignment) {
+			continue
+		}
+		latest[result.ExamAssignmentID] = result
+	}
+
+	assignmentIDs := make([]uint, 0, len(latest))
+	for id := range latest {
+		assignmentIDs = append(assignmentIDs, id)
+	}
+	cache.load(db, assignmentIDs)
+
+	for _, result := range latest {
+		assignment := result.ExamAssignment
+		entry := progressEntry{
+			AssignmentID: assignment.ID,
+			ResultID:     result.ID,
+			ExamTitle:    assignment.Exam.Title,
+			StartTime:    assignment.StartTime,
+			SubmitTime:   result.CreatedAt,
+			Score:        result.Score,
+			TotalScore:   assignment.Exam.TotalScore,
+			Percent:      roundPercent(scorePercent(result.Score, assignment.Exam.TotalScore)),
+			PassScore:    assignment.PassScore,
+			Passed:       result.Score >= assignment.PassScore,
+			ClassSize:    len(cache[assignment.ID]),
+		}
+		entry.PercentileRank, entry.ClassRank = percentileRank(cache[assignment.ID], result.Score)
+		progress.Entries = append(progress.Entries, entry)
+	}
+	sort.SliceStable(progress.Entries, func(i, j int) bool {
+		if progress.Entries[i].StartTime != progress.Entries[j].StartTime {
+			return progress.Entries[i].StartTime < progress.Entries[j].StartTime
+		}
+		return progress.Entries[i].ResultID < progress.Entries[j].ResultID
+	})
+
+	percents := make([]float64, len(progress.Entries))
+	sum := 0.0
+	for i, entry := range progress.Entries {
+		percents[i] = entry.Percent
+		sum += entry.Percent
+		if entry.Passed {
+			progress.PassedExams++
+		} else {
+			progress.FailedExams++
+		}
+		if progress.HighestPercent == nil || entry.Percent > *progress.HighestPercent {
+			highest := entry.Percent
+			progress.HighestPercent = &highest
+		}
+	}
+	if len(percents) > 0 {
+		average := roundPercent(sum / float64(len(percents)))
+		progress.AveragePercent = &average
+	}
+	progress.Trend = trendSlope(percents)
+	if len(percents) > riskWindow {
+		percents = percents[len(percents)-riskWindow:]
+	}
+	progress.RecentTrend = trendSlope(percents)
+
+	// 缺考：班级中已结束但没有提交、也没有免考的考试
+	if student.ClassId != 0 {
+		var assignments []models.ExamAssignment
+		db.Preload("Exam").Where("class_id = ?", student.ClassId).Order("start_time, id").Find(&assignments)
+		var excused []uint
+		db.Model(&models.GradebookExcusal{}).Where("student_id = ?", student.ID).Pluck("exam_assignment_id", &excused)
+		var submitted []uint
+		db.Model(&models.ExamResult{}).Where("student_id = ?", student.ID).Distinct().Pluck("exam_assignment_id", &submitted)
+		for _, assignment := range assignments {
+			if containsID(submitted, assignment.ID) || containsID(excused, assignment.ID) ||
+				getExamStatus(assignment.StartTime, assignment.EndTime) != "已结束" {
+				continue
+			}
+			progress.Missed = append(progress.Missed, missedExam{
+				AssignmentID: assignment.ID,
+				ExamTitle:    assignment.Exam.Title,
+				EndTime:      assignment.EndTime,
+			})
+		}
+	}
+
+	progress.Tags = tagPerformances(db, progress.Entries)
+	for _, tag := range progress.Tags {
+		if tag.Percent >= tagStrongPercent {
+			progress.Strengths = append(progress.Strengths, tag.Tag)
+		} else if tag.Percent < tagWeakPercent {
+			progress.Weaknesses = append(progress.Weaknesses, tag.Tag)
+		}
+	}
+	return progress, nil
+}
+
+// tagPerformances 按题目的知识点标签汇总学生的得分，按得分率从高到低排列
+func tagPerformances(db *gorm.DB, entries []progressEntry) []tagPerformance {
+	ids := make([]uint, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ResultID
+	}
+	records := loadResultAnswers(db, ids)
+
+	tagsByQuestion := questionTags(db, records)
+
+	byTag := map[string]*tagPerformance{}
+	for _, byQuestion := range records {
+		for questionID, record := range byQuestion {
+			for _, tag := range tagsByQuestion[questionID] {
+				performance, ok := byTag[tag]
+				if !ok {
+					performance = &tagPerformance{Tag: tag}
+					byTag[tag] = performance
+				}
+				performance.Earned += record.AwardedPoints
+				performance.MaxPoints += record.MaxPoints
+				performance.QuestionCount++
+			}
+		}
+	}
+
+	performances := make([]tagPerformance, 0, len(byTag))
+	for _, performance := range byTag {
+		performance.Percent = roundPercent(scorePercent(performance.Earned, performance.MaxPoints))
+		performances = append(performances, *performance)
+	}
+	sort.SliceStable(performances, func(i, j int) bool {
+		if performances[i].Percent != performances[j].Percent {
+			return performances[i].Percent > performances[j].Percent
+		}
+		return performances[i].Tag < performances[j].Tag
+	})
+	return performances
+}
+
+// questionTags 答卷中题目的知识点标签（包括已删除的题目）
+func questionTags(db *gorm.DB, records map[uint]map[uint]models.ResultAnswer) map[uint]models.StringList {
+	seen := map[uint]bool{}
+	var questionIDs []uint
+	for _, byQuestion := range records {
+		for questionID := range byQuestion {
+			if !seen[questionID] {
+				seen[questionID] = true
+				questionIDs = append(questionIDs, questionID)
+			}
+		}
+	}
+
+	tags := make(map[uint]models.StringList, len(questionIDs))
+	if len(questionIDs) == 0 {
+		return tags
+	}
+	var questions []models.Question
+	db.Unscoped().Select("id", "tags").Where("id IN ?", questionIDs).Find(&questions)
+	for _, question := range questions {
+		if len(question.Tags) > 0 {
+			tags[question.ID] = question.Tags
+		}
+	}
+	return tags
+}
+
+// GetStudentAnalytics 教师查看学生的成绩变化趋势、每次考试的班级百分位和知识点强弱项
+func GetStudentAnalytics(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var student models.User
+		if err := db.Where("id = ? AND role = 1", c.Param("id")).First(&student).Error; err != nil { // 1: student
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+			return
+		}
+
+		// 需要能访问学生所在的班级
+		if _, ok := requireClassAccess(db, c, student.ClassId, accessView); !ok {
+			return
+		}
+
+		progress, err := buildStudentProgress(db, student, false, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build student analytics"})
+			return
+		}
+		c.JSON(http.StatusOK, progress)
+	}
+}
+
+// GetMyAnalytics 学生查看自己的成绩变化（只包含已公布的成绩）
+func GetMyAnalytics(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var student models.User
+		if err := db.First(&student, currentUserID(c)).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+			return
+		}
+
+		progress, err := buildStudentProgress(db, student, true, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build student analytics"})
+			return
+		}
+		c.JSON(http.StatusOK, progress)
+	}
+}
+
+// GetAtRiskStudents 班级学习预警：标记成绩持续下滑、多次不及格或缺考的学生
+//
+// 查询参数 window（最近几次考试）、decline（每次考试下降的百分点）、fails（不及格次数）、missed（缺考次数）可调整阈值
+func GetAtRiskStudents(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := requireClassAccess(db, c, c.Param("id"), accessView)
+		if !ok {
+			return
+		}
+
+		window := queryInt(c, "window", riskWindow)
+		fails := queryInt(c, "fails", riskFailCount)
+		missed := queryInt(c, "missed", riskMissedCount)
+		decline := riskDecline
+		if value, err := strconv.ParseFloat(c.Query("decline"), 64); err == nil && value > 0 {
+			decline = value
+		}
+
+		var students []models.User
+		if err := db.Where("class_id = ? AND role = 1", class.ID).Order("student_id, id").Find(&students).Error; err != nil { // 1: student
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch students"})
+			return
+		}
+
+		cache := classScoreCache{}
+		flagged := []gin.H{}
+		for _, student := range students {
+			progress, err := buildStudentProgress(db, student, false, cache)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build student analytics"})
+				return
+			}
+
+			recent := progress.Entries
+			if len(recent) > window {
+				recent = recent[len(recent)-window:]
+			}
+			percents := make([]float64, len(recent))
+			recentFails := 0
+			for i, entry := range recent {
+				percents[i] = entry.Percent
+				if !entry.Passed {
+					recentFails++
+				}
+			}
+			slope := trendSlope(percents)
+
+			flags := []string{}
+			if len(recent) >= 3 && slope != nil && *slope <= -decline {
+				flags = append(flags, "declining")
+			}
+			if recentFails >= fails {
+				flags = append(flags, "repeated_fails")
+			}
+			if len(progress.Missed) >= missed {
+				flags = append(flags, "missed_exams")
+			}
+			if len(flags) == 0 {
+				continue
+			}
+
+			var lastPercent *float64
+			if len(recent) > 0 {
+				lastPercent = &recent[len(recent)-1].Percent
+			}
+			flagged = append(flagged, gin.H{
+				"studentId":      student.ID,
+				"studentNo":      student.StudentID,
+				"name":           student.Name,
+				"flags":          flags,
+				"recentTrend":    slope,
+				"recentFails":    recentFails,
+				"recentExams":    len(recent),
+				"missed":         progress.Missed,
+				"averagePercent": progress.AveragePercent,
+				"lastPercent":    lastPercent,
+				"weaknesses":     progress.Weaknesses,
+			})
+		}
+
+		// 预警项多的学生排在前面
+		sort.SliceStable(flagged, func(i, j int) bool {
+			return len(flagged[i]["flags"].([]string)) > len(flagged[j]["flags"].([]string))
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"classId":       class.ID,
+			"className":     class.Name,
+			"totalStudents": len(students),
+			"atRiskCount":   len(flagged),
+			"students":      flagged,
+			"thresholds": gin.H{
+				"window":  window,
+				"decline": decline,
+				"fails":   fails,
+				"missed":  missed,
+			},
+		})
+	}
+}
+
+// queryInt 读取正整数查询参数，无效时使用默认值
+func queryInt(c *gin.Context, name string, fallback int) int {
+	if value, err := strconv.Atoi(c.Query(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
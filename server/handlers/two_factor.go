@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"net/http"
+	"server/models"
+	"server/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 两步验证配置
+const (
+	twoFactorIssuer   = "考试系统"
+	recoveryCodeCount = 10
+)
+
+// respondTwoFactorChallenge 密码验证通过后返回两步验证挑战
+func respondTwoFactorChallenge(c *gin.Context, user models.User, tokenType string) {
+	challengeToken, err := utils.GenerateChallengeToken(user.ID, tokenType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	response := gin.H{"challengeToken": challengeToken}
+	if tokenType == utils.TokenTypeTwoFactorSetup {
+		response["twoFactorSetupRequired"] = true
+		response["message"] = "Two-factor authentication must be set up"
+	} else {
+		response["twoFactorRequired"] = true
+		response["message"] = "Two-factor authentication required"
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// challengeUser 根据挑战令牌加载用户
+func challengeUser(db *gorm.DB, challengeToken, tokenType string) (models.User, bool) {
+	var user models.User
+	claims, err := utils.ParseChallengeToken(challengeToken, tokenType)
+	if err != nil {
+		return user, false
+	}
+	if err := db.First(&user, claims.UserID).Error; err != nil || user.Status != 1 {
+		return user, false
+	}
+	return user, true
+}
+
+// VerifyTwoFactorLogin 登录第二步：校验动态码或恢复码后签发令牌
+func VerifyTwoFactorLogin(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			ChallengeToken string `json:"challengeToken" binding:"required"`
+			Code           string `json:"code"`
+			RecoveryCode   string `json:"recoveryCode"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		user, ok := challengeUser(db, request.ChallengeToken, utils.TokenTypeTwoFactor)
+		if !ok || !user.TwoFactorEnabled {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+			return
+		}
+
+		if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+			recordLoginLog(db, c, user.ID, user.Username, models.LoginReasonAccountLocked)
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":      "Account is temporarily locked",
+				"retryAfter": int(time.Until(*user.LockedUntil).Seconds()) + 1,
+			})
+			return
+		}
+
+		var verified bool
+		if request.RecoveryCode != "" {
+			verified = useRecoveryCode(db, user.ID, request.RecoveryCode)
+		} else {
+			verified = verifyTOTPCode(db, &user, request.Code)
+		}
+
+		// 第二步验证失败同样计入登录失败次数
+		if !verified {
+			registerLoginFailure(db, c, &user, models.LoginReasonInvalidTwoFactor)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+			return
+		}
+
+		completeLogin(db, c, user, nil)
+	}
+}
+
+// SetupTwoFactorLogin 强制启用两步验证时，在登录过程中生成密钥
+func SetupTwoFactorLogin(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			ChallengeToken string `json:"challengeToken" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		user, ok := challengeUser(db, request.ChallengeToken, utils.TokenTypeTwoFactorSetup)
+		if !ok || user.TwoFactorEnabled {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+			return
+		}
+
+		startTwoFactorSetup(db, c, &user)
+	}
+}
+
+// EnrollTwoFactorLogin 强制启用两步验证时，在登录过程中确认绑定并签发令牌
+func EnrollTwoFactorLogin(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			ChallengeToken string `json:"challengeToken" binding:"required"`
+			Code           string `json:"code" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		user, ok := challengeUser(db, request.ChallengeToken, utils.TokenTypeTwoFactorSetup)
+		if !ok || user.TwoFactorEnabled {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+			return
+		}
+
+		codes, ok := confirmTwoFactorSetup(db, c, &user, request.Code)
+		if !ok {
+			return
+		}
+
+		completeLogin(db, c, user, gin.H{"recoveryCodes": codes})
+	}
+}
+
+// GetTwoFactorStatus 获取当前教师的两步验证状态
+func GetTwoFactorStatus(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentTwoFactorUser(db, c)
+		if !ok {
+			return
+		}
+
+		var remaining int64
+		db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+
+		c.JSON(http.StatusOK, gin.H{
+			"enabled":                user.TwoFactorEnabled,
+			"required":               getSetting(db, models.SettingRequireTeacher2FA) == "true",
+			"remainingRecoveryCodes": remaining,
+		})
+	}
+}
+
+// SetupTwoFactor 生成新的TOTP密钥，返回扫码URI，需调用确认接口后才生效
+func SetupTwoFactor(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentTwoFactorUser(db, c)
+		if !ok {
+			return
+		}
+
+		if user.TwoFactorEnabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+
+		startTwoFactorSetup(db, c, &user)
+	}
+}
+
+// ConfirmTwoFactor 校验动态码，确认启用两步验证并返回恢复码
+func ConfirmTwoFactor(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Code string `json:"code" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		user, ok := currentTwoFactorUser(db, c)
+		if !ok {
+			return
+		}
+
+		if user.TwoFactorEnabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+
+		codes, ok := confirmTwoFactorSetup(db, c, &user, request.Code)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"recoveryCodes": codes,
+			"message":       "Two-factor authentication enabled",
+		})
+	}
+}
+
+// DisableTwoFactor 关闭两步验证，需要密码和动态码
+func DisableTwoFactor(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Password string `json:"password" binding:"required"`
+			Code     string `json:"code" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		user, ok := currentTwoFactorUser(db, c)
+		if !ok {
+			return
+		}
+
+		if getSetting(db, models.SettingRequireTeacher2FA) == "true" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is mandatory"})
+			return
+		}
+
+		if !user.TwoFactorEnabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+			return
+		}
+
+		if !models.CheckPassword(request.Password, user.Password) || !verifyTOTPCode(db, &user, request.Code) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password or verification code"})
+			return
+		}
+
+		if err := resetTwoFactor(db, user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+	}
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧恢复码全部失效
+func RegenerateRecoveryCodes(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Code string `json:"code" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		user, ok := currentTwoFactorUser(db, c)
+		if !ok {
+			return
+		}
+
+		if !user.TwoFactorEnabled || !verifyTOTPCode(db, &user, request.Code) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+			return
+		}
+
+		codes, err := replaceRecoveryCodes(db, user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+	}
+}
+
+// ResetTwoFactor 管理员重置教师的两步验证（如丢失设备）
+func ResetTwoFactor(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		var teacher models.User
+		if err := db.Where("id = ? AND role = 2", id).First(&teacher).Error; err != nil { // 2: teacher
+			c.JSON(http.StatusNotFound, gin.H{"error": "Teacher not found"})
+			return
+		}
+
+		if err := resetTwoFactor(db, teacher.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+			return
+		}
+		recordAudit(db, c, models.AuditTwoFactorReset, "user", teacher.ID, gin.H{"twoFactorEnabled": teacher.TwoFactorEnabled}, nil)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset successfully"})
+	}
+}
+
+// currentTwoFactorUser 加载当前登录的用户
+func currentTwoFactorUser(db *gorm.DB, c *gin.Context) (models.User, bool) {
+	var user models.User
+
+	userInfo, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return user, false
+	}
+
+	userMap := userInfo.(gin.H)
+	if err := db.First(&user, userMap["id"].(uint)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return user, false
+	}
+	return user, true
+}
+
+// startTwoFactorSetup 生成待确认的TOTP密钥并返回扫码信息
+func startTwoFactorSetup(db *gorm.DB, c *gin.Context, user *models.User) {
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	if err := db.Model(user).Update("two_factor_secret", secret).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":          secret,
+		"provisioningUri": utils.TOTPProvisioningURI(secret, user.Username, twoFactorIssuer),
+	})
+}
+
+// confirmTwoFactorSetup 校验动态码后启用两步验证，返回新生成的恢复码
+func confirmTwoFactorSetup(db *gorm.DB, c *gin.Context, user *models.User, code string) ([]string, bool) {
+	if user.TwoFactorSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor setup has not been started"})
+		return nil, false
+	}
+
+	if !verifyTOTPCode(db, user, code) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return nil, false
+	}
+
+	if err := db.Model(user).Update("two_factor_enabled", true).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return nil, false
+	}
+
+	codes, err := replaceRecoveryCodes(db, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return nil, false
+	}
+	return codes, true
+}
+
+// verifyTOTPCode 校验动态码，同一时间步的动态码只能使用一次
+func verifyTOTPCode(db *gorm.DB, user *models.User, code string) bool {
+	step, ok := utils.ValidateTOTP(user.TwoFactorSecret, code, time.Now())
+	if !ok || step <= user.TwoFactorLastStep {
+		return false
+	}
+
+	user.TwoFactorLastStep = step
+	db.Model(user).Update("two_factor_last_step", step)
+	return true
+}
+
+// useRecoveryCode 校验并消耗一个恢复码
+func useRecoveryCode(db *gorm.DB, userID uint, code string) bool {
+	hash := utils.HashToken(utils.NormalizeRecoveryCode(code))
+
+	now := time.Now()
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", &now)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// replaceRecoveryCodes 生成新的恢复码并删除旧恢复码
+func replaceRecoveryCodes(db *gorm.DB, userID uint) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, code := range codes {
+			record := models.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(code)}
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// resetTwoFactor 清除用户的两步验证配置和恢复码
+func resetTwoFactor(db *gorm.DB, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"two_factor_secret":    "",
+			"two_factor_enabled":   false,
+			"two_factor_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"server/middlewares"
 	"server/models"
 	"server/utils"
 	"strconv"
@@ -97,6 +98,18 @@ func handleWebSocketMessages(conn *websocket.Conn, db *gorm.DB) {
 					continue
 				}
 
+				// 与认证中间件相同，拒绝已吊销的会话和停用的账号
+				if err := middlewares.CheckSession(db, claims); err != nil {
+					conn.WriteJSON(gin.H{"error": err.Error()})
+					continue
+				}
+
+				// 模拟登录令牌只读，不能开始计时或控制考试
+				if claims.ReadOnly {
+					conn.WriteJSON(gin.H{"error": "Read-only token cannot connect"})
+					continue
+				}
+
 				// 设置用户ID和类型
 				if claims.Role == 1 { // 1表示学生
 					studentID = claims.UserID
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"server/models"
+	"server/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func TestExamTimerWebSocketRejectsRevokedSessions(t *testing.T) {
+	db := newTestDB(t)
+	InitWebSocketManager(db)
+	router := gin.New()
+	router.GET("/api/exam-timer", ExamTimerWebSocket(db))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	student := seedUser(t, db, models.User{Username: "student", Role: 1, Password: "x"})
+	session := models.UserSession{UserID: student.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	db.Create(&session)
+	token, err := utils.GenerateToken(student.ID, student.Username, student.Role, student.IsAdmin, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// auth 发送认证消息，返回服务端的第一条回复
+	auth := func() gin.H {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/exam-timer", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if err := conn.WriteJSON(gin.H{"type": "auth", "token": token}); err != nil {
+			t.Fatal(err)
+		}
+		var reply gin.H
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatal(err)
+		}
+		return reply
+	}
+
+	if reply := auth(); reply["type"] != "auth_success" {
+		t.Fatalf("unexpected reply: %v", reply)
+	}
+
+	// 退出登录后令牌虽未过期，也不能再连接
+	now := time.Now()
+	db.Model(&session).Update("revoked_at", &now)
+	if reply := auth(); reply["error"] != "Session has been revoked" {
+		t.Fatalf("unexpected reply: %v", reply)
+	}
+
+	// 账号停用
+	db.Model(&session).Update("revoked_at", nil)
+	db.Model(&student).Update("status", 0)
+	if reply := auth(); reply["error"] != "Account is disabled" {
+		t.Fatalf("unexpected reply: %v", reply)
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"server/handlers"
 	"server/middlewares"
 	"server/models"
+	"server/utils"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/sqlite"
@@ -13,10 +16,33 @@ import (
 )
 
 func main() {
+	// 加载JWT配置
+	if err := utils.LoadJWTConfig(); err != nil {
+		log.Fatal("Failed to load JWT config:", err)
+	}
+	// 加载OIDC配置（未配置时不启用外部账号登录）
+	if err := utils.LoadOIDCConfig(); err != nil {
+		log.Fatal("Failed to load OIDC config:", err)
+	}
+	// 加载LDAP配置（未配置时使用本地密码登录）
+	if err := utils.LoadLDAPConfig(); err != nil {
+		log.Fatal("Failed to load LDAP config:", err)
+	}
+	// 加载LTI配置（未配置时不接受LMS启动）
+	if err := utils.LoadLTIConfig(); err != nil {
+		log.Fatal("Failed to load LTI config:", err)
+	}
+
 	init := false
 	if _, err := os.Stat("exam.db"); err != nil {
 		init = true
 	}
+	// 初始管理员密码在创建数据库之前检查，避免创建了数据库却没有管理员账号
+	if password := os.Getenv("ADMIN_PASSWORD"); init && password != "" {
+		if err := models.ValidatePassword(password); err != nil {
+			log.Fatal("Invalid ADMIN_PASSWORD: ", err)
+		}
+	}
 	// 初始化数据库
 	db, err := gorm.Open(sqlite.Open("exam.db"), &gorm.Config{})
 	if err != nil {
@@ -33,11 +59,40 @@ func main() {
 		&models.LoginLog{},
 		&models.Message{},
 		&models.ExamTimer{},
+		&models.UserSession{},
+		&models.RecoveryCode{},
+		&models.SystemSetting{},
+		&models.ResourceShare{},
+		&models.Role{},
+		&models.UserRole{},
+		&models.AuditLog{},
+		&models.UserIdentity{},
+		&models.LTIPlatform{},
+		&models.LTIResourceLink{},
+		&models.LTIDeepLinkRequest{},
+		&models.LTIDeepLinkItem{},
+		&models.APIKey{},
+		&models.ResultAnswer{},
+		&models.Regrade{},
+		&models.RegradeChange{},
+		&models.GradeScale{},
+		&models.ScoreAdjustment{},
+		&models.Appeal{},
+		&models.AppealEvent{},
+		&models.GradebookCategory{},
+		&models.GradebookSetting{},
+		&models.GradebookExcusal{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	// 旧版登录日志只记录成功的登录
+	db.Model(&models.LoginLog{}).Where("success IS NULL").Update("success", true)
+
+	// 同步内置角色
+	syncBuiltinRoles(db)
+
 	if init {
 		// 创建唯一索引
 		err = db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_user_username_role ON users (username, role)").Error
@@ -49,15 +104,38 @@ func main() {
 		createDefaultAdmin(db)
 	}
 
+	// 旧版教师账号没有角色，按 IsAdmin 分配内置角色
+	assignDefaultRoles(db)
+
+	// 旧版试卷没有所有者，归属给管理员
+	assignOwnerlessExams(db)
+
+	// 旧版答卷没有每题得分，补充作答记录
+	handlers.MigrateResultAnswers(db)
+
+	// 旧版答卷没有单独保存原始成绩
+	db.Model(&models.ExamResult{}).Where("adjusted = ? AND raw_score <> score", false).Update("raw_score", gorm.Expr("score"))
+
+	// 旧版手动修改的总分没有单独保存调整量（需要在补充原始成绩之后）
+	handlers.MigrateScoreOverrides(db)
+
 	// 初始化WebSocket管理器
 	handlers.InitWebSocketManager(db)
 
 	// 初始化消息调度器
 	handlers.InitMessageScheduler(db)
 
+	// 启动目录定时同步
+	handlers.InitLDAPSync(db)
+
 	// 创建Gin路由
 	r := gin.Default()
 
+	// 只信任 TRUSTED_PROXIES 中的反向代理转发的 X-Forwarded-For，未配置时按连接地址识别客户端，避免伪造来源IP绕过限流
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
 	// 设置路由
 	setupRoutes(r, db)
 
@@ -84,21 +162,118 @@ func createDefaultAdmin(db *gorm.DB) {
 	var adminUser models.User
 	result := db.Where("username = ?", "admin").First(&adminUser)
 
-	// 如果不存在管理员账号，则创建
+	// 如果不存在管理员账号，则创建：密码取 ADMIN_PASSWORD，未设置时随机生成并在首次登录后要求修改
 	if result.Error != nil {
+		password := os.Getenv("ADMIN_PASSWORD")
+		generated := password == ""
+		if generated {
+			var err error
+			if password, err = models.GeneratePassword(); err != nil {
+				log.Printf("Failed to generate admin password: %v", err)
+				return
+			}
+		}
+
+		passwordHash, err := models.HashPassword(password)
+		if err != nil {
+			log.Printf("Failed to hash admin password: %v", err)
+			return
+		}
+
 		adminUser = models.User{
-			Username: "admin",
-			Password: models.HashPassword("admin"), // 使用SHA256加密密码
-			Role:     2,                            // 2: teacher
-			IsAdmin:  1,                            // 1: 是管理员
-			Name:     "系统管理员",
+			Username:           "admin",
+			Password:           passwordHash,
+			MustChangePassword: generated,
+			Role:               2, // 2: teacher
+			IsAdmin:            1, // 1: 是管理员
+			Name:               "系统管理员",
 		}
 
 		if err := db.Create(&adminUser).Error; err != nil {
 			log.Printf("Failed to create admin user: %v", err)
+		} else if generated {
+			// 初始密码只在创建时输出一次
+			log.Printf("Default admin account created: admin / %s (change it after the first login)", password)
 		} else {
-			log.Println("Default admin account created: admin/admin")
+			log.Println("Default admin account created with ADMIN_PASSWORD")
+		}
+	}
+}
+
+// trustedProxies 读取信任的反向代理地址（TRUSTED_PROXIES，逗号分隔的IP或CIDR），未配置时返回nil
+func trustedProxies() []string {
+	var proxies []string
+	for _, item := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			proxies = append(proxies, item)
+		}
+	}
+	return proxies
+}
+
+// syncBuiltinRoles 创建或更新内置角色的权限
+//
+// 管理员角色始终拥有全部权限；其他内置角色加入新版本新增的默认权限、去掉不再默认的权限，
+// 保留管理员对角色权限的其他修改
+func syncBuiltinRoles(db *gorm.DB) {
+	for _, builtin := range models.BuiltinRoles {
+		var role models.Role
+		if err := db.Where("name = ?", builtin.Name).First(&role).Error; err != nil {
+			role = builtin
+			role.BuiltIn = true
+			role.DefaultPermissions = builtin.Permissions
+			if err := db.Create(&role).Error; err != nil {
+				log.Printf("Failed to create role %s: %v", builtin.Name, err)
+			}
+			continue
+		}
+
+		permissions := builtin.Permissions
+		if role.Name != models.RoleAdmin {
+			// 没有记录默认权限的旧数据加入全部默认权限
+			added := builtin.Permissions.Without(role.DefaultPermissions)
+			removed := role.DefaultPermissions.Without(builtin.Permissions)
+			permissions = role.Permissions.Merge(added).Without(removed)
 		}
+		if err := db.Model(&role).Updates(map[string]interface{}{
+			"permissions":         models.Permissions{}.Merge(permissions),
+			"default_permissions": models.Permissions{}.Merge(builtin.Permissions),
+		}).Error; err != nil {
+			log.Printf("Failed to update role %s: %v", builtin.Name, err)
+		}
+	}
+}
+
+// assignDefaultRoles 为没有角色的教师分配内置角色
+func assignDefaultRoles(db *gorm.DB) {
+	var roles []models.Role
+	db.Where("name IN ?", []string{models.RoleAdmin, models.RoleTeacher}).Find(&roles)
+	roleIDs := map[string]uint{}
+	for _, role := range roles {
+		roleIDs[role.Name] = role.ID
+	}
+
+	var teachers []models.User
+	db.Where("role = 2 AND id NOT IN (?)", db.Model(&models.UserRole{}).Select("user_id")).Find(&teachers) // 2: teacher
+	for _, teacher := range teachers {
+		roleName := models.RoleTeacher
+		if teacher.IsAdmin == 1 {
+			roleName = models.RoleAdmin
+		}
+		if err := db.Create(&models.UserRole{UserID: teacher.ID, RoleID: roleIDs[roleName]}).Error; err != nil {
+			log.Printf("Failed to assign role to user %d: %v", teacher.ID, err)
+		}
+	}
+}
+
+// assignOwnerlessExams 将没有所有者的试卷归属给第一个管理员
+func assignOwnerlessExams(db *gorm.DB) {
+	var admin models.User
+	if err := db.Where("role = 2 AND is_admin = 1").Order("id").First(&admin).Error; err != nil { // 2: teacher
+		return
+	}
+	if err := db.Model(&models.Exam{}).Where("created_by = 0").Update("created_by", admin.ID).Error; err != nil {
+		log.Printf("Failed to assign ownerless exams: %v", err)
 	}
 }
 
@@ -115,85 +290,200 @@ func setupRoutes(r *gin.Engine, db *gorm.DB) {
 		// 认证路由
 		auth := api.Group("/auth")
 		{
-			auth.POST("/login", handlers.Login(db))
+			// 按IP限制登录频率，防止暴力破解
+			auth.POST("/login", middlewares.RateLimitMiddleware(10, time.Minute), handlers.Login(db))
+			auth.POST("/refresh", handlers.RefreshToken(db))
+			auth.POST("/logout", middlewares.AuthMiddleware(db), middlewares.RequireUserSession(), handlers.Logout(db))
+			auth.PUT("/password", middlewares.AuthMiddleware(db), middlewares.RequireUserSession(), handlers.ChangePassword(db))
+
+			// 两步验证登录
+			auth.POST("/2fa/verify", middlewares.RateLimitMiddleware(10, time.Minute), handlers.VerifyTwoFactorLogin(db))
+			auth.POST("/2fa/setup", handlers.SetupTwoFactorLogin(db))
+			auth.POST("/2fa/enroll", middlewares.RateLimitMiddleware(10, time.Minute), handlers.EnrollTwoFactorLogin(db))
+
+			// 外部账号登录（OpenID Connect）
+			auth.GET("/oidc/login", handlers.OIDCLogin())
+			auth.POST("/oidc/callback", middlewares.RateLimitMiddleware(10, time.Minute), handlers.OIDCCallback(db))
+			auth.POST("/oidc/link", middlewares.AuthMiddleware(db), middlewares.RequireUserSession(), handlers.LinkOIDCIdentity())
+			auth.GET("/identities", middlewares.AuthMiddleware(db), middlewares.RequireUserSession(), handlers.GetIdentities(db))
+			auth.DELETE("/identities/:id", middlewares.AuthMiddleware(db), middlewares.RequireUserSession(), handlers.DeleteIdentity(db))
+		}
+
+		// LTI 1.3 工具（由LMS发起登录和启动）
+		lti := api.Group("/lti")
+		{
+			lti.GET("/login", handlers.LTILogin(db))
+			lti.POST("/login", handlers.LTILogin(db))
+			lti.POST("/launch", middlewares.RateLimitMiddleware(30, time.Minute), handlers.LTILaunch(db))
+			lti.GET("/jwks", handlers.GetLTIJWKS(db))
+			lti.POST("/deep-link/:id", middlewares.AuthMiddleware(db), middlewares.TeacherAuthMiddleware(),
+				middlewares.RequirePermission(models.PermExamAssign), handlers.CompleteLTIDeepLink(db))
 		}
 
 		// 学生路由
 		student := api.Group("/student")
-		student.Use(middlewares.AuthMiddleware()).Use(middlewares.StudentAuthMiddleware())
+		student.Use(middlewares.AuthMiddleware(db)).Use(middlewares.StudentAuthMiddleware())
 		{
 			student.GET("/exams", handlers.GetStudentExams(db))
 			student.GET("/exams/:id", handlers.GetExamDetailsForStudent(db))
 			student.POST("/exams/:id/submit", handlers.SubmitExam(db))
 			student.GET("/results", handlers.GetExamResults(db))
+			student.GET("/results/:resultId", handlers.GetExamResult(db))
+			student.POST("/results/:resultId/appeals", handlers.CreateAppeal(db))
+			student.GET("/appeals", handlers.GetStudentAppeals(db))
 			student.GET("/profile", handlers.GetStudentProfile(db))
+			student.GET("/analytics", handlers.GetMyAnalytics(db))
+			student.GET("/mastery", handlers.GetMyMastery(db))
 		}
 
 		// 教师路由
 		teacher := api.Group("/teacher")
-		teacher.Use(middlewares.AuthMiddleware()).Use(middlewares.TeacherAuthMiddleware())
+		teacher.Use(middlewares.AuthMiddleware(db)).Use(middlewares.TeacherAuthMiddleware())
 		{
 			// 考试管理
-			teacher.GET("/exams", handlers.GetExams(db))
-			teacher.POST("/exams", handlers.CreateExam(db))
-			teacher.GET("/exams/:id", handlers.GetExamDetails(db))
-			teacher.PUT("/exams/:id", handlers.UpdateExam(db))
-			teacher.PUT("/exams/:id/status", handlers.UpdateExamStatus(db))
-			teacher.DELETE("/exams/:id", handlers.DeleteExam(db))
+			teacher.GET("/exams", middlewares.RequirePermission(models.PermExamView), handlers.GetExams(db))
+			teacher.POST("/exams", middlewares.RequirePermission(models.PermExamCreate), handlers.CreateExam(db))
+			teacher.GET("/exams/:id", middlewares.RequirePermission(models.PermExamView), handlers.GetExamDetails(db))
+			teacher.PUT("/exams/:id", middlewares.RequirePermission(models.PermExamEdit), handlers.UpdateExam(db))
+			teacher.PUT("/exams/:id/status", middlewares.RequirePermission(models.PermExamEdit), handlers.UpdateExamStatus(db))
+			teacher.DELETE("/exams/:id", middlewares.RequirePermission(models.PermExamDelete), handlers.DeleteExam(db))
+			teacher.GET("/exams/:id/shares", middlewares.RequirePermission(models.PermExamEdit), handlers.GetShares(db, models.ShareResourceExam))
+			teacher.POST("/exams/:id/shares", middlewares.RequirePermission(models.PermExamEdit), handlers.CreateShare(db, models.ShareResourceExam))
+			teacher.DELETE("/exams/:id/shares/:teacherId", middlewares.RequirePermission(models.PermExamEdit), handlers.DeleteShare(db, models.ShareResourceExam))
+			teacher.GET("/exams/:id/regrade/preview", middlewares.RequirePermission(models.PermResultGrade), handlers.PreviewRegrade(db))
+			teacher.POST("/exams/:id/regrade", middlewares.RequirePermission(models.PermResultGrade), handlers.RegradeExam(db))
+			teacher.GET("/exams/:id/regrades", middlewares.RequirePermission(models.PermResultView), handlers.GetRegrades(db))
 
 			// 试卷分配
-			teacher.GET("/exam-assignments", handlers.GetAssignments(db))
-			teacher.POST("/exam-assignments", handlers.CreateAssignment(db))
-			teacher.PUT("/exam-assignments/:id", handlers.UpdateAssignment(db))
-			teacher.DELETE("/exam-assignments/:id", handlers.DeleteAssignment(db))
+			teacher.GET("/exam-assignments", middlewares.RequirePermission(models.PermExamView), handlers.GetAssignments(db))
+			teacher.POST("/exam-assignments", middlewares.RequirePermission(models.PermExamAssign), handlers.CreateAssignment(db))
+			teacher.PUT("/exam-assignments/:id", middlewares.RequirePermission(models.PermExamAssign), handlers.UpdateAssignment(db))
+			teacher.DELETE("/exam-assignments/:id", middlewares.RequirePermission(models.PermExamAssign), handlers.DeleteAssignment(db))
+			teacher.POST("/exam-assignments/:id/release", middlewares.RequirePermission(models.PermResultGrade), handlers.ReleaseResults(db))
+			teacher.DELETE("/exam-assignments/:id/release", middlewares.RequirePermission(models.PermResultGrade), handlers.WithholdResults(db))
+			teacher.GET("/exam-assignments/:id/adjustments", middlewares.RequirePermission(models.PermResultView), handlers.GetScoreAdjustments(db))
+			teacher.POST("/exam-assignments/:id/adjustments/preview", middlewares.RequirePermission(models.PermResultGrade), handlers.PreviewScoreAdjustment(db))
+			teacher.POST("/exam-assignments/:id/adjustments", middlewares.RequirePermission(models.PermResultGrade), handlers.ApplyScoreAdjustment(db))
+			teacher.DELETE("/exam-assignments/:id/adjustments", middlewares.RequirePermission(models.PermResultGrade), handlers.RevertScoreAdjustment(db))
+
+			// 等级制
+			teacher.GET("/grade-scales", middlewares.RequirePermission(models.PermResultView), handlers.GetGradeScales(db))
+			teacher.POST("/grade-scales", middlewares.RequirePermission(models.PermResultGrade), handlers.CreateGradeScale(db))
+			teacher.PUT("/grade-scales/:id", middlewares.RequirePermission(models.PermResultGrade), handlers.UpdateGradeScale(db))
+			teacher.DELETE("/grade-scales/:id", middlewares.RequirePermission(models.PermResultGrade), handlers.DeleteGradeScale(db))
 
 			// 班级管理
-			teacher.GET("/classes", handlers.GetClasses(db))
-			teacher.POST("/classes", handlers.CreateClass(db))
-			teacher.GET("/classes/:id", handlers.GetClassDetails(db))
-			teacher.PUT("/classes/:id", handlers.UpdateClass(db))
-			teacher.DELETE("/classes/:id", handlers.DeleteClass(db))
-			teacher.GET("/classes/:id/students", handlers.GetClassStudents(db))
-			teacher.GET("/classes/statistics", handlers.GetClassStatistics(db))
+			teacher.GET("/classes", middlewares.RequirePermission(models.PermClassView), handlers.GetClasses(db))
+			teacher.POST("/classes", middlewares.RequirePermission(models.PermClassManage), handlers.CreateClass(db))
+			teacher.GET("/classes/:id", middlewares.RequirePermission(models.PermClassView), handlers.GetClassDetails(db))
+			teacher.PUT("/classes/:id", middlewares.RequirePermission(models.PermClassManage), handlers.UpdateClass(db))
+			teacher.DELETE("/classes/:id", middlewares.RequirePermission(models.PermClassManage), handlers.DeleteClass(db))
+			teacher.GET("/classes/:id/students", middlewares.RequirePermission(models.PermClassView), handlers.GetClassStudents(db))
+			teacher.GET("/classes/:id/at-risk", middlewares.RequirePermission(models.PermResultView), handlers.GetAtRiskStudents(db))
+			teacher.GET("/classes/:id/mastery", middlewares.RequirePermission(models.PermResultView), handlers.GetClassMastery(db))
+			teacher.GET("/classes/:id/gradebook", middlewares.RequirePermission(models.PermResultView), handlers.GetGradebook(db))
+			teacher.GET("/classes/:id/gradebook/export", middlewares.RequirePermission(models.PermResultExport), handlers.ExportGradebook(db))
+			teacher.PUT("/classes/:id/gradebook/settings", middlewares.RequirePermission(models.PermResultGrade), handlers.UpdateGradebookSettings(db))
+			teacher.PUT("/classes/:id/gradebook/excusals", middlewares.RequirePermission(models.PermResultGrade), handlers.SetGradebookExcusal(db))
+			teacher.GET("/classes/:id/gradebook/categories", middlewares.RequirePermission(models.PermResultView), handlers.GetGradebookCategories(db))
+			teacher.POST("/classes/:id/gradebook/categories", middlewares.RequirePermission(models.PermResultGrade), handlers.CreateGradebookCategory(db))
+			teacher.PUT("/classes/:id/gradebook/categories/:categoryId", middlewares.RequirePermission(models.PermResultGrade), handlers.UpdateGradebookCategory(db))
+			teacher.DELETE("/classes/:id/gradebook/categories/:categoryId", middlewares.RequirePermission(models.PermResultGrade), handlers.DeleteGradebookCategory(db))
+			teacher.GET("/classes/statistics", middlewares.RequirePermission(models.PermClassView), handlers.GetClassStatistics(db))
+			teacher.GET("/classes/:id/shares", middlewares.RequirePermission(models.PermClassManage), handlers.GetShares(db, models.ShareResourceClass))
+			teacher.POST("/classes/:id/shares", middlewares.RequirePermission(models.PermClassManage), handlers.CreateShare(db, models.ShareResourceClass))
+			teacher.DELETE("/classes/:id/shares/:teacherId", middlewares.RequirePermission(models.PermClassManage), handlers.DeleteShare(db, models.ShareResourceClass))
 
 			// 学生管理
-			teacher.GET("/students", handlers.GetStudents(db))
-			teacher.POST("/students", handlers.CreateStudent(db))
-			teacher.PUT("/students/:id", handlers.UpdateStudent(db))
-			teacher.DELETE("/students/:id", handlers.DeleteStudent(db))
-			teacher.POST("/students/import", handlers.ImportStudents(db))
-			teacher.GET("/students/export", handlers.ExportStudents(db))
+			teacher.GET("/students", middlewares.RequirePermission(models.PermStudentView), handlers.GetStudents(db))
+			teacher.POST("/students", middlewares.RequirePermission(models.PermStudentManage), handlers.CreateStudent(db))
+			teacher.PUT("/students/:id", middlewares.RequirePermission(models.PermStudentManage), handlers.UpdateStudent(db))
+			teacher.DELETE("/students/:id", middlewares.RequirePermission(models.PermStudentManage), handlers.DeleteStudent(db))
+			teacher.POST("/students/import", middlewares.RequirePermission(models.PermStudentImport), handlers.ImportStudents(db))
+			teacher.GET("/students/export", middlewares.RequirePermission(models.PermStudentExport), handlers.ExportStudents(db))
+			teacher.GET("/students/:id/analytics", middlewares.RequirePermission(models.PermResultView), handlers.GetStudentAnalytics(db))
+			teacher.GET("/students/:id/mastery", middlewares.RequirePermission(models.PermResultView), handlers.GetStudentMastery(db))
+			teacher.POST("/students/:id/impersonate", middlewares.RequirePermission(models.PermImpersonate), handlers.ImpersonateStudent(db))
 
 			// 结果分析
-			teacher.GET("/results-analysis", handlers.GetResultsAnalysis(db))
-			teacher.GET("/results-analysis/details", handlers.GetExamResultsAnalysis(db))
-			teacher.GET("/results-analysis/score-distribution/:id", handlers.GetScoreDistribution(db))
-			teacher.GET("/results-analysis/class-comparison/:id", handlers.GetClassComparison(db))
-			teacher.GET("/results-analysis/exam-detail/:id", handlers.GetExamDetail(db))
-			teacher.GET("/results-analysis/export", handlers.ExportExamReport(db))
+			teacher.GET("/results-analysis", middlewares.RequirePermission(models.PermResultView), handlers.GetResultsAnalysis(db))
+			teacher.GET("/results-analysis/details", middlewares.RequirePermission(models.PermResultView), handlers.GetExamResultsAnalysis(db))
+			teacher.GET("/results-analysis/score-distribution/:id", middlewares.RequirePermission(models.PermResultView), handlers.GetScoreDistribution(db))
+			teacher.GET("/results-analysis/class-comparison/:id", middlewares.RequirePermission(models.PermResultView), handlers.GetClassComparison(db))
+			teacher.GET("/results-analysis/exam-detail/:id", middlewares.RequirePermission(models.PermResultView), handlers.GetExamDetail(db))
+			teacher.GET("/results-analysis/item-analysis", middlewares.RequirePermission(models.PermResultView), handlers.GetItemAnalysis(db))
+			teacher.GET("/results-analysis/statistics", middlewares.RequirePermission(models.PermResultView), handlers.GetExamStatistics(db))
+			teacher.GET("/results-analysis/export", middlewares.RequirePermission(models.PermResultExport), handlers.ExportExamReport(db))
+			teacher.PUT("/results/:id/score", middlewares.RequirePermission(models.PermResultGrade), handlers.OverrideScore(db))
+			teacher.PUT("/results/:id/answers/:questionId", middlewares.RequirePermission(models.PermResultGrade), handlers.GradeAnswer(db))
+			teacher.PUT("/results/:id/answers/:questionId/feedback", middlewares.RequirePermission(models.PermResultGrade), handlers.SetAnswerFeedback(db))
+			teacher.GET("/appeals", middlewares.RequirePermission(models.PermResultView), handlers.GetAppeals(db))
+			teacher.POST("/appeals/:id/accept", middlewares.RequirePermission(models.PermResultGrade), handlers.AcceptAppeal(db))
+			teacher.POST("/appeals/:id/reject", middlewares.RequirePermission(models.PermResultGrade), handlers.RejectAppeal(db))
 
 			// 登录日志
-			teacher.GET("/login-logs", handlers.GetLoginLogs(db))
+			teacher.GET("/login-logs", middlewares.RequirePermission(models.PermLoginLogView), handlers.GetLoginLogs(db))
+
+			// 两步验证
+			teacher.GET("/2fa", middlewares.RequireUserSession(), handlers.GetTwoFactorStatus(db))
+			teacher.POST("/2fa/setup", middlewares.RequireUserSession(), handlers.SetupTwoFactor(db))
+			teacher.POST("/2fa/confirm", middlewares.RequireUserSession(), handlers.ConfirmTwoFactor(db))
+			teacher.POST("/2fa/disable", middlewares.RequireUserSession(), handlers.DisableTwoFactor(db))
+			teacher.POST("/2fa/recovery-codes", middlewares.RequireUserSession(), handlers.RegenerateRecoveryCodes(db))
 
 			// 消息管理
-			teacher.GET("/messages", handlers.GetMessages(db))
-			teacher.POST("/messages", handlers.CreateMessage(db))
-			teacher.GET("/messages/:id", handlers.GetMessage(db))
-			teacher.PUT("/messages/:id/cancel", handlers.CancelMessage(db))
-			teacher.DELETE("/messages/:id", handlers.DeleteMessage(db))
+			teacher.GET("/messages", middlewares.RequirePermission(models.PermMessageSend), handlers.GetMessages(db))
+			teacher.POST("/messages", middlewares.RequirePermission(models.PermMessageSend), handlers.CreateMessage(db))
+			teacher.GET("/messages/:id", middlewares.RequirePermission(models.PermMessageSend), handlers.GetMessage(db))
+			teacher.PUT("/messages/:id/cancel", middlewares.RequirePermission(models.PermMessageSend), handlers.CancelMessage(db))
+			teacher.DELETE("/messages/:id", middlewares.RequirePermission(models.PermMessageSend), handlers.DeleteMessage(db))
 		}
 
 		// 管理员路由
 		admin := api.Group("/teacher/admin")
-		admin.Use(middlewares.AuthMiddleware())
+		admin.Use(middlewares.AuthMiddleware(db))
 		admin.Use(middlewares.TeacherAuthMiddleware())
-		admin.Use(middlewares.AdminMiddleware())
 		{
 			// 教师账号管理
-			admin.GET("/accounts", handlers.GetTeachers(db))
-			admin.POST("/accounts", handlers.CreateTeacher(db))
-			admin.PUT("/accounts/:id", handlers.UpdateTeacher(db))
-			admin.DELETE("/accounts/:id", handlers.DeleteTeacher(db))
+			admin.GET("/accounts", middlewares.RequirePermission(models.PermUserManage), handlers.GetTeachers(db))
+			admin.POST("/accounts", middlewares.RequirePermission(models.PermUserManage), handlers.CreateTeacher(db))
+			admin.PUT("/accounts/:id", middlewares.RequirePermission(models.PermUserManage), handlers.UpdateTeacher(db))
+			admin.DELETE("/accounts/:id", middlewares.RequirePermission(models.PermUserManage), handlers.DeleteTeacher(db))
+
+			// 解除账号锁定（学生和教师）
+			admin.POST("/users/:id/unlock", middlewares.RequirePermission(models.PermUserManage), handlers.UnlockAccount(db))
+			admin.POST("/accounts/:id/2fa/reset", middlewares.RequirePermission(models.PermUserManage), handlers.ResetTwoFactor(db))
+
+			// 目录同步（LDAP）
+			admin.POST("/ldap/sync", middlewares.RequirePermission(models.PermUserManage), handlers.SyncLDAP(db))
+
+			// LTI平台管理
+			admin.GET("/lti/config", middlewares.RequirePermission(models.PermIntegration), handlers.GetLTIToolConfig())
+			admin.GET("/lti/platforms", middlewares.RequirePermission(models.PermIntegration), handlers.GetLTIPlatforms(db))
+			admin.POST("/lti/platforms", middlewares.RequirePermission(models.PermIntegration), handlers.CreateLTIPlatform(db))
+			admin.PUT("/lti/platforms/:id", middlewares.RequirePermission(models.PermIntegration), handlers.UpdateLTIPlatform(db))
+			admin.DELETE("/lti/platforms/:id", middlewares.RequirePermission(models.PermIntegration), handlers.DeleteLTIPlatform(db))
+
+			// API密钥管理
+			admin.GET("/api-keys", middlewares.RequirePermission(models.PermIntegration), handlers.GetAPIKeys(db))
+			admin.POST("/api-keys", middlewares.RequirePermission(models.PermIntegration), handlers.CreateAPIKey(db))
+			admin.DELETE("/api-keys/:id", middlewares.RequirePermission(models.PermIntegration), handlers.RevokeAPIKey(db))
+
+			// 安全设置
+			admin.GET("/security-settings", middlewares.RequirePermission(models.PermSecurityManage), handlers.GetSecuritySettings(db))
+			admin.PUT("/security-settings", middlewares.RequirePermission(models.PermSecurityManage), handlers.UpdateSecuritySettings(db))
+
+			// 角色和权限管理
+			admin.GET("/permissions", middlewares.RequirePermission(models.PermRoleManage), handlers.GetPermissions())
+			admin.GET("/roles", middlewares.RequirePermission(models.PermRoleManage), handlers.GetRoles(db))
+			admin.POST("/roles", middlewares.RequirePermission(models.PermRoleManage), handlers.CreateRole(db))
+			admin.PUT("/roles/:id", middlewares.RequirePermission(models.PermRoleManage), handlers.UpdateRole(db))
+			admin.DELETE("/roles/:id", middlewares.RequirePermission(models.PermRoleManage), handlers.DeleteRole(db))
+			admin.PUT("/accounts/:id/roles", middlewares.RequirePermission(models.PermRoleManage), handlers.SetUserRoles(db))
+
+			// 审计日志
+			admin.GET("/audit-logs", middlewares.RequirePermission(models.PermAuditView), handlers.GetAuditLogs(db))
+			admin.GET("/audit-logs/export", middlewares.RequirePermission(models.PermAuditView), handlers.ExportAuditLogs(db))
 		}
 	}
 }
@@ -0,0 +1,72 @@
+package middlewares
+
+import (
+	"net/http"
+	"server/models"
+	"server/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// apiKeyUsageInterval 最后使用时间的更新间隔，避免每个请求都写数据库
+const apiKeyUsageInterval = time.Minute
+
+// authenticateAPIKey 验证API密钥，以创建人的身份访问，权限为创建人当前权限与授权范围的交集
+func authenticateAPIKey(db *gorm.DB, c *gin.Context, rawKey string) {
+	var key models.APIKey
+	if err := db.Where("key_hash = ?", utils.HashToken(rawKey)).First(&key).Error; err != nil || key.RevokedAt != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		return
+	}
+
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key has expired"})
+		return
+	}
+
+	// 创建人停用或删除后密钥失效
+	var creator models.User
+	if err := db.Select("id", "username", "role", "is_admin", "status").First(&creator, key.CreatedBy).Error; err != nil ||
+		creator.Status != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Account is disabled"})
+		return
+	}
+
+	creatorPermissions, err := models.UserPermissions(db, creator.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+		return
+	}
+	// 数据范围（scope.all）沿用创建人的设置
+	allowed := models.APIKeyScopePermissions(key.Scopes)
+	permissions := models.Permissions{}
+	for _, permission := range creatorPermissions {
+		if allowed.Has(permission) || permission == models.PermScopeAll {
+			permissions = append(permissions, permission)
+		}
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyUsageInterval {
+		db.Model(&key).UpdateColumns(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": c.ClientIP(),
+		})
+	}
+
+	c.Set("user", gin.H{
+		"id":             creator.ID,
+		"username":       creator.Username,
+		"role":           creator.Role,
+		"isAdmin":        creator.IsAdmin,
+		"sessionId":      uint(0),
+		"permissions":    permissions,
+		"impersonatorId": uint(0),
+		"readOnly":       false,
+		"apiKeyId":       key.ID,
+	})
+
+	c.Next()
+}
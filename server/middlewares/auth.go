@@ -1,15 +1,46 @@
 package middlewares
 
 import (
+	"errors"
 	"net/http"
+	"server/models"
 	"server/utils"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// 会话检查失败的原因，错误信息直接返回给客户端
+var (
+	ErrSessionRevoked  = errors.New("Session has been revoked")
+	ErrAccountDisabled = errors.New("Account is disabled")
+)
+
+// CheckSession 检查令牌的会话未被吊销（退出登录、停用或删除账号）且账号仍然有效，
+// 不经过认证中间件的连接（如 WebSocket）也需要调用
+func CheckSession(db *gorm.DB, claims *utils.Claims) error {
+	_, err := sessionAccount(db, claims)
+	return err
+}
+
+// sessionAccount 检查会话并返回账号的状态
+func sessionAccount(db *gorm.DB, claims *utils.Claims) (models.User, error) {
+	var account models.User
+	var session models.UserSession
+	if err := db.First(&session, claims.SessionID).Error; err != nil || session.RevokedAt != nil ||
+		session.UserID != claims.UserID || session.ImpersonatorID != claims.ImpersonatorID {
+		return account, ErrSessionRevoked
+	}
+
+	if err := db.Select("id", "status", "must_change_password").First(&account, claims.UserID).Error; err != nil || account.Status != 1 {
+		return account, ErrAccountDisabled
+	}
+	return account, nil
+}
+
 // AuthMiddleware 通用认证中间件
-func AuthMiddleware() gin.HandlerFunc {
+func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 从请求头中获取JWT token
 		authHeader := c.GetHeader("Authorization")
@@ -25,6 +56,12 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 外部系统使用API密钥代替用户令牌
+		if strings.HasPrefix(parts[1], models.APIKeyPrefix) {
+			authenticateAPIKey(db, c, parts[1])
+			return
+		}
+
 		// 解析token并验证
 		claims, err := utils.ParseToken(parts[1])
 		if err != nil {
@@ -32,18 +69,83 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		account, err := sessionAccount(db, claims)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 需要修改密码的账号（如初始管理员）修改密码前只能修改密码或退出登录
+		if account.MustChangePassword && claims.ImpersonatorID == 0 && !isPasswordChangeRequest(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Password change required", "mustChangePassword": true})
+			return
+		}
+
+		// 模拟登录令牌只读，除退出登录外禁止所有修改操作（如提交考试）
+		if claims.ReadOnly && !isReadOnlyRequest(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Read-only impersonation session"})
+			return
+		}
+
+		// 加载用户角色对应的权限，角色变更即时生效
+		permissions, err := models.UserPermissions(db, claims.UserID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+			return
+		}
+
 		// 设置用户信息到上下文中
 		c.Set("user", gin.H{
-			"id":       claims.UserID,
-			"username": claims.Username,
-			"role":     claims.Role,
-			"isAdmin":  claims.IsAdmin,
+			"id":             claims.UserID,
+			"username":       claims.Username,
+			"role":           claims.Role,
+			"isAdmin":        claims.IsAdmin,
+			"sessionId":      claims.SessionID,
+			"permissions":    permissions,
+			"impersonatorId": claims.ImpersonatorID,
+			"readOnly":       claims.ReadOnly,
 		})
 
 		c.Next()
 	}
 }
 
+// RequireUserSession 要求通过用户登录访问，拒绝API密钥（如两步验证、外部账号关联等账号安全操作）
+func RequireUserSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		if apiKeyID, _ := user.(gin.H)["apiKeyId"].(uint); apiKeyID != 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API keys cannot access this endpoint"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// isReadOnlyRequest 判断请求是否允许只读令牌访问
+func isReadOnlyRequest(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return c.FullPath() == "/api/auth/logout"
+}
+
+// isPasswordChangeRequest 判断是否为需要修改密码的账号仍可访问的请求
+func isPasswordChangeRequest(c *gin.Context) bool {
+	switch c.FullPath() {
+	case "/api/auth/password", "/api/auth/logout":
+		return true
+	}
+	return false
+}
+
 // StudentAuthMiddleware 学生认证中间件
 func StudentAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -92,7 +194,8 @@ func TeacherAuthMiddleware() gin.HandlerFunc {
 	}
 }
 
-func AdminMiddleware() gin.HandlerFunc {
+// RequirePermission 权限检查中间件，要求当前用户拥有全部指定权限
+func RequirePermission(permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, exists := c.Get("user")
 		if !exists {
@@ -100,14 +203,15 @@ func AdminMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		userMap := user.(gin.H)
-		role := userMap["role"].(byte) // JWT claims中的数字类型
-		isAdmin := userMap["isAdmin"].(byte)
-
-		// 检查是否为管理员用户（角色为2且is_admin为true）
-		if role != 2 || isAdmin != 1 {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden: Admin access required"})
-			return
+		granted, _ := user.(gin.H)["permissions"].(models.Permissions)
+		for _, permission := range permissions {
+			if !granted.Has(permission) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error":      "Forbidden: Permission required",
+					"permission": permission,
+				})
+				return
+			}
 		}
 
 		c.Next()
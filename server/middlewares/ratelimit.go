@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitWindow 单个IP在当前时间窗口内的请求计数
+type rateLimitWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+// RateLimitMiddleware 按客户端IP限制请求频率（固定时间窗口）
+func RateLimitMiddleware(limit int, window time.Duration) gin.HandlerFunc {
+	var mu sync.Mutex
+	windows := make(map[string]*rateLimitWindow)
+
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		now := time.Now()
+
+		mu.Lock()
+		// 记录过多时清理已过期的窗口
+		if len(windows) > 10000 {
+			for key, w := range windows {
+				if now.After(w.resetAt) {
+					delete(windows, key)
+				}
+			}
+		}
+
+		w, exists := windows[ip]
+		if !exists || now.After(w.resetAt) {
+			w = &rateLimitWindow{resetAt: now.Add(window)}
+			windows[ip] = w
+		}
+		w.count++
+		count, resetAt := w.count, w.resetAt
+		mu.Unlock()
+
+		if count > limit {
+			retryAfter := int(time.Until(resetAt).Seconds()) + 1
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":      "Too many requests, please try again later",
+				"retryAfter": retryAfter,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
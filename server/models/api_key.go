@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix API密钥的前缀，用于在认证时区分API密钥和用户令牌
+const APIKeyPrefix = "exk_"
+
+// API密钥的授权范围
+const (
+	APIKeyScopeResultsRead    = "results:read"    // 查询、导出成绩
+	APIKeyScopeExamsRead      = "exams:read"      // 查询试卷内容（包括标准答案）
+	APIKeyScopeStudentsImport = "students:import" // 批量导入学生
+	APIKeyScopeMessagesCreate = "messages:create" // 发送消息
+)
+
+// APIKeyScopes 所有授权范围、说明及对应的权限
+var APIKeyScopes = []struct {
+	Key         string      `json:"key"`
+	Description string      `json:"description"`
+	Permissions Permissions `json:"permissions"`
+}{
+	// 成绩范围不包括试卷内容，试卷详情中有标准答案，需要单独授权 exams:read
+	{APIKeyScopeResultsRead, "查询、导出成绩", Permissions{PermClassView, PermResultView, PermResultExport}},
+	{APIKeyScopeExamsRead, "查询试卷内容（包括标准答案）", Permissions{PermExamView}},
+	{APIKeyScopeStudentsImport, "批量导入学生", Permissions{PermClassView, PermStudentView, PermStudentImport}},
+	{APIKeyScopeMessagesCreate, "发送消息", Permissions{PermMessageSend}},
+}
+
+// IsValidAPIKeyScope 判断授权范围是否存在
+func IsValidAPIKeyScope(scope string) bool {
+	for _, s := range APIKeyScopes {
+		if s.Key == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyScopePermissions 授权范围对应的权限
+func APIKeyScopePermissions(scopes Permissions) Permissions {
+	permissions := Permissions{}
+	for _, s := range APIKeyScopes {
+		if scopes.Has(s.Key) {
+			permissions = permissions.Merge(s.Permissions)
+		}
+	}
+	return permissions
+}
+
+// APIKey 外部系统调用接口使用的密钥，以创建人的身份访问，权限限制在授权范围内
+type APIKey struct {
+	gorm.Model
+	Name       string      `gorm:"not null" json:"name"`
+	Prefix     string      `gorm:"type:varchar(16)" json:"prefix"` // 密钥开头几位，便于识别
+	KeyHash    string      `gorm:"uniqueIndex" json:"-"`           // 只保存密钥的哈希
+	Scopes     Permissions `gorm:"type:text" json:"scopes"`
+	CreatedBy  uint        `gorm:"not null;index" json:"createdBy"`
+	ExpiresAt  *time.Time  `json:"expiresAt"` // 为空时不过期
+	LastUsedAt *time.Time  `json:"lastUsedAt"`
+	LastUsedIP string      `json:"lastUsedIp"`
+	RevokedAt  *time.Time  `json:"revokedAt"`
+}
+
+// TableName 指定表名为 api_keys
+func (APIKey) TableName() string {
+	return "api_keys"
+}
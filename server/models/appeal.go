@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// 成绩申诉状态
+const (
+	AppealPending  = "pending"  // 待处理
+	AppealAccepted = "accepted" // 已接受（已调整得分）
+	AppealRejected = "rejected" // 已驳回
+)
+
+// Appeal 学生对已公布成绩中某道题的申诉，同一道题同时只能有一个待处理的申诉（部分唯一索引）
+type Appeal struct {
+	ID               uint          `gorm:"primaryKey" json:"id"`
+	ExamResultID     uint          `gorm:"not null;index;uniqueIndex:idx_appeals_pending,where:status = 'pending'" json:"examResultId"`
+	ExamAssignmentID uint          `gorm:"not null;index" json:"examAssignmentId"`
+	QuestionID       uint          `gorm:"not null;uniqueIndex:idx_appeals_pending" json:"questionId"`
+	StudentID        uint          `gorm:"not null;index" json:"studentId"`
+	Message          string        `gorm:"type:text;not null" json:"message"`
+	Status           string        `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	Reply            string        `gorm:"type:text" json:"reply"` // 教师回复
+	OldPoints        int           `json:"oldPoints"`              // 申诉时的得分
+	NewPoints        *int          `json:"newPoints"`              // 接受申诉后的得分
+	ResolvedBy       uint          `json:"resolvedBy"`
+	ResolvedAt       *time.Time    `json:"resolvedAt"`
+	CreatedAt        time.Time     `json:"createdAt"`
+	UpdatedAt        time.Time     `json:"updatedAt"`
+	Events           []AppealEvent `gorm:"foreignKey:AppealID" json:"events,omitempty"`
+}
+
+// AppealEvent 申诉的状态变化记录，学生和教师都可以查看
+type AppealEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	AppealID  uint      `gorm:"not null;index" json:"appealId"`
+	Status    string    `gorm:"type:varchar(20);not null" json:"status"`
+	Message   string    `gorm:"type:text" json:"message"`
+	CreatedBy uint      `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
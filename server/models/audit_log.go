@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+)
+
+// 审计操作
+const (
+	AuditExamCreate = "exam.create"
+	AuditExamUpdate = "exam.update"
+	AuditExamDelete = "exam.delete"
+	AuditExamStatus = "exam.status"
+
+	AuditAssignmentCreate = "assignment.create"
+	AuditAssignmentUpdate = "assignment.update"
+	AuditAssignmentDelete = "assignment.delete"
+	AuditResultRelease    = "assignment.release"
+	AuditResultWithhold   = "assignment.withhold"
+
+	AuditClassCreate = "class.create"
+	AuditClassUpdate = "class.update"
+	AuditClassDelete = "class.delete"
+
+	AuditGradebookUpdate = "gradebook.update"
+	AuditGradebookExcuse = "gradebook.excuse"
+
+	AuditShareCreate = "share.create"
+	AuditShareDelete = "share.delete"
+
+	AuditStudentCreate        = "student.create"
+	AuditStudentUpdate        = "student.update"
+	AuditStudentDelete        = "student.delete"
+	AuditStudentImport        = "student.import"
+	AuditStudentPasswordReset = "student.password_reset"
+
+	AuditTeacherCreate        = "teacher.create"
+	AuditTeacherUpdate        = "teacher.update"
+	AuditTeacherDelete        = "teacher.delete"
+	AuditTeacherPasswordReset = "teacher.password_reset"
+	AuditAccountUnlock        = "account.unlock"
+	AuditTwoFactorReset       = "account.2fa_reset"
+	AuditUserRoles            = "account.roles"
+	AuditImpersonateStart     = "account.impersonate_start"
+	AuditImpersonateEnd       = "account.impersonate_end"
+	AuditIdentityLink         = "account.identity_link"
+	AuditIdentityUnlink       = "account.identity_unlink"
+	AuditPasswordChange       = "account.password_change"
+
+	AuditRoleCreate = "role.create"
+	AuditRoleUpdate = "role.update"
+	AuditRoleDelete = "role.delete"
+
+	AuditSettingsUpdate = "settings.update"
+	AuditLDAPSync       = "ldap.sync"
+
+	AuditLTIPlatformCreate = "lti_platform.create"
+	AuditLTIPlatformUpdate = "lti_platform.update"
+	AuditLTIPlatformDelete = "lti_platform.delete"
+	AuditAPIKeyCreate      = "api_key.create"
+	AuditAPIKeyRevoke      = "api_key.revoke"
+
+	AuditScoreOverride     = "result.score_override"
+	AuditAnswerGrade       = "result.answer_grade"
+	AuditAnswerFeedback    = "result.answer_feedback"
+	AuditAppealAccept      = "result.appeal_accept"
+	AuditAppealReject      = "result.appeal_reject"
+	AuditScoreAdjust       = "result.adjust"
+	AuditScoreAdjustRevert = "result.adjust_revert"
+	AuditExamRegrade       = "exam.regrade"
+
+	AuditMessageSend   = "message.send"
+	AuditMessageCancel = "message.cancel"
+	AuditMessageDelete = "message.delete"
+)
+
+// AuditLog 审计日志，记录管理和阅卷操作及修改前后的值
+type AuditLog struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       uint      `gorm:"index" json:"userId"` // 操作人
+	Username     string    `json:"username"`
+	APIKeyID     uint      `gorm:"default:0" json:"apiKeyId,omitempty"` // 通过API密钥操作时的密钥ID
+	Action       string    `gorm:"type:varchar(50);index" json:"action"`
+	ResourceType string    `gorm:"type:varchar(50);index:idx_audit_resource" json:"resourceType"`
+	ResourceID   uint      `gorm:"index:idx_audit_resource" json:"resourceId"`
+	Before       string    `gorm:"type:text" json:"before"` // 修改前的值（JSON）
+	After        string    `gorm:"type:text" json:"after"`  // 修改后的值（JSON）
+	IP           string    `json:"ip"`
+	CreatedAt    time.Time `gorm:"index" json:"createdAt"`
+}
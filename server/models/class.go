@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -14,6 +16,13 @@ type Class struct {
 	EnrollmentYear int    // 入学年份
 }
 
+// 成绩公布方式
+const (
+	ReleaseImmediate  = "immediate"   // 提交后立即公布
+	ReleaseAfterClose = "after_close" // 考试结束后公布
+	ReleaseManual     = "manual"      // 教师手动发布后公布
+)
+
 // ExamAssignment 试卷分配模型
 type ExamAssignment struct {
 	gorm.Model
@@ -25,6 +34,15 @@ type ExamAssignment struct {
 	PassScore   int    `json:"passScore" gorm:"not null"`
 	Description string `json:"description"`
 
+	// 学生可以看到的成绩和答卷内容
+	ReleasePolicy   string     `json:"releasePolicy" gorm:"default:immediate"` // 成绩公布方式
+	ReleasedAt      *time.Time `json:"releasedAt"`                             // 教师发布成绩的时间
+	ShowCorrectness bool       `json:"showCorrectness"`                        // 是否显示每题对错和得分
+	ShowAnswers     bool       `json:"showAnswers"`                            // 是否显示正确答案
+	ShowFeedback    bool       `json:"showFeedback"`                           // 是否显示教师评语
+
+	CategoryID uint `json:"categoryId" gorm:"not null;default:0;index"` // 成绩册中的成绩类别，0表示未分类
+
 	Exam  Exam  `gorm:"foreignKey:ExamID"`
 	Class Class `gorm:"foreignKey:ClassID"`
 }
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// GradebookCategory 班级成绩册的成绩类别，如平时测验20%、期中30%、期末50%
+type GradebookCategory struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ClassID    uint      `gorm:"not null;index" json:"classId"`
+	Name       string    `gorm:"type:varchar(100);not null" json:"name"`
+	Weight     float64   `gorm:"not null;default:0" json:"weight"`     // 占总评的百分比
+	DropLowest int       `gorm:"not null;default:0" json:"dropLowest"` // 计算时去掉最低的N次成绩
+	Position   int       `gorm:"not null;default:0" json:"position"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// GradebookSetting 班级成绩册设置
+type GradebookSetting struct {
+	ClassID      uint      `gorm:"primaryKey;autoIncrement:false" json:"classId"`
+	GradeScaleID uint      `gorm:"not null;default:0" json:"gradeScaleId"` // 总评等级使用的等级制，0表示不评等级
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// GradebookExcusal 学生某次考试的免考记录，免考的考试不计入总评
+type GradebookExcusal struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	ExamAssignmentID uint      `gorm:"not null;uniqueIndex:idx_excusal_student" json:"examAssignmentId"`
+	StudentID        uint      `gorm:"not null;uniqueIndex:idx_excusal_student" json:"studentId"`
+	Reason           string    `gorm:"type:text" json:"reason"`
+	CreatedBy        uint      `json:"createdBy"`
+	CreatedAt        time.Time `json:"createdAt"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// 外部身份提供方
+const (
+	IdentityProviderOIDC = "oidc"
+	IdentityProviderLDAP = "ldap"
+	IdentityProviderLTI  = "lti"
+)
+
+// UserIdentity 用户关联的外部账号（如学校统一身份认证），同一外部账号只能关联一个用户
+type UserIdentity struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"not null;index" json:"userId"`
+	Provider    string     `gorm:"type:varchar(20);not null" json:"provider"`
+	Issuer      string     `gorm:"not null;uniqueIndex:idx_identity_subject" json:"issuer"`
+	Subject     string     `gorm:"not null;uniqueIndex:idx_identity_subject" json:"subject"`
+	Username    string     `json:"username"` // 外部账号的用户名，仅用于展示
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+	// DeactivatedAt 目录同步因账号不在目录中而停用的时间，账号重新出现在目录中时恢复
+	DeactivatedAt *time.Time `json:"-"`
+}
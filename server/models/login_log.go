@@ -4,10 +4,22 @@ import (
 	"time"
 )
 
+// 登录失败原因
+const (
+	LoginReasonUserNotFound     = "user_not_found"
+	LoginReasonInvalidPassword  = "invalid_password"
+	LoginReasonAccountLocked    = "account_locked"
+	LoginReasonAccountDisabled  = "account_disabled"
+	LoginReasonInvalidTwoFactor = "invalid_2fa_code"
+)
+
 // LoginLog 登录日志模型
 type LoginLog struct {
 	ID        int       `json:"id" db:"id"`
+	UserID    uint      `json:"user_id" db:"user_id"`
 	Username  string    `json:"username" db:"username"`
+	Success   bool      `json:"success" db:"success"`
+	Reason    string    `json:"reason" db:"reason"` // 失败原因，成功时为空
 	IP        string    `json:"ip" db:"ip"`
 	UserAgent string    `json:"user_agent" db:"user_agent"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
@@ -16,6 +28,9 @@ type LoginLog struct {
 // LoginLogQuery 查询参数
 type LoginLogQuery struct {
 	Username  string    `json:"username"`
+	Success   *bool     `json:"success"`
+	Reason    string    `json:"reason"`
+	IP        string    `json:"ip"`
 	StartTime time.Time `json:"start_time"`
 	EndTime   time.Time `json:"end_time"`
 	Page      int       `json:"page"`
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LTIPlatform 已注册的LTI 1.3平台（学校的LMS）
+type LTIPlatform struct {
+	gorm.Model
+	Name         string `gorm:"not null" json:"name"`
+	Issuer       string `gorm:"not null;uniqueIndex:idx_lti_platform_client" json:"issuer"`
+	ClientID     string `gorm:"not null;uniqueIndex:idx_lti_platform_client" json:"clientId"`
+	DeploymentID string `json:"deploymentId"`                 // 为空时接受任意部署
+	AuthLoginURL string `gorm:"not null" json:"authLoginUrl"` // 平台的OIDC授权地址
+	AuthTokenURL string `gorm:"not null" json:"authTokenUrl"` // 平台的OAuth2令牌地址（用于回传成绩）
+	KeySetURL    string `gorm:"not null" json:"keySetUrl"`    // 平台的JWKS公钥地址
+}
+
+// LTIResourceLink LMS课程中的资源链接与考试安排的对应关系
+type LTIResourceLink struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	PlatformID       uint      `gorm:"not null;uniqueIndex:idx_lti_resource_link" json:"platformId"`
+	ResourceLinkID   string    `gorm:"not null;uniqueIndex:idx_lti_resource_link" json:"resourceLinkId"`
+	ExamAssignmentID uint      `gorm:"not null;index" json:"examAssignmentId"`
+	LineItemURL      string    `json:"lineItemUrl"` // 成绩回传的成绩项地址（Assignment and Grade Services）
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// LTIDeepLinkItem Deep Linking 响应中签发给平台的考试安排，资源链接首次启动时只能按平台和 Token 绑定到这里的考试安排
+type LTIDeepLinkItem struct {
+	ID               uint   `gorm:"primaryKey"`
+	PlatformID       uint   `gorm:"not null;index"`
+	ExamAssignmentID uint   `gorm:"not null"`
+	Token            string `gorm:"type:varchar(64);not null;uniqueIndex"` // 写入内容项自定义参数 link_token
+	CreatedBy        uint   `gorm:"not null"`
+	CreatedAt        time.Time
+}
+
+// LTIDeepLinkRequest 教师在LMS中选择考试（Deep Linking）时保存的请求，选择完成后删除
+type LTIDeepLinkRequest struct {
+	ID           uint `gorm:"primaryKey"`
+	PlatformID   uint `gorm:"not null"`
+	UserID       uint `gorm:"not null;index"`
+	DeploymentID string
+	ReturnURL    string `gorm:"not null"`
+	Data         string `gorm:"type:text"`
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
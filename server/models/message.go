@@ -11,6 +11,7 @@ type Message struct {
 	TargetExam    uint       `json:"targetExam"`                                   // 目标考试ID
 	TargetClass   uint       `json:"targetClass"`                                  // 目标班级ID
 	TargetStudent uint       `json:"targetStudent"`                                // 目标学生ID（用于直接消息）
+	TargetTeacher uint       `json:"targetTeacher"`                                // 目标教师ID（如成绩申诉通知）
 	Title         string     `json:"title" gorm:"type:varchar(200);not null"`
 	Content       string     `json:"content" gorm:"type:text;not null"`
 	SendMethod    string     `json:"sendMethod" gorm:"type:varchar(20);not null"`      // immediate 或 scheduled
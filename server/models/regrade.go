@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Regrade 修改答案后重新评分的记录
+type Regrade struct {
+	ID            uint            `gorm:"primaryKey" json:"id"`
+	ExamID        uint            `gorm:"not null;index" json:"examId"`
+	Reason        string          `gorm:"type:text" json:"reason"`
+	AffectedCount int             `json:"affectedCount"` // 成绩发生变化的答卷数
+	Notified      bool            `json:"notified"`      // 是否通知了受影响的学生
+	CreatedBy     uint            `json:"createdBy"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	Changes       []RegradeChange `gorm:"foreignKey:RegradeID" json:"changes,omitempty"`
+}
+
+// RegradeChange 重新评分中一份答卷原始成绩的变化
+type RegradeChange struct {
+	ID           uint `gorm:"primaryKey" json:"id"`
+	RegradeID    uint `gorm:"not null;index" json:"regradeId"`
+	ExamResultID uint `gorm:"not null;index" json:"examResultId"`
+	StudentID    uint `json:"studentId"`
+	OldScore     int  `json:"oldScore"`
+	NewScore     int  `json:"newScore"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ResultAnswer 答卷中每道题的作答和得分，所有统计、查看和导出都以此为准
+type ResultAnswer struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	ExamResultID  uint       `gorm:"not null;uniqueIndex:idx_result_question" json:"examResultId"`
+	QuestionID    uint       `gorm:"not null;uniqueIndex:idx_result_question;index" json:"questionId"`
+	Answer        string     `json:"answer"`                                  // 单选题选择的选项
+	BlankAnswers  StringList `gorm:"type:text" json:"blankAnswers"`           // 填空题每个空的答案
+	AwardedPoints int        `gorm:"not null;default:0" json:"awardedPoints"` // 实际得分（已减去倒扣分）
+	PenaltyPoints int        `gorm:"not null;default:0" json:"penaltyPoints"` // 答错倒扣的分数
+	MaxPoints     int        `gorm:"not null;default:0" json:"maxPoints"`
+	Manual        bool       `gorm:"default:false" json:"manual"` // 是否由教师手动评分
+	GradedBy      uint       `gorm:"default:0" json:"gradedBy"`   // 手动评分的教师
+	Feedback      string     `gorm:"type:text" json:"feedback"`   // 教师评语
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+// Answered 是否作答
+func (a ResultAnswer) Answered() bool {
+	if a.Answer != "" {
+		return true
+	}
+	for _, blank := range a.BlankAnswers {
+		if blank != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// StringList 字符串列表，以JSON数组保存
+type StringList []string
+
+func (l *StringList) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case string:
+		if len(v) == 0 {
+			return nil
+		}
+		bytes = []byte(v)
+	case []byte:
+		if len(v) == 0 {
+			return nil
+		}
+		bytes = v
+	default:
+		return errors.New(fmt.Sprint("Failed to unmarshal JSONB value:", value))
+	}
+
+	return json.Unmarshal(bytes, l)
+}
+
+func (l StringList) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return "[]", nil
+	}
+	data, err := json.Marshal(l)
+	return string(data), err
+}
@@ -0,0 +1,238 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 权限
+const (
+	PermExamView   = "exam.view"   // 查看试卷
+	PermExamCreate = "exam.create" // 创建试卷
+	PermExamEdit   = "exam.edit"   // 编辑、发布、共享试卷
+	PermExamDelete = "exam.delete" // 删除试卷
+	PermExamAssign = "exam.assign" // 分配试卷到班级
+
+	PermClassView   = "class.view"   // 查看班级
+	PermClassManage = "class.manage" // 创建、编辑、删除、共享班级
+
+	PermStudentView   = "student.view"   // 查看学生
+	PermStudentManage = "student.manage" // 创建、编辑、删除学生
+	PermStudentImport = "student.import" // 批量导入学生
+	PermStudentExport = "student.export" // 导出学生
+
+	PermResultView   = "result.view"   // 查看成绩分析
+	PermResultGrade  = "result.grade"  // 阅卷、修改成绩
+	PermResultExport = "result.export" // 导出成绩报告
+
+	PermMessageSend  = "message.send"  // 发送、管理消息
+	PermLoginLogView = "loginlog.view" // 查看登录日志
+
+	PermUserManage     = "user.manage"        // 管理教师账号、解锁账号
+	PermRoleManage     = "role.manage"        // 管理角色和权限
+	PermSecurityManage = "security.manage"    // 管理安全设置
+	PermAuditView      = "audit.view"         // 查看、导出审计日志
+	PermImpersonate    = "user.impersonate"   // 以学生身份只读查看（模拟登录）
+	PermIntegration    = "integration.manage" // 管理LTI平台等外部集成
+
+	PermScopeAll = "scope.all" // 访问所有教师的数据（不限于自己的班级和试卷）
+)
+
+// AllPermissions 所有权限及说明
+var AllPermissions = []struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+}{
+	{PermExamView, "查看试卷"},
+	{PermExamCreate, "创建试卷"},
+	{PermExamEdit, "编辑、发布、共享试卷"},
+	{PermExamDelete, "删除试卷"},
+	{PermExamAssign, "分配试卷到班级"},
+	{PermClassView, "查看班级"},
+	{PermClassManage, "创建、编辑、删除、共享班级"},
+	{PermStudentView, "查看学生"},
+	{PermStudentManage, "创建、编辑、删除学生"},
+	{PermStudentImport, "批量导入学生"},
+	{PermStudentExport, "导出学生"},
+	{PermResultView, "查看成绩分析"},
+	{PermResultGrade, "阅卷、修改成绩"},
+	{PermResultExport, "导出成绩报告"},
+	{PermMessageSend, "发送、管理消息"},
+	{PermLoginLogView, "查看登录日志"},
+	{PermUserManage, "管理教师账号、解锁账号"},
+	{PermRoleManage, "管理角色和权限"},
+	{PermSecurityManage, "管理安全设置"},
+	{PermAuditView, "查看、导出审计日志"},
+	{PermImpersonate, "以学生身份只读查看"},
+	{PermIntegration, "管理LTI平台等外部集成"},
+	{PermScopeAll, "访问所有教师的数据"},
+}
+
+// IsValidPermission 判断权限是否存在
+func IsValidPermission(permission string) bool {
+	for _, p := range AllPermissions {
+		if p.Key == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// 内置角色
+const (
+	RoleAdmin            = "admin"
+	RoleTeacher          = "teacher"
+	RoleTeachingAssist   = "teaching_assistant"
+	RoleGrader           = "grader"
+	RoleHeadOfDepartment = "head_of_department"
+	RoleInvigilator      = "invigilator"
+	RoleAuditor          = "auditor"
+)
+
+// teacherPermissions 普通教师的权限
+var teacherPermissions = Permissions{
+	PermExamView, PermExamCreate, PermExamEdit, PermExamDelete, PermExamAssign,
+	PermClassView, PermClassManage,
+	PermStudentView, PermStudentManage, PermStudentImport, PermStudentExport,
+	PermResultView, PermResultGrade, PermResultExport,
+	PermMessageSend, PermLoginLogView, PermImpersonate,
+}
+
+// BuiltinRoles 内置角色，启动时同步到数据库
+var BuiltinRoles = []Role{
+	{Name: RoleAdmin, DisplayName: "管理员", Description: "拥有全部权限", Permissions: allPermissionKeys()},
+	{Name: RoleTeacher, DisplayName: "教师", Description: "管理自己的试卷、班级和学生", Permissions: teacherPermissions},
+	{Name: RoleTeachingAssist, DisplayName: "助教", Description: "查看班级和学生，可以阅卷但不能修改试卷",
+		Permissions: Permissions{PermExamView, PermClassView, PermStudentView, PermResultView, PermResultGrade, PermMessageSend}},
+	{Name: RoleGrader, DisplayName: "阅卷人", Description: "只能查看试卷和阅卷",
+		Permissions: Permissions{PermExamView, PermResultView, PermResultGrade}},
+	{Name: RoleHeadOfDepartment, DisplayName: "教研组长", Description: "拥有教师权限，并可访问所有教师的数据",
+		Permissions: append(Permissions{PermScopeAll}, teacherPermissions...)},
+	{Name: RoleInvigilator, DisplayName: "监考员", Description: "查看考试安排和学生，向考生发送消息",
+		Permissions: Permissions{PermExamView, PermClassView, PermStudentView, PermMessageSend}},
+	{Name: RoleAuditor, DisplayName: "审计员", Description: "只读访问所有数据和登录日志",
+		Permissions: Permissions{PermScopeAll, PermExamView, PermClassView, PermStudentView, PermResultView, PermLoginLogView, PermAuditView}},
+}
+
+func allPermissionKeys() Permissions {
+	keys := make(Permissions, 0, len(AllPermissions))
+	for _, p := range AllPermissions {
+		keys = append(keys, p.Key)
+	}
+	return keys
+}
+
+// Role 角色，由一组权限组成
+type Role struct {
+	gorm.Model
+	Name        string      `gorm:"not null;uniqueIndex" json:"name"`
+	DisplayName string      `json:"displayName"`
+	Description string      `json:"description"`
+	Permissions Permissions `gorm:"type:text" json:"permissions"`
+	BuiltIn     bool        `gorm:"default:false" json:"builtIn"` // 内置角色不能删除
+
+	// DefaultPermissions 上次同步时内置角色的默认权限，用于区分新增的默认权限和管理员的修改
+	DefaultPermissions Permissions `gorm:"type:text" json:"-"`
+}
+
+// UserRole 用户与角色的关联
+type UserRole struct {
+	UserID    uint `gorm:"primaryKey"`
+	RoleID    uint `gorm:"primaryKey;index"`
+	CreatedAt time.Time
+}
+
+// Permissions 权限列表，以JSON数组保存
+type Permissions []string
+
+// Has 判断是否拥有指定权限
+func (p Permissions) Has(permission string) bool {
+	for _, item := range p {
+		if item == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge 合并多个角色的权限（去重并排序）
+func (p Permissions) Merge(others ...Permissions) Permissions {
+	set := map[string]bool{}
+	for _, item := range p {
+		set[item] = true
+	}
+	for _, other := range others {
+		for _, item := range other {
+			set[item] = true
+		}
+	}
+	merged := make(Permissions, 0, len(set))
+	for item := range set {
+		merged = append(merged, item)
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// Without 去掉其他权限列表中的权限
+func (p Permissions) Without(others ...Permissions) Permissions {
+	removed := Permissions{}.Merge(others...)
+	result := Permissions{}
+	for _, item := range p {
+		if !removed.Has(item) {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func (p *Permissions) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		if len(v) == 0 {
+			return nil
+		}
+		bytes = []byte(v)
+	case []byte:
+		if len(v) == 0 {
+			return nil
+		}
+		bytes = v
+	default:
+		return errors.New(fmt.Sprint("Failed to unmarshal JSONB value:", value))
+	}
+
+	return json.Unmarshal(bytes, p)
+}
+
+func (p Permissions) Value() (driver.Value, error) {
+	if len(p) == 0 {
+		return "[]", nil
+	}
+	data, err := json.Marshal(p)
+	return string(data), err
+}
+
+// UserPermissions 查询用户通过角色获得的所有权限
+func UserPermissions(db *gorm.DB, userID uint) (Permissions, error) {
+	var roles []Role
+	if err := db.Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	permissions := Permissions{}
+	for _, role := range roles {
+		permissions = permissions.Merge(role.Permissions)
+	}
+	return permissions, nil
+}
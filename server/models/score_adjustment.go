@@ -0,0 +1,120 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 成绩调整步骤类型
+const (
+	AdjustLinear = "linear" // 线性变换到目标平均分和标准差
+	AdjustSqrt   = "sqrt"   // 开方曲线：sqrt(得分/总分)*总分
+	AdjustBonus  = "bonus"  // 每人加分
+	AdjustCap    = "cap"    // 最高分封顶
+)
+
+// AdjustmentStep 成绩调整的一个步骤，按顺序依次作用
+type AdjustmentStep struct {
+	Type       string  `json:"type"`
+	TargetMean float64 `json:"targetMean,omitempty"` // linear
+	TargetSD   float64 `json:"targetSd,omitempty"`   // linear
+	Amount     float64 `json:"amount,omitempty"`     // bonus
+	Max        float64 `json:"max,omitempty"`        // cap
+	// Scale、Offset 为 linear 应用时按当时成绩算出的系数（x*Scale+Offset），之后补交或改分沿用
+	Scale  float64 `json:"scale,omitempty"`
+	Offset float64 `json:"offset,omitempty"`
+}
+
+// AdjustmentSteps 成绩调整步骤列表
+type AdjustmentSteps []AdjustmentStep
+
+func (s *AdjustmentSteps) Scan(value interface{}) error {
+	bytes, err := jsonBytes(value)
+	if err != nil || bytes == nil {
+		return err
+	}
+	return json.Unmarshal(bytes, s)
+}
+
+func (s AdjustmentSteps) Value() (driver.Value, error) {
+	if len(s) == 0 {
+		return "[]", nil
+	}
+	data, err := json.Marshal(s)
+	return string(data), err
+}
+
+// GradeBand 等级分段：得分率不低于 MinPercent 时为该等级
+type GradeBand struct {
+	Grade      string  `json:"grade"`
+	MinPercent float64 `json:"minPercent"`
+	GradePoint float64 `json:"gradePoint"` // 绩点
+}
+
+// GradeBands 等级分段列表
+type GradeBands []GradeBand
+
+func (b *GradeBands) Scan(value interface{}) error {
+	bytes, err := jsonBytes(value)
+	if err != nil || bytes == nil {
+		return err
+	}
+	return json.Unmarshal(bytes, b)
+}
+
+func (b GradeBands) Value() (driver.Value, error) {
+	if len(b) == 0 {
+		return "[]", nil
+	}
+	data, err := json.Marshal(b)
+	return string(data), err
+}
+
+// GradeScale 等级制（如 A/B/C/D/F 及绩点）
+type GradeScale struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Name      string     `gorm:"type:varchar(100);not null" json:"name"`
+	Bands     GradeBands `gorm:"type:text" json:"bands"`
+	CreatedBy uint       `json:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// ScoreAdjustment 考试安排的成绩调整记录，每个考试安排最多一条生效
+//
+// 调整作用于原始成绩（ExamResult.RawScore），结果写入 ExamResult.Score
+type ScoreAdjustment struct {
+	ID               uint            `gorm:"primaryKey" json:"id"`
+	ExamAssignmentID uint            `gorm:"not null;index" json:"examAssignmentId"`
+	Steps            AdjustmentSteps `gorm:"type:text" json:"steps"`
+	GradeScaleID     *uint           `json:"gradeScaleId"`
+	GradeBands       GradeBands      `gorm:"type:text" json:"gradeBands"` // 应用时的等级分段副本
+	Reason           string          `gorm:"type:text" json:"reason"`
+	Active           bool            `gorm:"default:true;index" json:"active"`
+	CreatedBy        uint            `json:"createdBy"`
+	CreatedAt        time.Time       `json:"createdAt"`
+	RevertedAt       *time.Time      `json:"revertedAt"`
+}
+
+// jsonBytes 读取数据库中的JSON文本，空值返回 nil
+func jsonBytes(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if len(v) == 0 {
+			return nil, nil
+		}
+		return []byte(v), nil
+	case []byte:
+		if len(v) == 0 {
+			return nil, nil
+		}
+		return v, nil
+	default:
+		return nil, errors.New(fmt.Sprint("Failed to unmarshal JSONB value:", value))
+	}
+}
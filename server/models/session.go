@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserSession 登录会话，服务端保存刷新令牌的哈希用于续期和吊销
+type UserSession struct {
+	gorm.Model
+	UserID           uint       `gorm:"not null;index" json:"userId"`
+	RefreshTokenHash string     `gorm:"uniqueIndex" json:"-"`
+	ExpiresAt        time.Time  `gorm:"not null" json:"expiresAt"`
+	RevokedAt        *time.Time `json:"revokedAt"`
+	IP               string     `json:"ip"`
+	UserAgent        string     `json:"userAgent"`
+	ImpersonatorID   uint       `gorm:"default:0;index" json:"impersonatorId"` // 模拟登录会话的发起人，普通会话为0
+}
+
+// TableName 指定表名为 user_sessions
+func (UserSession) TableName() string {
+	return "user_sessions"
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// 系统设置键
+const (
+	SettingRequireTeacher2FA = "require_teacher_2fa" // 是否强制所有教师启用两步验证
+	SettingLTIPrivateKey     = "lti_private_key"     // LTI工具的RSA签名私钥（PEM）
+)
+
+// SystemSetting 系统设置（键值对）
+type SystemSetting struct {
+	Key       string    `gorm:"primaryKey;type:varchar(100)" json:"key"`
+	Value     string    `gorm:"type:text" json:"value"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TableName 指定表名为 system_settings
+func (SystemSetting) TableName() string {
+	return "system_settings"
+}
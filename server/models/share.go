@@ -0,0 +1,24 @@
+package models
+
+import "gorm.io/gorm"
+
+// 共享资源类型
+const (
+	ShareResourceExam  = "exam"
+	ShareResourceClass = "class"
+)
+
+// 共享角色
+const (
+	ShareRoleView = "view" // 只读
+	ShareRoleEdit = "edit" // 可编辑
+)
+
+// ResourceShare 试卷/班级共享给协作教师
+type ResourceShare struct {
+	gorm.Model
+	ResourceType string `gorm:"not null;uniqueIndex:idx_share_resource_teacher" json:"resourceType"` // exam, class
+	ResourceID   uint   `gorm:"not null;uniqueIndex:idx_share_resource_teacher" json:"resourceId"`
+	TeacherID    uint   `gorm:"not null;uniqueIndex:idx_share_resource_teacher;index" json:"teacherId"`
+	Role         string `gorm:"not null" json:"role"` // view, edit
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecoveryCode 两步验证恢复码，只保存哈希，每个恢复码只能使用一次
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint       `gorm:"not null;index"`
+	CodeHash string     `gorm:"not null"`
+	UsedAt   *time.Time // 使用时间，为空表示未使用
+}
@@ -1,13 +1,21 @@
 package models
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql/driver"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
 
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -23,6 +31,16 @@ type User struct {
 	ClassId   int    `gorm:"default:0"` // 班级，仅学生使用
 	Major     string // 专业，仅学生使用
 	Status    byte   `gorm:"default:1"` // 状态，仅教师使用：active, inactive
+
+	RandomPassword     bool `gorm:"not null;default:false"` // 外部账号（LDAP、OIDC、LTI）使用随机密码，管理员重置密码前不能用本地密码登录
+	MustChangePassword bool `gorm:"not null;default:false"` // 首次登录后需要修改密码（如自动生成的初始管理员密码），修改前只能访问修改密码接口
+
+	FailedLoginCount int        `gorm:"default:0"` // 连续登录失败次数
+	LockedUntil      *time.Time // 账号锁定截止时间
+
+	TwoFactorSecret   string // TOTP密钥（Base32），确认绑定前为待确认状态
+	TwoFactorEnabled  bool   `gorm:"default:false"` // 是否已启用两步验证
+	TwoFactorLastStep int64  `gorm:"default:0"`     // 最近一次使用的TOTP时间步，防止重放
 }
 
 // UniqueIndex 为 User 表添加唯一索引，确保用户名+角色的组合唯一
@@ -30,15 +48,126 @@ func (User) UniqueIndex() []string {
 	return []string{"username", "role"}
 }
 
-// HashPassword 使用SHA256加密密码
-func HashPassword(password string) string {
+// PasswordCost bcrypt计算成本，调高后旧哈希会在下次登录时自动升级
+const PasswordCost = 12
+
+// 密码策略
+const (
+	PasswordMinLength = 8
+	PasswordMaxLength = 72 // bcrypt 只处理前72字节
+)
+
+// weakPasswords 禁止使用的常见弱密码（包括旧版默认密码）
+var weakPasswords = map[string]bool{
+	"123456":    true,
+	"12345678":  true,
+	"123456789": true,
+	"password":  true,
+	"password1": true,
+	"admin":     true,
+	"admin123":  true,
+	"qwerty123": true,
+	"abc12345":  true,
+	"11111111":  true,
+}
+
+// HashPassword 使用bcrypt加密密码（自带随机盐）
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// legacyHashPassword 旧版无盐SHA256哈希，仅用于迁移期间校验
+func legacyHashPassword(password string) string {
 	hash := sha256.Sum256([]byte(password))
 	return hex.EncodeToString(hash[:])
 }
 
-// CheckPassword 验证密码
+// isLegacyHash 判断是否为旧版SHA256哈希
+func isLegacyHash(hash string) bool {
+	return !strings.HasPrefix(hash, "$2")
+}
+
+// CheckPassword 验证密码，同时兼容bcrypt和旧版SHA256哈希
 func CheckPassword(password, hash string) bool {
-	return HashPassword(password) == hash
+	if isLegacyHash(hash) {
+		return subtle.ConstantTimeCompare([]byte(legacyHashPassword(password)), []byte(hash)) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// CheckDummyPassword 账号不存在时执行一次同样成本的比对，使响应时间与密码错误时一致，避免探测用户名
+func CheckDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), PasswordCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// PasswordNeedsRehash 判断密码哈希是否需要升级（旧版格式或成本过低）
+func PasswordNeedsRehash(hash string) bool {
+	if isLegacyHash(hash) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < PasswordCost
+}
+
+// ValidatePassword 校验密码是否符合密码策略
+func ValidatePassword(password string) error {
+	if len(password) < PasswordMinLength {
+		return fmt.Errorf("password must be at least %d characters", PasswordMinLength)
+	}
+	if len(password) > PasswordMaxLength {
+		return fmt.Errorf("password must be at most %d bytes", PasswordMaxLength)
+	}
+	if weakPasswords[strings.ToLower(password)] {
+		return errors.New("password is too common")
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return errors.New("password must contain both letters and digits")
+	}
+
+	return nil
+}
+
+// GeneratePassword 生成符合密码策略的随机初始密码
+func GeneratePassword() (string, error) {
+	const letters = "abcdefghjkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+	const digits = "23456789"
+	const charset = letters + digits
+
+	for {
+		buf := make([]byte, 10)
+		for i := range buf {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+			if err != nil {
+				return "", err
+			}
+			buf[i] = charset[n.Int64()]
+		}
+		if password := string(buf); ValidatePassword(password) == nil {
+			return password, nil
+		}
+	}
 }
 
 type Exam struct {
@@ -48,6 +177,8 @@ type Exam struct {
 	Duration    int    // in minutes
 	TotalScore  int    `gorm:"not null"`
 	Status      string // draft, published, archived
+	CreatedBy   uint   `gorm:"not null;default:0;index"` // 创建者（所有者）教师ID
+	FloorAtZero bool   `gorm:"not null;default:false"`   // 有倒扣分时总分最低为0
 	Questions   []Question
 }
 
@@ -60,16 +191,26 @@ type Question struct {
 	Options     Options `gorm:"type:text"` // JSON string for single choice questions
 	Placeholder string  `gorm:"not null"`
 	Answer      string  `gorm:"not null"`
-	Answers     Answers `gorm:"type:text"` // JSON string for fill-in answers
+	Answers     Answers `gorm:"type:text"`          // JSON string for fill-in answers
+	Position    int     `gorm:"not null;default:0"` // 题目在试卷中的顺序
+	// PenaltyPercent 答错倒扣的分数占本题分值的百分比（填空题按答错的空数折算），未作答不扣分
+	PenaltyPercent int `gorm:"not null;default:0"`
+	// Tags 知识点标签，用于按知识点分析学生的强项和弱项
+	Tags StringList `gorm:"type:text"`
 }
 
 type ExamResult struct {
 	gorm.Model
-	ExamAssignmentID uint   `gorm:"not null;default:0"`
-	StudentID        uint   `gorm:"not null;default:0"`
-	Score            int    `gorm:"not null;default:0"`
-	Answers          string `gorm:"type:text"` // JSON string
-	TimeUsed         int    // in minutes
+	ExamAssignmentID uint     `gorm:"not null;default:0"`
+	StudentID        uint     `gorm:"not null;default:0"`
+	Score            int      `gorm:"not null;default:0"`     // 最终成绩（应用成绩调整后）
+	Answers          string   `gorm:"type:text"`              // JSON string
+	RawScore         int      `gorm:"not null;default:0"`     // 评分得到的原始成绩
+	ScoreOverride    int      `gorm:"not null;default:0"`     // 手动修改总分时相对各题得分之和的调整量，重新计算总分时保留
+	Adjusted         bool     `gorm:"not null;default:false"` // 是否应用了成绩调整
+	Grade            string   `gorm:"type:varchar(20)"`       // 等级（应用了等级制时）
+	GradePoint       *float64 // 绩点
+	TimeUsed         int      // in minutes
 
 	ExamAssignment ExamAssignment `gorm:"foreignKey:ExamAssignmentID"`
 }
@@ -79,9 +220,21 @@ type Options []struct {
 	Text string `json:"text"`
 }
 
-type Answers []struct {
-	Options []string `json:"options"`
-	Type    string   `json:"type"`
+type Answers []Blank
+
+// Blank 填空题一个空的标准答案和判分规则
+type Blank struct {
+	Options []string `json:"options"` // 可接受的答案
+	Type    string   `json:"type"`    // 输入框类型：text、number（number 按数值比较）
+
+	IgnoreCase        bool    `json:"ignoreCase,omitempty"`        // 忽略大小写
+	NormalizeSpace    bool    `json:"normalizeSpace,omitempty"`    // 去掉首尾空白并合并连续空白
+	NormalizeWidth    bool    `json:"normalizeWidth,omitempty"`    // 全角字符按半角比较
+	IgnorePunctuation bool    `json:"ignorePunctuation,omitempty"` // 忽略标点符号
+	Regex             bool    `json:"regex,omitempty"`             // 答案为正则表达式，需完整匹配
+	Tolerance         float64 `json:"tolerance,omitempty"`         // 数值答案允许的误差
+	// Group 同一分组的空不区分顺序（如"任意写出两个……"），同一答案只计一次
+	Group string `json:"group,omitempty"`
 }
 
 func (j *Options) Scan(value interface{}) error {
@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// getJSON 请求并解析JSON
+func getJSON(ctx context.Context, endpoint string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := externalHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", endpoint, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// externalHTTPClient 请求外部系统使用的HTTP客户端
+var externalHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// parseRemoteToken 使用外部系统公布的公钥验证令牌签名和有效期，返回其中的声明
+func parseRemoteToken(ctx context.Context, rawToken, jwksURL string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, errors.New("unexpected signing method")
+		}
+		kid, _ := token.Header["kid"].(string)
+		return remoteKeys.key(ctx, jwksURL, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("missing expiry")
+	}
+	return claims, nil
+}
+
+// jwksRefreshInterval 同一JWKS地址两次拉取之间的最短间隔，避免用随机kid的令牌反复触发拉取
+const jwksRefreshInterval = time.Minute
+
+// jwksCache 按地址缓存外部系统（身份提供方、LTI平台）公布的签名公钥
+type jwksCache struct {
+	mu      sync.Mutex
+	entries map[string]*jwksEntry
+}
+
+// jwksEntry 一个JWKS地址的缓存，fetching 不为空时表示正在拉取，拉取完成后关闭
+type jwksEntry struct {
+	keys      map[string]interface{}
+	fetchedAt time.Time
+	fetching  chan struct{}
+}
+
+var remoteKeys = &jwksCache{entries: map[string]*jwksEntry{}}
+
+// key 按密钥ID查找签名公钥，未找到时重新拉取JWKS（对方可能已轮换密钥）
+//
+// 拉取时不持有锁，同一地址同时只有一个请求在拉取，其他请求等待其结果；每个地址按 jwksRefreshInterval 限制拉取频率
+func (c *jwksCache) key(ctx context.Context, jwksURL, kid string) (interface{}, error) {
+	c.mu.Lock()
+	entry := c.entries[jwksURL]
+	if entry == nil {
+		entry = &jwksEntry{}
+		c.entries[jwksURL] = entry
+	}
+	if key, ok := lookupJWK(entry.keys, kid); ok {
+		c.mu.Unlock()
+		return key, nil
+	}
+
+	if fetching := entry.fetching; fetching != nil {
+		// 其他请求正在拉取，等待其完成
+		c.mu.Unlock()
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		c.mu.Lock()
+		key, ok := lookupJWK(entry.keys, kid)
+		c.mu.Unlock()
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+		return key, nil
+	}
+
+	if !entry.fetchedAt.IsZero() && time.Since(entry.fetchedAt) < jwksRefreshInterval {
+		c.mu.Unlock()
+		return nil, errors.New("unknown signing key")
+	}
+	fetching := make(chan struct{})
+	entry.fetching = fetching
+	c.mu.Unlock()
+
+	keys, err := fetchJWKS(ctx, jwksURL)
+
+	c.mu.Lock()
+	// 拉取失败也计入间隔，避免对方不可用时每个请求都重试
+	entry.fetchedAt = time.Now()
+	if err == nil {
+		entry.keys = keys
+	}
+	entry.fetching = nil
+	close(fetching)
+	c.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := lookupJWK(keys, kid); ok {
+		return key, nil
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+// lookupJWK 按密钥ID查找公钥，只有一个密钥且令牌未指定kid时直接使用
+func lookupJWK(keys map[string]interface{}, kid string) (interface{}, bool) {
+	if key, ok := keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// fetchJWKS 拉取JWKS中用于签名的公钥
+func fetchJWKS(ctx context.Context, jwksURL string) (map[string]interface{}, error) {
+	var jwks struct {
+		Keys []JSONWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, jwksURL, &jwks); err != nil {
+		return nil, err
+	}
+	keys := map[string]interface{}{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// JSONWebKey JWKS中的公钥
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// RSAPublicJWK 将RSA公钥转换为JWK，用于公布本系统的签名公钥
+func RSAPublicJWK(key *rsa.PublicKey, kid string) JSONWebKey {
+	return JSONWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// publicKey 将JWK转换为RSA或ECDSA公钥
+func (k JSONWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
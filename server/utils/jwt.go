@@ -1,47 +1,229 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
-// JWT密钥，在生产环境中应该从环境变量中读取
-var jwtSecret = []byte("exam_system_secret_key")
+// 默认令牌有效期
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+var (
+	// jwtKeys 按密钥ID索引的签名密钥，保留旧密钥以便轮换期间验证旧token
+	jwtKeys = map[string][]byte{}
+	// jwtActiveKeyID 当前用于签名的密钥ID
+	jwtActiveKeyID string
+
+	// AccessTokenTTL 访问令牌有效期
+	AccessTokenTTL = defaultAccessTokenTTL
+	// RefreshTokenTTL 刷新令牌有效期
+	RefreshTokenTTL = defaultRefreshTokenTTL
+)
+
+// 令牌类型
+const (
+	TokenTypeAccess         = "access"     // 访问令牌
+	TokenTypeTwoFactor      = "2fa"        // 两步验证挑战令牌
+	TokenTypeTwoFactorSetup = "2fa_setup"  // 强制绑定两步验证的挑战令牌
+	TokenTypeOIDCState      = "oidc_state" // OIDC登录的state
+	TokenTypeLTIState       = "lti_state"  // LTI启动的state
+)
+
+// challengeTokenTTL 登录挑战令牌有效期
+const challengeTokenTTL = 5 * time.Minute
+
+// stateTokenTTL 从跳转到外部系统登录到回调的最长时间
+const stateTokenTTL = 10 * time.Minute
 
 // Claims 定义JWT的声明结构
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Role     byte   `json:"role"`
-	IsAdmin  byte   `json:"is_admin"`
+	UserID    uint   `json:"user_id"`
+	Username  string `json:"username"`
+	Role      byte   `json:"role"`
+	IsAdmin   byte   `json:"is_admin"`
+	SessionID uint   `json:"sid"`
+	TokenType string `json:"typ"`
+
+	// 模拟登录：ImpersonatorID 为发起模拟的管理员/教师，模拟令牌始终只读
+	ImpersonatorID uint `json:"imp,omitempty"`
+	ReadOnly       bool `json:"ro,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken 生成JWT token
-func GenerateToken(userID uint, username string, role byte, isAdmin byte) (string, error) {
-	// 设置token过期时间（7天）
-	expirationTime := time.Now().Add(7 * 24 * time.Hour)
+// TokenOption 访问令牌的可选项
+type TokenOption func(*Claims)
+
+// WithImpersonator 标记为模拟登录令牌（只读），记录发起模拟的用户
+func WithImpersonator(impersonatorID uint) TokenOption {
+	return func(claims *Claims) {
+		claims.ImpersonatorID = impersonatorID
+		claims.ReadOnly = true
+	}
+}
+
+// LoadJWTConfig 从环境变量加载JWT配置
+//
+//	JWT_KEYS        多个签名密钥，格式 "kid1:secret1,kid2:secret2"
+//	JWT_ACTIVE_KEY  用于签名的密钥ID，默认为 JWT_KEYS 中的第一个
+//	JWT_SECRET      单个签名密钥（未配置 JWT_KEYS 时使用）
+//	JWT_ACCESS_TTL  访问令牌有效期，如 "15m"
+//	JWT_REFRESH_TTL 刷新令牌有效期，如 "168h"
+func LoadJWTConfig() error {
+	keys := map[string][]byte{}
+	activeKeyID := ""
+
+	if raw := os.Getenv("JWT_KEYS"); raw != "" {
+		for _, item := range strings.Split(raw, ",") {
+			kid, secret, ok := strings.Cut(strings.TrimSpace(item), ":")
+			if !ok || kid == "" || secret == "" {
+				return fmt.Errorf("invalid JWT_KEYS entry %q", item)
+			}
+			keys[kid] = []byte(secret)
+			if activeKeyID == "" {
+				activeKeyID = kid
+			}
+		}
+	} else if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		keys["default"] = []byte(secret)
+		activeKeyID = "default"
+	} else {
+		// 未配置密钥时随机生成，服务重启后所有token失效
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		keys["random"] = secret
+		activeKeyID = "random"
+		log.Println("JWT_SECRET is not set, using a random signing key")
+	}
+
+	if kid := os.Getenv("JWT_ACTIVE_KEY"); kid != "" {
+		if _, ok := keys[kid]; !ok {
+			return fmt.Errorf("JWT_ACTIVE_KEY %q not found in JWT_KEYS", kid)
+		}
+		activeKeyID = kid
+	}
+
+	accessTTL, err := durationFromEnv("JWT_ACCESS_TTL", defaultAccessTokenTTL)
+	if err != nil {
+		return err
+	}
+	refreshTTL, err := durationFromEnv("JWT_REFRESH_TTL", defaultRefreshTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	jwtKeys = keys
+	jwtActiveKeyID = activeKeyID
+	AccessTokenTTL = accessTTL
+	RefreshTokenTTL = refreshTTL
+	return nil
+}
+
+// durationFromEnv 读取时长类型的环境变量
+func durationFromEnv(name string, fallback time.Duration) (time.Duration, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, raw)
+	}
+	return d, nil
+}
+
+// GenerateToken 生成JWT访问令牌
+func GenerateToken(userID uint, username string, role byte, isAdmin byte, sessionID uint, opts ...TokenOption) (string, error) {
+	if len(jwtKeys) == 0 {
+		return "", errors.New("jwt keys not loaded")
+	}
+
+	now := time.Now()
 
 	// 创建声明
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
-		IsAdmin:  isAdmin,
+		UserID:    userID,
+		Username:  username,
+		Role:      role,
+		IsAdmin:   isAdmin,
+		SessionID: sessionID,
+		TokenType: TokenTypeAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "exam_system",
+		},
+	}
+	for _, opt := range opts {
+		opt(claims)
+	}
+
+	return signClaims(claims)
+}
+
+// GenerateChallengeToken 生成登录挑战令牌（密码已验证，等待第二步验证）
+func GenerateChallengeToken(userID uint, tokenType string) (string, error) {
+	if len(jwtKeys) == 0 {
+		return "", errors.New("jwt keys not loaded")
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		UserID:    userID,
+		TokenType: tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(challengeTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "exam_system",
+		},
+	}
+
+	return signClaims(claims)
+}
+
+// GenerateStateToken 生成跳转到外部系统登录时使用的state，nonce 同时写入浏览器Cookie用于回调时校验；
+// subjectID 按令牌类型保存关联的ID（OIDC为待关联的用户，LTI为平台）
+func GenerateStateToken(tokenType, nonce string, subjectID uint) (string, error) {
+	if len(jwtKeys) == 0 {
+		return "", errors.New("jwt keys not loaded")
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		UserID:    subjectID,
+		TokenType: tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        nonce,
+			ExpiresAt: jwt.NewNumericDate(now.Add(stateTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
 			Issuer:    "exam_system",
 		},
 	}
 
-	// 创建token
+	return signClaims(claims)
+}
+
+// signClaims 使用当前密钥签名，在头部写入密钥ID以支持密钥轮换
+func signClaims(claims *Claims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = jwtActiveKeyID
 
 	// 签名token
-	tokenString, err := token.SignedString(jwtSecret)
+	tokenString, err := token.SignedString(jwtKeys[jwtActiveKeyID])
 	if err != nil {
 		return "", err
 	}
@@ -49,15 +231,32 @@ func GenerateToken(userID uint, username string, role byte, isAdmin byte) (strin
 	return tokenString, nil
 }
 
-// ParseToken 解析并验证JWT token
+// ParseToken 解析并验证JWT访问令牌
 func ParseToken(tokenString string) (*Claims, error) {
+	return parseClaims(tokenString, TokenTypeAccess)
+}
+
+// ParseChallengeToken 解析并验证指定类型的登录挑战令牌
+func ParseChallengeToken(tokenString, tokenType string) (*Claims, error) {
+	return parseClaims(tokenString, tokenType)
+}
+
+// parseClaims 解析token并校验令牌类型，防止挑战令牌被当作访问令牌使用
+func parseClaims(tokenString, tokenType string) (*Claims, error) {
 	// 解析token
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		// 验证签名方法
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
 		}
-		return jwtSecret, nil
+
+		// 根据密钥ID查找签名密钥
+		kid, _ := token.Header["kid"].(string)
+		key, ok := jwtKeys[kid]
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+		return key, nil
 	})
 
 	if err != nil {
@@ -65,26 +264,33 @@ func ParseToken(tokenString string) (*Claims, error) {
 	}
 
 	// 验证token是否有效
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.TokenType == tokenType {
 		return claims, nil
 	}
 
 	return nil, errors.New("invalid token")
 }
 
-// RefreshToken 刷新token（重新生成token）
-func RefreshToken(tokenString string) (string, error) {
-	// 先验证原token
-	claims, err := ParseToken(tokenString)
+// GenerateRefreshToken 生成随机刷新令牌，返回令牌原文和用于存储的哈希
+func GenerateRefreshToken() (string, string, error) {
+	token, err := RandomToken()
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
+	return token, HashToken(token), nil
+}
 
-	// 如果token即将过期（剩余时间小于1天），则重新生成
-	if time.Until(claims.ExpiresAt.Time) < 24*time.Hour {
-		return GenerateToken(claims.UserID, claims.Username, claims.Role, claims.IsAdmin)
+// RandomToken 生成32字节的随机字符串（URL安全的Base64）
+func RandomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
 
-	// 否则返回原token
-	return tokenString, nil
+// HashToken 计算令牌的SHA256哈希，数据库中只保存哈希
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
 }
@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrLDAPInvalidCredentials 目录中不存在该用户或密码错误
+var ErrLDAPInvalidCredentials = errors.New("invalid ldap credentials")
+
+// LDAPConfig LDAP/Active Directory 认证和同步配置
+type LDAPConfig struct {
+	URL          string
+	StartTLS     bool
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+
+	// 用户查询和属性映射
+	StudentFilter  string
+	TeacherFilter  string
+	UsernameAttr   string
+	NameAttr       string
+	StudentIDAttr  string
+	PhoneAttr      string
+	MajorAttr      string
+	TeacherRole    string // 同步创建的教师账号的角色
+	ClassFilter    string // 班级分组的查询条件，分组名称与班级名称一致
+	ClassNameAttr  string
+	MemberAttr     string
+	SyncInterval   time.Duration
+	ConnectTimeout time.Duration
+}
+
+// LDAP 当前的LDAP配置，未配置时为nil
+var LDAP *LDAPConfig
+
+// LoadLDAPConfig 从环境变量加载LDAP配置，未设置 LDAP_URL 时不启用
+//
+//	LDAP_URL              目录服务地址，如 "ldaps://ldap.example.edu:636"
+//	LDAP_START_TLS        为 "true" 时在 ldap:// 连接上启用StartTLS
+//	LDAP_BIND_DN          查询目录使用的服务账号
+//	LDAP_BIND_PASSWORD    服务账号密码
+//	LDAP_BASE_DN          查询的根节点，如 "dc=example,dc=edu"
+//	LDAP_STUDENT_FILTER   学生的查询条件，默认 "(&(objectClass=person)(employeeType=student))"
+//	LDAP_TEACHER_FILTER   教师的查询条件，默认 "(&(objectClass=person)(employeeType=teacher))"
+//	LDAP_USERNAME_ATTR    用户名属性，默认 "uid"（Active Directory 使用 "sAMAccountName"）
+//	LDAP_NAME_ATTR        姓名属性，默认 "cn"
+//	LDAP_STUDENT_ID_ATTR  学号属性，默认 "employeeNumber"
+//	LDAP_PHONE_ATTR       电话属性，默认 "telephoneNumber"
+//	LDAP_MAJOR_ATTR       专业属性，默认 "departmentNumber"
+//	LDAP_TEACHER_ROLE     同步创建的教师账号的角色，默认 "teacher"
+//	LDAP_CLASS_FILTER     班级分组的查询条件，默认 "(objectClass=groupOfNames)"
+//	LDAP_CLASS_NAME_ATTR  分组名称属性，默认 "cn"
+//	LDAP_MEMBER_ATTR      分组成员属性（成员DN），默认 "member"
+//	LDAP_SYNC_INTERVAL    自动同步间隔，如 "24h"，未设置时只能手动同步
+func LoadLDAPConfig() error {
+	url := os.Getenv("LDAP_URL")
+	if url == "" {
+		LDAP = nil
+		return nil
+	}
+
+	config := &LDAPConfig{
+		URL:            url,
+		StartTLS:       os.Getenv("LDAP_START_TLS") == "true",
+		BindDN:         os.Getenv("LDAP_BIND_DN"),
+		BindPassword:   os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:         os.Getenv("LDAP_BASE_DN"),
+		StudentFilter:  envOrDefault("LDAP_STUDENT_FILTER", "(&(objectClass=person)(employeeType=student))"),
+		TeacherFilter:  envOrDefault("LDAP_TEACHER_FILTER", "(&(objectClass=person)(employeeType=teacher))"),
+		UsernameAttr:   envOrDefault("LDAP_USERNAME_ATTR", "uid"),
+		NameAttr:       envOrDefault("LDAP_NAME_ATTR", "cn"),
+		StudentIDAttr:  envOrDefault("LDAP_STUDENT_ID_ATTR", "employeeNumber"),
+		PhoneAttr:      envOrDefault("LDAP_PHONE_ATTR", "telephoneNumber"),
+		MajorAttr:      envOrDefault("LDAP_MAJOR_ATTR", "departmentNumber"),
+		TeacherRole:    envOrDefault("LDAP_TEACHER_ROLE", "teacher"),
+		ClassFilter:    envOrDefault("LDAP_CLASS_FILTER", "(objectClass=groupOfNames)"),
+		ClassNameAttr:  envOrDefault("LDAP_CLASS_NAME_ATTR", "cn"),
+		MemberAttr:     envOrDefault("LDAP_MEMBER_ATTR", "member"),
+		ConnectTimeout: 10 * time.Second,
+	}
+	if config.BaseDN == "" {
+		return errors.New("LDAP_BASE_DN is required when LDAP_URL is set")
+	}
+
+	if raw := os.Getenv("LDAP_SYNC_INTERVAL"); raw != "" {
+		interval, err := durationFromEnv("LDAP_SYNC_INTERVAL", 0)
+		if err != nil {
+			return err
+		}
+		config.SyncInterval = interval
+	}
+
+	LDAP = config
+	return nil
+}
+
+// LDAPEntry 目录中的用户
+type LDAPEntry struct {
+	DN        string
+	Username  string
+	Name      string
+	StudentID string
+	Phone     string
+	Major     string
+	Teacher   bool
+}
+
+// LDAPDirectory 同步时从目录读取的用户和班级分组
+type LDAPDirectory struct {
+	Users []LDAPEntry
+	// ClassMembers 班级名称到成员DN的映射
+	ClassMembers map[string][]string
+}
+
+// dialLDAP 连接目录服务并使用服务账号绑定
+func dialLDAP() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(LDAP.URL, ldap.DialWithDialer(&net.Dialer{Timeout: LDAP.ConnectTimeout}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(LDAP.ConnectTimeout)
+
+	if LDAP.StartTLS {
+		host := strings.TrimPrefix(LDAP.URL, "ldap://")
+		host, _, _ = strings.Cut(host, ":")
+		if err := conn.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if LDAP.BindDN != "" {
+		err = conn.Bind(LDAP.BindDN, LDAP.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// userAttributes 查询用户时需要返回的属性
+func userAttributes() []string {
+	return []string{LDAP.UsernameAttr, LDAP.NameAttr, LDAP.StudentIDAttr, LDAP.PhoneAttr, LDAP.MajorAttr}
+}
+
+// toLDAPEntry 将查询结果转换为目录用户
+func toLDAPEntry(entry *ldap.Entry, teacher bool) LDAPEntry {
+	return LDAPEntry{
+		DN:        entry.DN,
+		Username:  entry.GetAttributeValue(LDAP.UsernameAttr),
+		Name:      entry.GetAttributeValue(LDAP.NameAttr),
+		StudentID: entry.GetAttributeValue(LDAP.StudentIDAttr),
+		Phone:     entry.GetAttributeValue(LDAP.PhoneAttr),
+		Major:     entry.GetAttributeValue(LDAP.MajorAttr),
+		Teacher:   teacher,
+	}
+}
+
+// LDAPAuthenticate 在目录中查找用户并验证密码
+func LDAPAuthenticate(username, password string, teacher bool) (LDAPEntry, error) {
+	// 空密码会被目录当作匿名绑定而"成功"，必须拒绝
+	if username == "" || password == "" {
+		return LDAPEntry{}, ErrLDAPInvalidCredentials
+	}
+
+	conn, err := dialLDAP()
+	if err != nil {
+		return LDAPEntry{}, err
+	}
+	defer conn.Close()
+
+	filter := LDAP.StudentFilter
+	if teacher {
+		filter = LDAP.TeacherFilter
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		LDAP.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf("(&%s(%s=%s))", filter, LDAP.UsernameAttr, ldap.EscapeFilter(username)),
+		userAttributes(), nil,
+	))
+	if err != nil {
+		return LDAPEntry{}, err
+	}
+	if len(result.Entries) != 1 {
+		return LDAPEntry{}, ErrLDAPInvalidCredentials
+	}
+
+	entry := result.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return LDAPEntry{}, ErrLDAPInvalidCredentials
+		}
+		return LDAPEntry{}, err
+	}
+	return toLDAPEntry(entry, teacher), nil
+}
+
+// LDAPFetchDirectory 读取目录中的所有学生、教师和班级分组
+func LDAPFetchDirectory() (*LDAPDirectory, error) {
+	conn, err := dialLDAP()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	directory := &LDAPDirectory{ClassMembers: map[string][]string{}}
+	for _, teacher := range []bool{false, true} {
+		filter := LDAP.StudentFilter
+		if teacher {
+			filter = LDAP.TeacherFilter
+		}
+		result, err := conn.SearchWithPaging(ldap.NewSearchRequest(
+			LDAP.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+			filter, userAttributes(), nil,
+		), 500)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range result.Entries {
+			if user := toLDAPEntry(entry, teacher); user.Username != "" {
+				directory.Users = append(directory.Users, user)
+			}
+		}
+	}
+
+	result, err := conn.SearchWithPaging(ldap.NewSearchRequest(
+		LDAP.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		LDAP.ClassFilter, []string{LDAP.ClassNameAttr, LDAP.MemberAttr}, nil,
+	), 500)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range result.Entries {
+		if name := entry.GetAttributeValue(LDAP.ClassNameAttr); name != "" {
+			directory.ClassMembers[name] = append(directory.ClassMembers[name], entry.GetAttributeValues(LDAP.MemberAttr)...)
+		}
+	}
+
+	return directory, nil
+}
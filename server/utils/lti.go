@@ -0,0 +1,263 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// LTI 1.3 消息中的声明
+const (
+	LTIClaimMessageType      = "https://purl.imsglobal.org/spec/lti/claim/message_type"
+	LTIClaimVersion          = "https://purl.imsglobal.org/spec/lti/claim/version"
+	LTIClaimDeploymentID     = "https://purl.imsglobal.org/spec/lti/claim/deployment_id"
+	LTIClaimResourceLink     = "https://purl.imsglobal.org/spec/lti/claim/resource_link"
+	LTIClaimRoles            = "https://purl.imsglobal.org/spec/lti/claim/roles"
+	LTIClaimCustom           = "https://purl.imsglobal.org/spec/lti/claim/custom"
+	LTIClaimDeepLinkSettings = "https://purl.imsglobal.org/spec/lti-dl/claim/deep_linking_settings"
+	LTIClaimContentItems     = "https://purl.imsglobal.org/spec/lti-dl/claim/content_items"
+	LTIClaimDeepLinkData     = "https://purl.imsglobal.org/spec/lti-dl/claim/data"
+	LTIClaimAGSEndpoint      = "https://purl.imsglobal.org/spec/lti-ags/claim/endpoint"
+
+	LTIMessageResourceLink    = "LtiResourceLinkRequest"
+	LTIMessageDeepLinking     = "LtiDeepLinkingRequest"
+	LTIMessageDeepLinkingResp = "LtiDeepLinkingResponse"
+
+	LTIScopeScore = "https://purl.imsglobal.org/spec/lti-ags/scope/score"
+)
+
+// LTIConfig LTI工具配置
+type LTIConfig struct {
+	ToolURL     string // 后端服务的公网地址，用于启动和JWKS地址
+	FrontendURL string // 启动完成后跳转的前端地址
+}
+
+// LTI 当前的LTI配置，未配置时为nil
+var LTI *LTIConfig
+
+// LoadLTIConfig 从环境变量加载LTI配置，未设置 LTI_TOOL_URL 时不启用
+//
+//	LTI_TOOL_URL     后端服务的公网地址，如 "https://exam.example.edu"
+//	LTI_FRONTEND_URL 前端地址，默认与 LTI_TOOL_URL 相同
+func LoadLTIConfig() error {
+	toolURL := strings.TrimRight(os.Getenv("LTI_TOOL_URL"), "/")
+	if toolURL == "" {
+		LTI = nil
+		return nil
+	}
+	if _, err := url.ParseRequestURI(toolURL); err != nil {
+		return fmt.Errorf("invalid LTI_TOOL_URL: %q", toolURL)
+	}
+
+	LTI = &LTIConfig{
+		ToolURL:     toolURL,
+		FrontendURL: strings.TrimRight(envOrDefault("LTI_FRONTEND_URL", toolURL), "/"),
+	}
+	return nil
+}
+
+// LaunchURL LTI启动地址（平台登录完成后以表单POST提交id_token）
+func (c *LTIConfig) LaunchURL() string {
+	return c.ToolURL + "/api/lti/launch"
+}
+
+// LTIToolKey LTI工具的签名密钥，用于Deep Linking响应和成绩回传的客户端断言
+type LTIToolKey struct {
+	Key *rsa.PrivateKey
+	KID string
+}
+
+// GenerateLTIToolKeyPEM 生成新的RSA私钥（PEM格式）
+func GenerateLTIToolKeyPEM() (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})), nil
+}
+
+// ParseLTIToolKey 解析PEM格式的私钥，密钥ID由公钥计算
+func ParseLTIToolKey(pemData string) (*LTIToolKey, error) {
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil {
+		return nil, errors.New("invalid private key")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(key.PublicKey.N.Bytes())
+	return &LTIToolKey{Key: key, KID: hex.EncodeToString(hash[:8])}, nil
+}
+
+// JWK 公钥的JWK表示，通过JWKS地址公布给平台
+func (k *LTIToolKey) JWK() JSONWebKey {
+	return RSAPublicJWK(&k.Key.PublicKey, k.KID)
+}
+
+// Sign 使用工具私钥签名（RS256）
+func (k *LTIToolKey) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = k.KID
+	return token.SignedString(k.Key)
+}
+
+// ParseLTIToken 验证平台签发的id_token：签名、签发方、受众和有效期
+func ParseLTIToken(ctx context.Context, rawToken, keySetURL, issuer, clientID string) (jwt.MapClaims, error) {
+	claims, err := parseRemoteToken(ctx, rawToken, keySetURL)
+	if err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); iss != issuer {
+		return nil, errors.New("invalid issuer")
+	}
+	if !claims.VerifyAudience(clientID, true) {
+		return nil, errors.New("invalid audience")
+	}
+	// 有多个受众时 azp 必须为本工具
+	if audiences, ok := claims["aud"].([]interface{}); ok && len(audiences) > 1 {
+		if azp, _ := claims["azp"].(string); azp != clientID {
+			return nil, errors.New("invalid authorized party")
+		}
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("missing subject")
+	}
+	return claims, nil
+}
+
+// ltiAccessToken 缓存的平台访问令牌
+type ltiAccessToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+var (
+	ltiTokenMutex sync.Mutex
+	ltiTokens     = map[string]ltiAccessToken{}
+)
+
+// FetchLTIAccessToken 使用客户端断言（JWT）向平台申请访问令牌，令牌过期前重复使用
+func FetchLTIAccessToken(ctx context.Context, key *LTIToolKey, tokenURL, clientID, scope string) (string, error) {
+	cacheKey := tokenURL + "|" + clientID + "|" + scope
+	ltiTokenMutex.Lock()
+	cached, ok := ltiTokens[cacheKey]
+	ltiTokenMutex.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.token, nil
+	}
+
+	jti, err := RandomToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	assertion, err := key.Sign(jwt.RegisteredClaims{
+		Issuer:    clientID,
+		Subject:   clientID,
+		Audience:  jwt.ClaimStrings{tokenURL},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		ID:        jti,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {assertion},
+		"scope":                 {scope},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := externalHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint: %s", resp.Status)
+	}
+
+	var tokenResponse struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return "", err
+	}
+	if tokenResponse.AccessToken == "" {
+		return "", errors.New("token response has no access_token")
+	}
+
+	// 提前一分钟过期，避免使用时刚好失效
+	expiresIn := time.Duration(tokenResponse.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = time.Hour
+	}
+	ltiTokenMutex.Lock()
+	ltiTokens[cacheKey] = ltiAccessToken{token: tokenResponse.AccessToken, expiresAt: now.Add(expiresIn - time.Minute)}
+	ltiTokenMutex.Unlock()
+	return tokenResponse.AccessToken, nil
+}
+
+// LTIScore 回传到平台成绩册的成绩
+type LTIScore struct {
+	UserID           string  `json:"userId"`
+	ScoreGiven       float64 `json:"scoreGiven"`
+	ScoreMaximum     float64 `json:"scoreMaximum"`
+	ActivityProgress string  `json:"activityProgress"`
+	GradingProgress  string  `json:"gradingProgress"`
+	Timestamp        string  `json:"timestamp"`
+}
+
+// PostLTIScore 将成绩提交到成绩项的 scores 地址
+func PostLTIScore(ctx context.Context, lineItemURL, accessToken string, score LTIScore) error {
+	scoresURL, err := url.Parse(lineItemURL)
+	if err != nil {
+		return err
+	}
+	scoresURL.Path = strings.TrimRight(scoresURL.Path, "/") + "/scores"
+
+	body, err := json.Marshal(score)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, scoresURL.String(), strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.ims.lis.v1.score+json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := externalHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("score endpoint: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// OIDCConfig OpenID Connect 登录配置
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// 声明映射
+	UsernameClaim  string
+	NameClaim      string
+	StudentIDClaim string
+	RoleClaim      string
+	// RoleMapping 角色声明的值到系统角色名称的映射，匹配到任意角色的用户为教师，否则为学生
+	RoleMapping map[string]string
+
+	// LinkExisting 首次登录时按学号关联已有的学生账号（不关联管理员和教师账号）
+	LinkExisting bool
+}
+
+// OIDC 当前的OIDC配置，未配置时为nil
+var OIDC *OIDCConfig
+
+// LoadOIDCConfig 从环境变量加载OIDC配置，未设置 OIDC_ISSUER 时不启用
+//
+//	OIDC_ISSUER           身份提供方地址，如 "https://sso.example.edu"
+//	OIDC_CLIENT_ID        客户端ID
+//	OIDC_CLIENT_SECRET    客户端密钥
+//	OIDC_REDIRECT_URL     回调地址（前端页面，收到 code/state 后调用 /api/auth/oidc/callback）
+//	OIDC_SCOPES           申请的scope，默认 "openid profile"
+//	OIDC_USERNAME_CLAIM   用户名声明，默认 "preferred_username"
+//	OIDC_NAME_CLAIM       姓名声明，默认 "name"
+//	OIDC_STUDENT_ID_CLAIM 学号声明，默认 "student_id"
+//	OIDC_ROLE_CLAIM       角色声明，默认 "roles"
+//	OIDC_ROLE_MAPPING     角色映射，格式 "staff:teacher,it:admin"，默认 "teacher:teacher"
+//	OIDC_LINK_EXISTING    为 "true" 时首次登录按学号自动关联已有的学生账号
+func LoadOIDCConfig() error {
+	issuer := strings.TrimRight(os.Getenv("OIDC_ISSUER"), "/")
+	if issuer == "" {
+		OIDC = nil
+		return nil
+	}
+
+	config := &OIDCConfig{
+		Issuer:         issuer,
+		ClientID:       os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:   os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:    os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:         strings.Fields(envOrDefault("OIDC_SCOPES", "openid profile")),
+		UsernameClaim:  envOrDefault("OIDC_USERNAME_CLAIM", "preferred_username"),
+		NameClaim:      envOrDefault("OIDC_NAME_CLAIM", "name"),
+		StudentIDClaim: envOrDefault("OIDC_STUDENT_ID_CLAIM", "student_id"),
+		RoleClaim:      envOrDefault("OIDC_ROLE_CLAIM", "roles"),
+		RoleMapping:    map[string]string{},
+		LinkExisting:   os.Getenv("OIDC_LINK_EXISTING") == "true",
+	}
+	if config.ClientID == "" || config.RedirectURL == "" {
+		return errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ISSUER is set")
+	}
+
+	for _, item := range strings.Split(envOrDefault("OIDC_ROLE_MAPPING", "teacher:teacher"), ",") {
+		value, role, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || value == "" || role == "" {
+			return fmt.Errorf("invalid OIDC_ROLE_MAPPING entry %q", item)
+		}
+		config.RoleMapping[value] = role
+	}
+
+	OIDC = config
+	oidcProvider = &oidcProviderCache{}
+	return nil
+}
+
+// envOrDefault 读取环境变量，未设置时返回默认值
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// oidcDiscovery 身份提供方的发现文档
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcProviderCache 缓存发现文档
+type oidcProviderCache struct {
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+}
+
+var oidcProvider = &oidcProviderCache{}
+
+// discover 获取发现文档（首次成功后缓存）
+func (p *oidcProviderCache) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := getJSON(ctx, OIDC.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimRight(discovery.Issuer, "/") != OIDC.Issuer {
+		return nil, fmt.Errorf("issuer mismatch: %q", discovery.Issuer)
+	}
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// OIDCAuthCodeURL 生成跳转到身份提供方的授权地址
+func OIDCAuthCodeURL(ctx context.Context, state, nonce string) (string, error) {
+	discovery, err := oidcProvider.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {OIDC.ClientID},
+		"redirect_uri":  {OIDC.RedirectURL},
+		"scope":         {strings.Join(OIDC.Scopes, " ")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// OIDCExchange 用授权码换取并验证ID令牌，返回其中的声明
+func OIDCExchange(ctx context.Context, code, nonce string) (jwt.MapClaims, error) {
+	discovery, err := oidcProvider.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {OIDC.RedirectURL},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(OIDC.ClientID), url.QueryEscape(OIDC.ClientSecret))
+
+	resp, err := externalHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint: %s", resp.Status)
+	}
+
+	var tokenResponse struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return nil, err
+	}
+	if tokenResponse.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return verifyIDToken(ctx, tokenResponse.IDToken, nonce)
+}
+
+// verifyIDToken 验证ID令牌的签名、签发方、受众、有效期和nonce
+func verifyIDToken(ctx context.Context, rawToken, nonce string) (jwt.MapClaims, error) {
+	discovery, err := oidcProvider.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := parseRemoteToken(ctx, rawToken, discovery.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimRight(iss, "/") != OIDC.Issuer {
+		return nil, errors.New("invalid issuer")
+	}
+	if !claims.VerifyAudience(OIDC.ClientID, true) {
+		return nil, errors.New("invalid audience")
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, errors.New("invalid nonce")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("missing subject")
+	}
+	return claims, nil
+}
@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XLSXWriter 流式生成 .xlsx 文件（Office Open XML），逐行写入工作表，不需要把整个文件放在内存中
+//
+// 字符串使用内联字符串保存，数字保存为数值单元格，表头使用粗体
+type XLSXWriter struct {
+	zip    *zip.Writer
+	sheets []string
+	sheet  io.Writer
+	row    int
+	err    error
+}
+
+// NewXLSXWriter 创建写入 w 的 XLSX 文件，写完后需要调用 Close
+func NewXLSXWriter(w io.Writer) *XLSXWriter {
+	return &XLSXWriter{zip: zip.NewWriter(w)}
+}
+
+// xlsxSheetName 工作表名称最长31个字符，不能包含 []:*?/\
+func xlsxSheetName(name string, index int) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	if strings.TrimSpace(name) == "" {
+		name = fmt.Sprintf("Sheet%d", index)
+	}
+	return name
+}
+
+// AddSheet 开始一个新的工作表，之后写入的行都属于该工作表
+func (x *XLSXWriter) AddSheet(name string) error {
+	if x.err != nil {
+		return x.err
+	}
+	x.endSheet()
+	x.sheets = append(x.sheets, xlsxSheetName(name, len(x.sheets)+1))
+	x.sheet, x.err = x.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(x.sheets)))
+	x.row = 0
+	x.write(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return x.err
+}
+
+// WriteHeader 写入粗体的表头行
+func (x *XLSXWriter) WriteHeader(cells ...string) error {
+	values := make([]interface{}, len(cells))
+	for i, cell := range cells {
+		values[i] = cell
+	}
+	return x.writeRow(values, 1)
+}
+
+// WriteRow 写入一行，支持字符串、整数、浮点数、布尔值和时间，nil 为空单元格
+func (x *XLSXWriter) WriteRow(cells ...interface{}) error {
+	return x.writeRow(cells, 0)
+}
+
+func (x *XLSXWriter) writeRow(cells []interface{}, style int) error {
+	if x.err != nil {
+		return x.err
+	}
+	if x.sheet == nil {
+		if err := x.AddSheet(""); err != nil {
+			return err
+		}
+	}
+
+	x.row++
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<row r="%d">`, x.row)
+	for i, cell := range cells {
+		ref := xlsxColumn(i) + strconv.Itoa(x.row)
+		styleAttr := ""
+		if style > 0 {
+			styleAttr = fmt.Sprintf(` s="%d"`, style)
+		}
+
+		switch value := cell.(type) {
+		case nil:
+			continue
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			fmt.Fprintf(&buf, `<c r="%s"%s><v>%d</v></c>`, ref, styleAttr, value)
+		case float32:
+			writeXLSXNumber(&buf, ref, styleAttr, float64(value))
+		case float64:
+			writeXLSXNumber(&buf, ref, styleAttr, value)
+		case bool:
+			flag := 0
+			if value {
+				flag = 1
+			}
+			fmt.Fprintf(&buf, `<c r="%s" t="b"%s><v>%d</v></c>`, ref, styleAttr, flag)
+		case time.Time:
+			writeXLSXString(&buf, ref, styleAttr, value.Format("2006-01-02 15:04:05"))
+		case string:
+			writeXLSXString(&buf, ref, styleAttr, value)
+		default:
+			writeXLSXString(&buf, ref, styleAttr, fmt.Sprint(value))
+		}
+	}
+	buf.WriteString(`</row>`)
+	x.write(buf.String())
+	return x.err
+}
+
+// writeXLSXNumber 数值单元格，NaN 和无穷大写为空单元格
+func writeXLSXNumber(buf *bytes.Buffer, ref, styleAttr string, value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	fmt.Fprintf(buf, `<c r="%s"%s><v>%s</v></c>`, ref, styleAttr, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// writeXLSXString 内联字符串单元格
+func writeXLSXString(buf *bytes.Buffer, ref, styleAttr, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(buf, `<c r="%s" t="inlineStr"%s><is><t xml:space="preserve">`, ref, styleAttr)
+	xml.EscapeText(buf, []byte(value))
+	buf.WriteString(`</t></is></c>`)
+}
+
+// xlsxColumn 列序号（从0开始）转换为列名 A、B、…、Z、AA、AB…
+func xlsxColumn(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+func (x *XLSXWriter) write(s string) {
+	if x.err == nil && x.sheet != nil {
+		_, x.err = io.WriteString(x.sheet, s)
+	}
+}
+
+func (x *XLSXWriter) endSheet() {
+	if x.sheet != nil {
+		x.write(`</sheetData></worksheet>`)
+		x.sheet = nil
+	}
+}
+
+// Close 写入工作簿结构并结束文件，没有工作表时生成一个空工作表
+func (x *XLSXWriter) Close() error {
+	if x.err != nil {
+		return x.err
+	}
+	if len(x.sheets) == 0 {
+		x.AddSheet("")
+	}
+	x.endSheet()
+	if x.err != nil {
+		return x.err
+	}
+
+	var contentTypes, workbook, workbookRels strings.Builder
+	contentTypes.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	workbookRels.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, name := range x.sheets {
+		id := i + 1
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" `+
+			`ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, id)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlAttr(name), id, id)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" `+
+			`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, id, id)
+	}
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" `+
+		`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`, len(x.sheets)+1)
+
+	files := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", workbookRels.String()},
+		// 样式0为默认样式，样式1为粗体（表头）
+		{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+			`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+			`</styleSheet>`},
+	}
+	for _, file := range files {
+		w, err := x.zip.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, file.content); err != nil {
+			return err
+		}
+	}
+	return x.zip.Close()
+}
+
+// xmlAttr 转义XML属性值
+func xmlAttr(value string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
@@ -18,9 +18,9 @@ const checkToken = () => {
     const payload = JSON.parse(atob(tokenParts[1]))
     const currentTime = Math.floor(Date.now() / 1000)
     
-    // 如果有exp字段且已过期
+    // 如果有exp字段且已过期（有刷新令牌时由请求拦截器自动续期）
     if (payload.exp && payload.exp < currentTime) {
-      return false
+      return !!localStorage.getItem('refreshToken')
     }
     
     return true
@@ -104,6 +104,11 @@ const routes = [
         name: 'ResultsAnalysis',
         component: () => import('@/views/teacher/ResultsAnalysis.vue')
       },
+      {
+        path: 'gradebook',
+        name: 'Gradebook',
+        component: () => import('@/views/teacher/Gradebook.vue')
+      },
       {
         path: 'broadcast-message',
         name: 'BroadcastMessage',
@@ -30,10 +30,27 @@ api.interceptors.response.use(
     }
     return response.data
   },
-  (error) => {
+  async (error) => {
+    const originalRequest = error.config
+    const refreshToken = localStorage.getItem('refreshToken')
+
+    // 访问令牌过期时使用刷新令牌续期，并重试原请求
+    if (error.response?.status === 401 && refreshToken && originalRequest && !originalRequest._retry &&
+      !originalRequest.url.startsWith('/auth/')) {
+      originalRequest._retry = true
+      try {
+        const data = await refreshAccessToken(refreshToken)
+        originalRequest.headers.Authorization = `Bearer ${data.token}`
+        return api(originalRequest)
+      } catch (refreshError) {
+        // 刷新失败，按未登录处理
+      }
+    }
+
     // 统一错误处理
     if (error.response?.status === 401) {
       localStorage.removeItem('token')
+      localStorage.removeItem('refreshToken')
       // 当前不是登录页面时才跳转
       if (window.location.pathname !== '/login') {
         window.location.href = '/login'
@@ -44,9 +61,30 @@ api.interceptors.response.use(
   }
 )
 
+// 并发请求共用同一次刷新
+let refreshPromise = null
+
+// 刷新访问令牌
+const refreshAccessToken = (refreshToken) => {
+  if (!refreshPromise) {
+    refreshPromise = axios.post('/api/auth/refresh', { refreshToken })
+      .then((response) => {
+        localStorage.setItem('token', response.data.token)
+        localStorage.setItem('refreshToken', response.data.refreshToken)
+        return response.data
+      })
+      .finally(() => {
+        refreshPromise = null
+      })
+  }
+  return refreshPromise
+}
+
 // 认证相关API
 export const authAPI = {
-  login: (data) => api.post('/auth/login', data)
+  login: (data) => api.post('/auth/login', data),
+  logout: () => api.post('/auth/logout'),
+  changePassword: (data) => api.put('/auth/password', data)
 }
 
 // 学生相关API
@@ -55,19 +93,25 @@ export const studentAPI = {
   submitExam: (examId, data) => api.post(`/student/exams/${examId}/submit`, data),
   getResults: (params = {}) => api.get('/student/results', { params }),
   getProfile: () => api.get('/student/profile'),
+  getAnalytics: () => api.get('/student/analytics'),
+  getMastery: () => api.get('/student/mastery'),
   getExamResult: (resultId) => api.get(`/student/results/${resultId}`),
-  getExamDetails: (examId) => api.get(`/student/exams/${examId}`)
+  getExamDetails: (examId) => api.get(`/student/exams/${examId}`),
+  createAppeal: (resultId, data) => api.post(`/student/results/${resultId}/appeals`, data),
+  getAppeals: (params = {}) => api.get('/student/appeals', { params })
 }
 
 // 教师相关API
 export const teacherAPI = {
   // 学生管理
   getStudents: (params = {}) => api.get('/teacher/students', { params }),
+  getStudentAnalytics: (id) => api.get(`/teacher/students/${id}/analytics`),
+  getStudentMastery: (id) => api.get(`/teacher/students/${id}/mastery`),
   createStudent: (data) => api.post('/teacher/students', data),
   updateStudent: (id, data) => api.put(`/teacher/students/${id}`, data),
   deleteStudent: (id) => api.delete(`/teacher/students/${id}`),
   importStudents: (data) => api.post('/teacher/students/import', data),
-  exportStudents: () => api.get('/teacher/students/export'),
+  exportStudents: (params = {}) => api.get('/teacher/students/export', { params, responseType: 'blob' }),
   
   // 班级管理
   getClasses: (params = {}) => api.get('/teacher/classes', { params }),
@@ -92,6 +136,25 @@ export const teacherAPI = {
   createAssignment: (data) => api.post('/teacher/exam-assignments', data),
   updateAssignment: (id, data) => api.put(`/teacher/exam-assignments/${id}`, data),
   deleteAssignment: (id) => api.delete(`/teacher/exam-assignments/${id}`),
+  releaseResults: (id, data) => api.post(`/teacher/exam-assignments/${id}/release`, data),
+  withholdResults: (id) => api.delete(`/teacher/exam-assignments/${id}/release`),
+
+  // 成绩册
+  getAtRiskStudents: (classId, params = {}) => api.get(`/teacher/classes/${classId}/at-risk`, { params }),
+  getClassMastery: (classId) => api.get(`/teacher/classes/${classId}/mastery`),
+  getGradebook: (classId) => api.get(`/teacher/classes/${classId}/gradebook`),
+  exportGradebook: (classId) => api.get(`/teacher/classes/${classId}/gradebook/export`, { responseType: 'blob' }),
+  updateGradebookSettings: (classId, data) => api.put(`/teacher/classes/${classId}/gradebook/settings`, data),
+  setGradebookExcusal: (classId, data) => api.put(`/teacher/classes/${classId}/gradebook/excusals`, data),
+  createGradebookCategory: (classId, data) => api.post(`/teacher/classes/${classId}/gradebook/categories`, data),
+  updateGradebookCategory: (classId, id, data) => api.put(`/teacher/classes/${classId}/gradebook/categories/${id}`, data),
+  deleteGradebookCategory: (classId, id) => api.delete(`/teacher/classes/${classId}/gradebook/categories/${id}`),
+  getGradeScales: () => api.get('/teacher/grade-scales'),
+
+  // 成绩申诉
+  getAppeals: (params = {}) => api.get('/teacher/appeals', { params }),
+  acceptAppeal: (id, data) => api.post(`/teacher/appeals/${id}/accept`, data),
+  rejectAppeal: (id, data) => api.post(`/teacher/appeals/${id}/reject`, data),
   
   // 登录日志
   getLoginLogs: (params = {}) => api.get('/teacher/login-logs', { params }),
@@ -102,7 +165,7 @@ export const teacherAPI = {
   getScoreDistribution: (id, range = '10') => api.get(`/teacher/results-analysis/score-distribution/${id}`, { params: { range } }),
   getClassComparison: (id, metric = 'avg') => api.get(`/teacher/results-analysis/class-comparison/${id}`, { params: { metric } }),
   getExamDetail: (id) => api.get(`/teacher/results-analysis/exam-detail/${id}`),
-  exportExamReport: () => api.get('/teacher/results-analysis/export'),
+  exportExamReport: (params = {}) => api.get('/teacher/results-analysis/export', { params, responseType: 'blob' }),
   
   // 消息管理
   getMessages: (params = {}) => api.get('/teacher/messages', { params }),